@@ -1,8 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"go.uber.org/atomic"
 
@@ -16,9 +20,134 @@ type Application struct {
 	MaxHTTPParallel int    `json:"max-http-parallel"`
 	P2PPort         uint16 `json:"p2p-port"`
 	NumWant         uint16 `json:"num-want"`
+	// how many peers are unchoked by upload/download rate, per torrent.
+	// one more peer will be unchoked optimistically.
+	UnchokeSlots uint16 `json:"unchoke-slots"`
+	// enable mainline DHT on p2p port
+	DHT bool `json:"dht"`
+	// peer connection transports in preference order, "tcp" or "utp".
+	// uTP share UDP p2p port with DHT.
+	Transports []string `json:"transports"`
 	// hard global connection limit
-	GlobalConnectionLimit uint16      `json:"global-connections-limit"`
-	Fallocate             atomic.Bool `json:"fallocate"`
+	GlobalConnectionLimit uint16 `json:"global-connections-limit"`
+	// client-wide speed limit in bytes per second, 0 for unlimited.
+	DownloadLimit int64 `json:"download-limit"`
+	UploadLimit   int64 `json:"upload-limit"`
+	// alternative speed limits, first matched profile override global speed limit.
+	SpeedSchedule []SpeedProfile `json:"speed-schedule"`
+	// queue limits, 0 for unlimited.
+	MaxActiveChecking  int `json:"max-active-checking"`
+	MaxActiveDownloads int `json:"max-active-downloads"`
+	MaxActiveUploads   int `json:"max-active-uploads"`
+	// torrents without transfer don't count in queue limits.
+	QueueIgnoreStalled bool `json:"queue-ignore-stalled"`
+	// ip blocklist files in eMule dat or PeerGuardian p2p format, may be gzip compressed.
+	// files in `ipfilter` directory of session are also loaded.
+	IPFilter []string `json:"ip-filter"`
+	// seeding goals, 0 for unlimited. time limits are in seconds, same as RPC.
+	SeedRatioLimit float64 `json:"seed-ratio-limit"`
+	SeedTimeLimit  int64   `json:"seed-time-limit"`
+	SeedIdleLimit  int64   `json:"seed-idle-limit"`
+	// action when any seeding goal is reached, "stop", "remove" or "remove-data".
+	SeedLimitAction string      `json:"seed-limit-action"`
+	Fallocate       atomic.Bool `json:"fallocate"`
+}
+
+// SpeedProfile is an alternative speed limit applied in a time range of day.
+// Start and End are in "15:04" format of local time, range may wrap midnight like "23:00" to "07:00".
+// Days are weekdays the profile applies, 0 is Sunday, empty for every day.
+type SpeedProfile struct {
+	Start         string         `json:"start"`
+	End           string         `json:"end"`
+	Days          []time.Weekday `json:"days"`
+	DownloadLimit int64          `json:"download-limit"`
+	UploadLimit   int64          `json:"upload-limit"`
+}
+
+func (p SpeedProfile) validate() error {
+	if _, err := time.Parse(timeOfDay, p.Start); err != nil {
+		return errgo.Wrap(err, fmt.Sprintf("invalid start time %q", p.Start))
+	}
+
+	if _, err := time.Parse(timeOfDay, p.End); err != nil {
+		return errgo.Wrap(err, fmt.Sprintf("invalid end time %q", p.End))
+	}
+
+	for _, day := range p.Days {
+		if day < time.Sunday || day > time.Saturday {
+			return fmt.Errorf("invalid weekday %d", day)
+		}
+	}
+
+	return nil
+}
+
+// Match check if t is in time range of profile.
+func (p SpeedProfile) Match(t time.Time) bool {
+	if len(p.Days) != 0 && !slices.Contains(p.Days, t.Weekday()) {
+		return false
+	}
+
+	start, err := time.Parse(timeOfDay, p.Start)
+	if err != nil {
+		return false
+	}
+
+	end, err := time.Parse(timeOfDay, p.End)
+	if err != nil {
+		return false
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+
+	if from <= to {
+		return from <= now && now < to
+	}
+
+	return now >= from || now < to
+}
+
+// ActiveSpeedProfile return first profile matching t, or nil.
+func (a *Application) ActiveSpeedProfile(t time.Time) *SpeedProfile {
+	for i := range a.SpeedSchedule {
+		if a.SpeedSchedule[i].Match(t) {
+			return &a.SpeedSchedule[i]
+		}
+	}
+
+	return nil
+}
+
+const timeOfDay = "15:04"
+
+const (
+	TransportTCP = "tcp"
+	TransportUTP = "utp"
+)
+
+func validateTransports(transports []string) error {
+	if len(transports) == 0 {
+		return errors.New("at least one transport is required")
+	}
+
+	for i, t := range transports {
+		if t != TransportTCP && t != TransportUTP {
+			return fmt.Errorf("unknown transport %q, only 'tcp' or 'utp' are allowed", t)
+		}
+
+		if slices.Contains(transports[:i], t) {
+			return fmt.Errorf("duplicated transport %q", t)
+		}
+	}
+
+	return nil
+}
+
+// UTPEnabled check if uTP is in transports.
+func (a *Application) UTPEnabled() bool {
+	return slices.Contains(a.Transports, TransportUTP)
 }
 
 type Config struct {
@@ -27,13 +156,43 @@ type Config struct {
 
 func LoadFromFile(path string) (Config, error) {
 	var cfg = Config{
-		App: Application{MaxHTTPParallel: 100, GlobalConnectionLimit: 50},
+		App: Application{
+			MaxHTTPParallel:       100,
+			GlobalConnectionLimit: 50,
+			UnchokeSlots:          4,
+			DHT:                   true,
+			Transports:            []string{TransportTCP, TransportUTP},
+			MaxActiveChecking:     1,
+			MaxActiveDownloads:    5,
+			QueueIgnoreStalled:    true,
+			SeedLimitAction:       "stop",
+		},
 	}
 
 	if _, err := toml.DecodeFile(path, &cfg); err != nil && !os.IsNotExist(err) {
 		return cfg, errgo.Wrap(err, "failed to parse config file")
 	}
 
+	for i, p := range cfg.App.SpeedSchedule {
+		if err := p.validate(); err != nil {
+			return cfg, errgo.Wrap(err, fmt.Sprintf("invalid `application.speed-schedule[%d]`", i))
+		}
+	}
+
+	if err := validateTransports(cfg.App.Transports); err != nil {
+		return cfg, errgo.Wrap(err, "invalid `application.transports`")
+	}
+
+	switch cfg.App.SeedLimitAction {
+	case "stop", "remove", "remove-data":
+	default:
+		return cfg, fmt.Errorf("invalid `application.seed-limit-action` %q, only 'stop', 'remove' or 'remove-data' are allowed", cfg.App.SeedLimitAction)
+	}
+
+	if cfg.App.SeedRatioLimit < 0 || cfg.App.SeedTimeLimit < 0 || cfg.App.SeedIdleLimit < 0 {
+		return cfg, errors.New("seeding limits can't be negative")
+	}
+
 	if cfg.App.DownloadDir == "" {
 		hd, err := os.UserHomeDir()
 		if err != nil {
@@ -0,0 +1,44 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/config"
+)
+
+func TestSpeedProfileMatch(t *testing.T) {
+	// 2024-01-01 is Monday
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	day := config.SpeedProfile{Start: "09:00", End: "18:00"}
+	require.False(t, day.Match(at(8, 59)))
+	require.True(t, day.Match(at(9, 0)))
+	require.True(t, day.Match(at(17, 59)))
+	require.False(t, day.Match(at(18, 0)))
+
+	night := config.SpeedProfile{Start: "23:00", End: "07:00"}
+	require.True(t, night.Match(at(23, 30)))
+	require.True(t, night.Match(at(6, 59)))
+	require.False(t, night.Match(at(12, 0)))
+
+	weekend := config.SpeedProfile{Start: "00:00", End: "23:59", Days: []time.Weekday{time.Saturday, time.Sunday}}
+	require.False(t, weekend.Match(at(12, 0)))
+	require.True(t, weekend.Match(at(12, 0).AddDate(0, 0, 5)))
+}
+
+func TestActiveSpeedProfile(t *testing.T) {
+	a := config.Application{SpeedSchedule: []config.SpeedProfile{
+		{Start: "09:00", End: "18:00", DownloadLimit: 1},
+		{Start: "00:00", End: "23:59", DownloadLimit: 2},
+	}}
+
+	require.EqualValues(t, 1, a.ActiveSpeedProfile(time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)).DownloadLimit)
+	require.EqualValues(t, 2, a.ActiveSpeedProfile(time.Date(2024, 1, 1, 20, 0, 0, 0, time.Local)).DownloadLimit)
+
+	require.Nil(t, (&config.Application{}).ActiveSpeedProfile(time.Now()))
+}
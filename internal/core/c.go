@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/netip"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
@@ -16,18 +17,25 @@ import (
 	"github.com/jellydator/ttlcache/v3"
 	"github.com/rs/zerolog/log"
 	"github.com/samber/lo"
+	"github.com/trim21/errgo"
 	"go.uber.org/atomic"
 	"golang.org/x/sync/semaphore"
 
 	"tyr/internal/bep40"
 	"tyr/internal/config"
+	"tyr/internal/dht"
 	"tyr/internal/meta"
 	imse "tyr/internal/mse"
+	"tyr/internal/pkg/bandwidth"
+	"tyr/internal/pkg/empty"
 	"tyr/internal/pkg/global"
 	"tyr/internal/pkg/global/tasks"
-	"tyr/internal/pkg/gslice"
+	"tyr/internal/pkg/ipfilter"
 	"tyr/internal/pkg/random"
+	"tyr/internal/pkg/udpmux"
 	"tyr/internal/pkg/unsafe"
+	"tyr/internal/pkg/utp"
+	"tyr/internal/udptracker"
 	"tyr/internal/util"
 )
 
@@ -59,15 +67,22 @@ func New(cfg config.Config, sessionPath string) *Client {
 
 	v4, v6, _ := util.GetIpAddress()
 
-	return &Client{
+	c := &Client{
 		Config:      cfg,
 		ctx:         ctx,
 		cancel:      cancel,
 		ch:          ttlcache.New[netip.AddrPort, connHistory](),
 		sem:         semaphore.NewWeighted(int64(cfg.App.GlobalConnectionLimit)),
-		checkQueue:  make([]meta.Hash, 0, 3),
+		queueNotify: make(chan empty.Empty, 1),
 		downloadMap: make(map[meta.Hash]*Download),
+		peerHashes:  make(map[meta.Hash]*Download),
+		categories:  make(map[string]Category),
+		events:      eventBus{subscriptions: make(map[*Subscription]struct{})},
+		bans:        banList{strikes: make(map[netip.Addr]int), bans: make(map[netip.Addr]Ban)},
 		connChan:    make(chan incomingConn, 1),
+		udpTracker:  udptracker.New(),
+		downLimiter: bandwidth.New(0),
+		upLimiter:   bandwidth.New(0),
 		http:        resty.NewWithClient(hc).SetHeader("User-Agent", global.UserAgent).SetRedirectPolicy(resty.NoRedirectPolicy()),
 		mseDisabled: mseDisabled,
 		mseSelector: mseSelector,
@@ -77,6 +92,12 @@ func New(cfg config.Config, sessionPath string) *Client {
 		v4Addr:      *atomic.NewPointer(v4),
 		v6Addr:      *atomic.NewPointer(v6),
 	}
+
+	c.downloadLimit.Store(cfg.App.DownloadLimit)
+	c.uploadLimit.Store(cfg.App.UploadLimit)
+	c.applySpeedLimits()
+
+	return c
 }
 
 type incomingConn struct {
@@ -87,20 +108,33 @@ type incomingConn struct {
 type Client struct {
 	ctx         context.Context
 	http        *resty.Client
+	udpTracker  *udptracker.Client
+	downLimiter *bandwidth.Limiter
+	upLimiter   *bandwidth.Limiter
 	cancel      context.CancelFunc
 	downloadMap map[meta.Hash]*Download
+	// peerHashes map info hashes used by peers to downloads, hybrid torrent has 2 info hashes.
+	peerHashes  map[meta.Hash]*Download
+	categories  map[string]Category
 	mseKeys     mse.SecretKeyIter
 	connChan    chan incomingConn
 	sem         *semaphore.Weighted
 	mseSelector mse.CryptoSelector
 	ch          *ttlcache.Cache[netip.AddrPort, connHistory]
 	fh          map[string]*os.File
+	dht         atomic.Pointer[dht.Server]
+	udp         *udpmux.Mux
+	utp         atomic.Pointer[utp.Socket]
 	v4Addr      atomic.Pointer[netip.Addr]
 	v6Addr      atomic.Pointer[netip.Addr]
+	ipFilter    atomic.Pointer[ipfilter.Filter]
 	sessionPath string
 	infoHashes  []meta.Hash
 	downloads   []*Download
-	checkQueue  []meta.Hash
+	queue       []meta.Hash
+	queueNotify chan empty.Empty
+	events      eventBus
+	bans        banList
 
 	// a random key for addrPort priority
 	randKey []byte
@@ -109,13 +143,27 @@ type Client struct {
 	//ip6 atomic.Pointer[netip.Addr]
 	Config          config.Config
 	connectionCount atomic.Uint32
+	downloadLimit   atomic.Int64
+	uploadLimit     atomic.Int64
 	m               sync.RWMutex
-	checkQueueLock  sync.Mutex
 	fLock           sync.Mutex
 	mseDisabled     bool
 }
 
-func (c *Client) AddTorrent(m *metainfo.MetaInfo, info meta.Info, downloadPath string, tags []string) error {
+// AddTorrent add a torrent to session, filePriority is priority of each file, nil to download all files.
+// category must exist, empty for uncategorized torrent.
+func (c *Client) AddTorrent(
+	m *metainfo.MetaInfo,
+	info meta.Info,
+	downloadPath string,
+	tags []string,
+	category string,
+	filePriority []FilePriority,
+) error {
+	if filePriority != nil && len(filePriority) != len(info.Files) {
+		return fmt.Errorf("torrent has %d files, but got %d file priorities", len(info.Files), len(filePriority))
+	}
+
 	log.Info().Msgf("try add torrent %s", info.Hash)
 
 	c.m.RLock()
@@ -125,23 +173,134 @@ func (c *Client) AddTorrent(m *metainfo.MetaInfo, info meta.Info, downloadPath s
 	}
 	c.m.RUnlock()
 
+	if err := c.saveTorrentFile(m, info.Hash); err != nil {
+		return err
+	}
+
 	c.m.Lock()
 	defer c.m.Unlock()
 
+	if _, ok := c.categories[category]; category != "" && !ok {
+		return fmt.Errorf("category %q not exists", category)
+	}
+
 	d := c.NewDownload(m, info, downloadPath, tags)
+	d.category = category
+	if filePriority != nil {
+		d.setFilePriority(filePriority)
+	}
+	d.queuePosition.Store(int64(len(c.queue)))
 
-	c.downloads = append(c.downloads, d)
-	c.downloadMap[info.Hash] = d
-	c.infoHashes = lo.Keys(c.downloadMap)
+	d.m.Lock()
+	err := c.saveResume(d)
+	d.m.Unlock()
+	if err != nil {
+		return errgo.Wrap(err, "failed to save resume data")
+	}
 
-	tasks.Submit(d.Init)
+	c.addDownload(d)
+	c.publish(ClientEvent{Type: EventTorrentAdded, InfoHash: d.info.Hash})
 
 	return nil
 }
 
+func (c *Client) AddMagnet(magnet metainfo.Magnet, downloadPath string, tags []string, category string) error {
+	h := meta.Hash(magnet.InfoHash)
+	log.Info().Msgf("try add magnet %s", h)
+
+	c.m.RLock()
+	if _, ok := c.downloadMap[h]; ok {
+		c.m.RUnlock()
+		return fmt.Errorf("torrent %s exists", h)
+	}
+	c.m.RUnlock()
+
+	if err := c.saveMagnetFile(magnet); err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if _, ok := c.categories[category]; category != "" && !ok {
+		return fmt.Errorf("category %q not exists", category)
+	}
+
+	d := c.NewMagnetDownload(magnet, downloadPath, tags)
+	d.category = category
+	d.queuePosition.Store(int64(len(c.queue)))
+
+	d.m.Lock()
+	err := c.saveResume(d)
+	d.m.Unlock()
+	if err != nil {
+		return errgo.Wrap(err, "failed to save resume data")
+	}
+
+	c.addDownload(d)
+	c.publish(ClientEvent{Type: EventTorrentAdded, InfoHash: d.info.Hash})
+
+	return nil
+}
+
+// addDownload must be called with c.m locked
+func (c *Client) addDownload(d *Download) {
+	c.downloads = append(c.downloads, d)
+	c.downloadMap[d.info.Hash] = d
+	c.updateInfoHashes()
+	c.queue = append(c.queue, d.info.Hash)
+
+	tasks.Submit(d.task(d.Init))
+}
+
+// updateInfoHashes rebuild info hashes of incoming connections, must be called with c.m locked.
+func (c *Client) updateInfoHashes() {
+	clear(c.peerHashes)
+
+	for _, d := range c.downloadMap {
+		for _, h := range d.infoHashes() {
+			c.peerHashes[h] = d
+		}
+	}
+
+	c.infoHashes = lo.Keys(c.peerHashes)
+}
+
 type DownloadInfo struct {
-	Name string
-	Tags []string
+	Name     string
+	Category string
+	Tags     []string
+	Trackers []TrackerInfo
+	WebSeeds []WebSeedInfo
+	Files    []FileInfo
+}
+
+// FileInfo is a file of torrent, Completed is bytes of verified pieces in this file.
+type FileInfo struct {
+	Path      string
+	Length    int64
+	Completed int64
+	Priority  FilePriority
+	// Pad file is only used to align files to piece boundary, it's not stored on disk.
+	Pad bool
+}
+
+type TrackerInfo struct {
+	LastScrape time.Time
+	URL        string
+	Error      string
+	Tier       int
+	Peers      int
+	Seeders    int
+	Leechers   int
+	Completed  int
+}
+
+// WebSeedInfo is a http mirror of torrent, Downloaded is bytes fetched from it.
+type WebSeedInfo struct {
+	URL        string
+	Error      string
+	Downloaded int64
 }
 
 func (c *Client) GetTorrent(h meta.Hash) (DownloadInfo, error) {
@@ -153,24 +312,27 @@ func (c *Client) GetTorrent(h meta.Hash) (DownloadInfo, error) {
 		return DownloadInfo{}, fmt.Errorf("torrent %s not exists", h)
 	}
 
+	d.m.RLock()
+	defer d.m.RUnlock()
+
 	return DownloadInfo{
-		Name: d.info.Name,
-		Tags: d.tags,
+		Name:     d.info.Name,
+		Category: d.category,
+		Tags:     slices.Clone(d.tags),
+		Trackers: d.trackerInfos(),
+		WebSeeds: d.webSeedInfos(),
+		Files:    d.fileInfos(),
 	}, nil
 }
 
-func (c *Client) addCheck(d *Download) {
-	c.m.Lock()
-	defer c.m.Unlock()
-
-	c.checkQueue = append(c.checkQueue, d.info.Hash)
-}
-
-func (c *Client) checkComplete(d *Download) {
-	c.m.Lock()
-	defer c.m.Unlock()
+// ListDownloads return status of all downloads, in the order they are added.
+func (c *Client) ListDownloads() []DownloadStatus {
+	c.m.RLock()
+	defer c.m.RUnlock()
 
-	c.checkQueue = gslice.Remove(c.checkQueue, d.info.Hash)
+	return lo.Map(c.downloads, func(d *Download, _ int) DownloadStatus {
+		return d.Status()
+	})
 }
 
 func (c *Client) PeerPriority(peer netip.AddrPort) uint32 {
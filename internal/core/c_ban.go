@@ -0,0 +1,121 @@
+package core
+
+import (
+	"cmp"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"tyr/internal/meta"
+)
+
+// peers get a strike for each corrupted piece they sent bad blocks of,
+// bad blocks are found by comparing them with the piece after it's downloaded again correctly,
+// and are banned client-wide after banStrikes strikes.
+// A peer is banned immediately if it's the only contributor of a corrupted piece.
+const banStrikes = 3
+
+// Ban is a banned peer address, InfoHash is the torrent it sent corrupted data.
+type Ban struct {
+	At       time.Time
+	Addr     netip.Addr
+	InfoHash meta.Hash
+}
+
+// banList is kept in memory, bans are cleared after restart.
+type banList struct {
+	strikes map[netip.Addr]int
+	bans    map[netip.Addr]Ban
+	m       sync.RWMutex
+}
+
+// strike add strikes to peers sent bad blocks of a corrupted piece of d, and ban repeat offenders.
+func (c *Client) strike(d *Download, addrs []netip.Addr) {
+	var banned []netip.Addr
+
+	c.bans.m.Lock()
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if _, ok := c.bans.bans[addr]; ok {
+			continue
+		}
+
+		c.bans.strikes[addr]++
+		if c.bans.strikes[addr] >= banStrikes {
+			banned = append(banned, addr)
+		}
+	}
+	c.bans.m.Unlock()
+
+	if len(banned) != 0 {
+		c.ban(d, banned)
+	}
+}
+
+// ban peers sent corrupted data of d, and disconnect them.
+func (c *Client) ban(d *Download, addrs []netip.Addr) {
+	var banned []netip.Addr
+
+	c.bans.m.Lock()
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if _, ok := c.bans.bans[addr]; ok {
+			continue
+		}
+
+		delete(c.bans.strikes, addr)
+		c.bans.bans[addr] = Ban{At: time.Now(), Addr: addr, InfoHash: d.info.Hash}
+		banned = append(banned, addr)
+	}
+	c.bans.m.Unlock()
+
+	for _, addr := range banned {
+		d.log.Info().Stringer("addr", addr).Msg("ban peer sending corrupted data")
+	}
+
+	if len(banned) != 0 {
+		c.closeBlockedPeers(func(addr netip.Addr) bool { return slices.Contains(banned, addr) })
+	}
+}
+
+func (c *Client) isBanned(addr netip.Addr) bool {
+	c.bans.m.RLock()
+	defer c.bans.m.RUnlock()
+
+	_, ok := c.bans.bans[addr.Unmap()]
+
+	return ok
+}
+
+// ListBans return banned peers, sorted by ban time.
+func (c *Client) ListBans() []Ban {
+	c.bans.m.RLock()
+	defer c.bans.m.RUnlock()
+
+	var r = make([]Ban, 0, len(c.bans.bans))
+	for _, ban := range c.bans.bans {
+		r = append(r, ban)
+	}
+
+	slices.SortFunc(r, func(a, b Ban) int { return cmp.Or(a.At.Compare(b.At), a.Addr.Compare(b.Addr)) })
+
+	return r
+}
+
+// ClearBans unban addresses and reset their strikes, empty addrs to clear all bans and strikes.
+func (c *Client) ClearBans(addrs []netip.Addr) {
+	c.bans.m.Lock()
+	defer c.bans.m.Unlock()
+
+	if len(addrs) == 0 {
+		clear(c.bans.bans)
+		clear(c.bans.strikes)
+		return
+	}
+
+	for _, addr := range addrs {
+		delete(c.bans.bans, addr.Unmap())
+		delete(c.bans.strikes, addr.Unmap())
+	}
+}
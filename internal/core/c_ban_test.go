@@ -0,0 +1,91 @@
+package core
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/proto"
+)
+
+func TestStrike(t *testing.T) {
+	d, _ := newTestDownload(t)
+	c := d.c
+
+	a := netip.MustParseAddr("10.0.0.1")
+	b := netip.MustParseAddr("10.0.0.2")
+
+	for range banStrikes - 1 {
+		c.strike(d, []netip.Addr{a, b})
+	}
+	require.Empty(t, c.ListBans())
+
+	c.strike(d, []netip.Addr{a, b})
+	require.True(t, c.isBanned(a))
+	require.True(t, c.isBlocked(netip.MustParseAddr("::ffff:10.0.0.2")))
+
+	c.ClearBans([]netip.Addr{a})
+	require.False(t, c.isBanned(a))
+	require.Len(t, c.ListBans(), 1)
+
+	c.ClearBans(nil)
+	require.Empty(t, c.ListBans())
+}
+
+func TestBanSoleContributor(t *testing.T) {
+	d, data := newTestDownload(t)
+	c := d.c
+
+	peer := netip.MustParseAddrPort("10.0.0.1:6881")
+	bad := make([]byte, testPieceLength)
+	require.NotEqual(t, data[:testPieceLength], bad)
+
+	require.NoError(t, d.writePieceToDisk(0, []*peerChunk{
+		{ChunkResponse: proto.ChunkResponse{PieceIndex: 0, Data: bad}, from: peer},
+	}))
+
+	require.False(t, d.bm.Get(0))
+	require.EqualValues(t, d.info.PieceLength, d.corrupted.Load())
+
+	bans := c.ListBans()
+	require.Len(t, bans, 1)
+	require.Equal(t, peer.Addr(), bans[0].Addr)
+	require.Equal(t, d.info.Hash, bans[0].InfoHash)
+}
+
+func TestSmartBan(t *testing.T) {
+	d, data := newTestDownload(t)
+	c := d.c
+
+	honest := netip.MustParseAddrPort("10.0.0.1:6881")
+	bad := netip.MustParseAddrPort("10.0.0.2:6881")
+	other := netip.MustParseAddrPort("10.0.0.3:6881")
+
+	const half = testPieceLength / 2
+
+	for index := range uint32(banStrikes) {
+		piece := data[index*testPieceLength : (index+1)*testPieceLength]
+		corrupted := append([]byte{}, piece[half:]...)
+		corrupted[0]++
+
+		// honest peer co-contribute to corrupted piece
+		require.NoError(t, d.writePieceToDisk(index, []*peerChunk{
+			{ChunkResponse: proto.ChunkResponse{PieceIndex: index, Begin: 0, Data: piece[:half]}, from: honest},
+			{ChunkResponse: proto.ChunkResponse{PieceIndex: index, Begin: half, Data: corrupted}, from: bad},
+		}))
+		require.False(t, d.bm.Get(index))
+		require.Empty(t, c.ListBans(), "contributors are not struck before bad blocks are found")
+
+		require.NoError(t, d.writePieceToDisk(index, []*peerChunk{
+			{ChunkResponse: proto.ChunkResponse{PieceIndex: index, Data: piece}, from: other},
+		}))
+		require.Eventually(t, func() bool { return d.bm.Get(index) }, time.Second, time.Millisecond)
+	}
+
+	require.False(t, c.isBanned(honest.Addr()))
+	require.False(t, c.isBanned(other.Addr()))
+	require.True(t, c.isBanned(bad.Addr()))
+	require.Empty(t, d.corruptedBlocks)
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/trim21/errgo"
+
+	"tyr/internal/meta"
+)
+
+var errEmptyCategory = errors.New("category name can't be empty")
+
+// Category is a named group of torrents.
+// Torrents are saved to SavePath when their category is set, empty SavePath won't move torrents.
+type Category struct {
+	Name     string
+	SavePath string
+}
+
+func (c *Client) categoriesFilePath() string {
+	return filepath.Join(c.sessionPath, "categories")
+}
+
+// loadCategories must be called with c.m locked.
+func (c *Client) loadCategories() error {
+	raw, err := os.ReadFile(c.categoriesFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return errgo.Wrap(err, "failed to read categories file")
+	}
+
+	var categories []Category
+	if err := bencode.Unmarshal(raw, &categories); err != nil {
+		return errgo.Wrap(err, "failed to parse categories file")
+	}
+
+	for _, category := range categories {
+		c.categories[category.Name] = category
+	}
+
+	return nil
+}
+
+// saveCategories must be called with c.m locked.
+func (c *Client) saveCategories() error {
+	b, err := bencode.Marshal(c.listCategories())
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.sessionPath, os.ModePerm); err != nil {
+		return errgo.Wrap(err, "failed to create session directory")
+	}
+
+	return errgo.Wrap(os.WriteFile(c.categoriesFilePath(), b, os.ModePerm), "failed to save categories file")
+}
+
+// listCategories must be called with c.m locked.
+func (c *Client) listCategories() []Category {
+	var r = make([]Category, 0, len(c.categories))
+	for _, category := range c.categories {
+		r = append(r, category)
+	}
+
+	slices.SortFunc(r, func(a, b Category) int { return cmp.Compare(a.Name, b.Name) })
+
+	return r
+}
+
+// ListCategories return all categories, sorted by name.
+func (c *Client) ListCategories() []Category {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.listCategories()
+}
+
+func (c *Client) GetCategory(name string) (Category, bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	category, ok := c.categories[name]
+
+	return category, ok
+}
+
+// SetCategory create a category or change save path of it.
+// Torrents already in category are not moved.
+func (c *Client) SetCategory(name, savePath string) error {
+	if name == "" {
+		return errEmptyCategory
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.categories[name] = Category{Name: name, SavePath: savePath}
+
+	return c.saveCategories()
+}
+
+// RemoveCategory remove category, torrents in it become uncategorized.
+func (c *Client) RemoveCategory(name string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if _, ok := c.categories[name]; !ok {
+		return fmt.Errorf("category %q not exists", name)
+	}
+
+	delete(c.categories, name)
+
+	for _, d := range c.downloads {
+		d.m.Lock()
+		if d.category == name {
+			d.category = ""
+		}
+		d.m.Unlock()
+	}
+
+	return c.saveCategories()
+}
+
+// SetTorrentCategory change category of torrent, empty name to remove torrent from category.
+// Torrent is moved to save path of category if it's set.
+func (c *Client) SetTorrentCategory(h meta.Hash, name string) error {
+	d, err := c.getDownload(h)
+	if err != nil {
+		return err
+	}
+
+	var category Category
+	if name != "" {
+		var ok bool
+		if category, ok = c.GetCategory(name); !ok {
+			return fmt.Errorf("category %q not exists", name)
+		}
+	}
+
+	d.m.Lock()
+	d.category = name
+	basePath := d.basePath
+	d.m.Unlock()
+
+	if category.SavePath == "" {
+		return nil
+	}
+
+	target := filepath.Join(category.SavePath, d.info.Name)
+	if target == basePath {
+		return nil
+	}
+
+	return d.Move(target)
+}
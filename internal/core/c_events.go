@@ -0,0 +1,140 @@
+package core
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.uber.org/atomic"
+
+	"tyr/internal/meta"
+)
+
+// EventType is type of client event, it's not tracker announce event.
+type EventType string
+
+const (
+	EventTorrentAdded     EventType = "torrent_added"
+	EventTorrentRemoved   EventType = "torrent_removed"
+	EventStateChanged     EventType = "state_changed"
+	EventPieceCompleted   EventType = "piece_completed"
+	EventDownloadFinished EventType = "download_finished"
+	EventTrackerError     EventType = "tracker_error"
+	EventMoveDone         EventType = "move_done"
+	EventError            EventType = "error"
+)
+
+var EventTypes = []EventType{
+	EventTorrentAdded,
+	EventTorrentRemoved,
+	EventStateChanged,
+	EventPieceCompleted,
+	EventDownloadFinished,
+	EventTrackerError,
+	EventMoveDone,
+	EventError,
+}
+
+// subscriptions buffer events, subscription is closed if subscriber is too slow.
+const eventBufferSize = 256
+
+// ClientEvent is something happened to a torrent.
+// From and To are set for state_changed, Piece for piece_completed,
+// Tracker for tracker_error, Message is error message or new download dir of move_done.
+type ClientEvent struct {
+	Time     time.Time
+	Type     EventType
+	Message  string
+	Tracker  string
+	InfoHash meta.Hash
+	Piece    uint32
+	From     State
+	To       State
+}
+
+// EventFilter select events of subscription, empty field match all events.
+type EventFilter struct {
+	InfoHashes []meta.Hash
+	Types      []EventType
+}
+
+func (f EventFilter) match(e ClientEvent) bool {
+	if len(f.Types) != 0 && !slices.Contains(f.Types, e.Type) {
+		return false
+	}
+
+	return len(f.InfoHashes) == 0 || slices.Contains(f.InfoHashes, e.InfoHash)
+}
+
+type Subscription struct {
+	C        <-chan ClientEvent
+	ch       chan ClientEvent
+	c        *Client
+	filter   EventFilter
+	overflow atomic.Bool
+}
+
+type eventBus struct {
+	subscriptions map[*Subscription]struct{}
+	m             sync.RWMutex
+}
+
+// Subscribe receive events matching filter, subscription must be closed after use.
+func (c *Client) Subscribe(filter EventFilter) *Subscription {
+	ch := make(chan ClientEvent, eventBufferSize)
+	s := &Subscription{C: ch, ch: ch, c: c, filter: filter}
+
+	c.events.m.Lock()
+	c.events.subscriptions[s] = struct{}{}
+	c.events.m.Unlock()
+
+	return s
+}
+
+// Close stop receiving events and close channel.
+func (s *Subscription) Close() {
+	s.c.events.m.Lock()
+	defer s.c.events.m.Unlock()
+
+	if _, ok := s.c.events.subscriptions[s]; ok {
+		delete(s.c.events.subscriptions, s)
+		close(s.ch)
+	}
+}
+
+// Overflow report whether subscription is closed because events are dropped,
+// subscriber should reload current state after re-subscribing.
+func (s *Subscription) Overflow() bool {
+	return s.overflow.Load()
+}
+
+// publish send event to all subscribers without blocking.
+// subscriber whose buffer is full is closed, so it won't miss events silently.
+func (c *Client) publish(e ClientEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	var overflow []*Subscription
+
+	c.events.m.RLock()
+	for s := range c.events.subscriptions {
+		if !s.filter.match(e) {
+			continue
+		}
+
+		select {
+		case s.ch <- e:
+		default:
+			log.Debug().Str("type", string(e.Type)).Msg("event subscriber is too slow, close subscription")
+			overflow = append(overflow, s)
+		}
+	}
+	c.events.m.RUnlock()
+
+	for _, s := range overflow {
+		s.overflow.Store(true)
+		s.Close()
+	}
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/meta"
+)
+
+func TestSubscribe(t *testing.T) {
+	c, h := newTestQueue(t, 2)
+
+	all := c.Subscribe(EventFilter{})
+	defer all.Close()
+
+	filtered := c.Subscribe(EventFilter{InfoHashes: []meta.Hash{h[1]}, Types: []EventType{EventStateChanged}})
+	defer filtered.Close()
+
+	c.publish(ClientEvent{Type: EventPieceCompleted, InfoHash: h[1], Piece: 3})
+	require.NoError(t, c.downloadMap[h[0]].Stop())
+	require.NoError(t, c.downloadMap[h[1]].Stop())
+
+	e := <-all.C
+	require.Equal(t, EventPieceCompleted, e.Type)
+	require.EqualValues(t, 3, e.Piece)
+	require.False(t, e.Time.IsZero())
+
+	e = <-all.C
+	require.Equal(t, h[0], e.InfoHash)
+
+	e = <-filtered.C
+	require.Equal(t, EventStateChanged, e.Type)
+	require.Equal(t, h[1], e.InfoHash)
+	require.Equal(t, Queued, e.From)
+	require.Equal(t, Stopped, e.To)
+	require.Empty(t, filtered.C)
+
+	filtered.Close()
+	filtered.Close()
+	_, ok := <-filtered.C
+	require.False(t, ok, "channel should be closed")
+}
+
+func TestSubscribeOverflow(t *testing.T) {
+	c, h := newTestQueue(t, 1)
+
+	slow := c.Subscribe(EventFilter{})
+	defer slow.Close()
+
+	for i := 0; i < eventBufferSize; i++ {
+		c.publish(ClientEvent{Type: EventPieceCompleted, InfoHash: h[0], Piece: uint32(i)})
+	}
+
+	require.False(t, slow.Overflow())
+
+	c.publish(ClientEvent{Type: EventDownloadFinished, InfoHash: h[0]})
+	require.True(t, slow.Overflow())
+
+	var n int
+	for range slow.C {
+		n++
+	}
+
+	require.Equal(t, eventBufferSize, n, "buffered events should still be received before channel is closed")
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+	"github.com/trim21/errgo"
+
+	"tyr/internal/pkg/ipfilter"
+)
+
+// ipFilterDir is where rule files are loaded from, in addition to files in `application.ip-filter` config.
+func (c *Client) ipFilterDir() string {
+	return filepath.Join(c.sessionPath, "ipfilter")
+}
+
+// ipFilterFiles return rule files of config and session directory.
+func (c *Client) ipFilterFiles() ([]string, error) {
+	var files = append([]string{}, c.Config.App.IPFilter...)
+
+	entries, err := os.ReadDir(c.ipFilterDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return files, nil
+		}
+
+		return nil, errgo.Wrap(err, "failed to read ip filter directory")
+	}
+
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, filepath.Join(c.ipFilterDir(), entry.Name()))
+		}
+	}
+
+	return files, nil
+}
+
+// ReloadIPFilter load rule files again and replace current ip filter,
+// connected peers in new filter are disconnected. Return ranges count of new filter.
+// Current filter is kept if any file failed to load.
+func (c *Client) ReloadIPFilter() (int, error) {
+	files, err := c.ipFilterFiles()
+	if err != nil {
+		return 0, err
+	}
+
+	var ranges []ipfilter.Range
+	for _, file := range files {
+		r, err := ipfilter.LoadFile(file)
+		if err != nil {
+			return 0, errgo.Wrap(err, "failed to load ip filter")
+		}
+
+		ranges = append(ranges, r...)
+	}
+
+	filter := ipfilter.New(ranges)
+	c.ipFilter.Store(filter)
+
+	log.Info().Int("files", len(files)).Int("ranges", filter.Len()).Msg("ip filter loaded")
+
+	c.closeBlockedPeers(filter.Contains)
+
+	return filter.Len(), nil
+}
+
+// isBlocked check if address is blocked by ip filter or banned.
+func (c *Client) isBlocked(addr netip.Addr) bool {
+	return c.ipFilter.Load().Contains(addr) || c.isBanned(addr)
+}
+
+// closeBlockedPeers disconnect connected peers matching blocked, and count them as blocked of their torrents.
+func (c *Client) closeBlockedPeers(blocked func(addr netip.Addr) bool) {
+	c.m.RLock()
+	downloads := c.downloads
+	c.m.RUnlock()
+
+	for _, d := range downloads {
+		d.conn.Range(func(addr netip.AddrPort, p *Peer) bool {
+			if blocked(addr.Addr().Unmap()) {
+				d.blocked.Inc()
+				p.close()
+			}
+
+			return true
+		})
+	}
+}
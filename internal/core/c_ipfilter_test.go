@@ -0,0 +1,62 @@
+package core
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/config"
+)
+
+func TestReloadIPFilter(t *testing.T) {
+	dir := t.TempDir()
+	c := New(config.Config{}, dir)
+
+	n, err := c.ReloadIPFilter()
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.False(t, c.isBlocked(netip.MustParseAddr("10.0.0.1")))
+
+	require.NoError(t, os.MkdirAll(c.ipFilterDir(), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(c.ipFilterDir(), "a.p2p"), []byte("test:10.0.0.0-10.0.0.255\n"), os.ModePerm))
+
+	c.Config.App.IPFilter = []string{filepath.Join(dir, "b.dat")}
+	require.NoError(t, os.WriteFile(c.Config.App.IPFilter[0], []byte("192.168.000.000 - 192.168.000.255 , 100 , test\n"), os.ModePerm))
+
+	n, err = c.ReloadIPFilter()
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.True(t, c.isBlocked(netip.MustParseAddr("10.0.0.1")))
+	require.True(t, c.isBlocked(netip.MustParseAddr("192.168.0.1")))
+	require.False(t, c.isBlocked(netip.MustParseAddr("10.0.1.1")))
+
+	c.Config.App.IPFilter = append(c.Config.App.IPFilter, filepath.Join(dir, "not-exists.dat"))
+	_, err = c.ReloadIPFilter()
+	require.Error(t, err)
+	require.True(t, c.isBlocked(netip.MustParseAddr("10.0.0.1")), "filter should be kept if reload failed")
+}
+
+func TestConnectBlockedPeer(t *testing.T) {
+	c, h := newTestQueue(t, 1)
+	d := c.downloadMap[h[0]]
+
+	c.Config.App.IPFilter = []string{filepath.Join(t.TempDir(), "a.p2p")}
+	require.NoError(t, os.WriteFile(c.Config.App.IPFilter[0], []byte("test:10.0.0.0-10.0.0.255\n"), os.ModePerm))
+	_, err := c.ReloadIPFilter()
+	require.NoError(t, err)
+
+	// peer added in dev mode
+	for d.peers.Len() > 0 {
+		d.peers.Pop()
+	}
+
+	d.peers.Push(peerWithPriority{addrPort: netip.MustParseAddrPort("10.0.0.1:6881")})
+	d.connectToPeers()
+
+	require.Zero(t, d.peers.Len())
+	require.EqualValues(t, 1, d.Status().Blocked)
+	require.Zero(t, c.connectionCount.Load())
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+
+	"tyr/internal/meta"
+	"tyr/internal/pkg/filepool"
+	"tyr/internal/pkg/global/tasks"
+	"tyr/internal/pkg/gslice"
+)
+
+func (c *Client) getDownload(h meta.Hash) (*Download, error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	d, ok := c.downloadMap[h]
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+
+	return d, nil
+}
+
+func (c *Client) StartDownload(h meta.Hash) error {
+	d, err := c.getDownload(h)
+	if err != nil {
+		return err
+	}
+
+	return d.Start()
+}
+
+func (c *Client) StopDownload(h meta.Hash) error {
+	d, err := c.getDownload(h)
+	if err != nil {
+		return err
+	}
+
+	return d.Stop()
+}
+
+func (c *Client) ResumeDownload(h meta.Hash) error {
+	d, err := c.getDownload(h)
+	if err != nil {
+		return err
+	}
+
+	return d.Resume()
+}
+
+func (c *Client) RecheckDownload(h meta.Hash) error {
+	d, err := c.getDownload(h)
+	if err != nil {
+		return err
+	}
+
+	return d.Check()
+}
+
+// RemoveDownload stop download and remove it from session.
+// Downloaded files are also deleted if deleteData is true.
+func (c *Client) RemoveDownload(h meta.Hash, deleteData bool) error {
+	c.m.Lock()
+	d, ok := c.downloadMap[h]
+	if !ok {
+		c.m.Unlock()
+		return ErrTorrentNotFound
+	}
+
+	delete(c.downloadMap, h)
+	c.downloads = slices.DeleteFunc(c.downloads, func(item *Download) bool {
+		return item == d
+	})
+	c.updateInfoHashes()
+	c.queue = gslice.Remove(c.queue, h)
+	c.updateQueuePosition()
+	c.m.Unlock()
+
+	log.Info().Msgf("remove torrent %s", h)
+
+	basePath := d.remove()
+	c.publish(ClientEvent{Type: EventTorrentRemoved, InfoHash: h})
+
+	for _, p := range []string{c.resumeFilePath(h), c.torrentFilePath(h), c.magnetFilePath(h)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if deleteData {
+		return d.deleteFiles(basePath)
+	}
+
+	return nil
+}
+
+// remove stop all background goroutines and connections of download, return its current base path.
+// It waits for tasks using files of download, so files are not written or moved after it returns.
+func (d *Download) remove() string {
+	d.m.Lock()
+	d.state = Stopped
+	d.m.Unlock()
+
+	// peers being added and tasks being submitted see canceled context
+	d.connMutex.Lock()
+	d.taskMutex.Lock()
+	d.cancel()
+	d.taskMutex.Unlock()
+	d.connMutex.Unlock()
+
+	d.cond.Broadcast()
+
+	d.closePeers()
+
+	tasks.Submit(d.announceStopped)
+
+	d.taskWG.Wait()
+
+	d.m.RLock()
+	basePath := d.basePath
+	files := d.info.Files
+	d.m.RUnlock()
+
+	for _, file := range files {
+		filepool.Evict(filepath.Join(basePath, file.Path))
+	}
+
+	filepool.Evict(d.partsFilePath())
+
+	return basePath
+}
+
+// acquireTask register a task using files of download, return false if download is removed.
+// taskWG.Done must be called after task is done.
+func (d *Download) acquireTask() bool {
+	d.taskMutex.RLock()
+	defer d.taskMutex.RUnlock()
+
+	if d.ctx.Err() != nil {
+		return false
+	}
+
+	d.taskWG.Add(1)
+
+	return true
+}
+
+// task wrap fn as a task using files of download, fn is skipped if download is removed.
+func (d *Download) task(fn func()) func() {
+	if !d.acquireTask() {
+		return func() {}
+	}
+
+	return func() {
+		defer d.taskWG.Done()
+		fn()
+	}
+}
+
+func (d *Download) closePeers() {
+	d.conn.Range(func(_ netip.AddrPort, p *Peer) bool {
+		p.close()
+		return true
+	})
+}
+
+func (d *Download) announceStopped() {
+	for _, tier := range d.trackers {
+		tier.announceStop(d)
+	}
+}
+
+// deleteFiles delete files of torrent and directories they leave empty.
+// basePath itself is only removed if it's named after torrent.
+func (d *Download) deleteFiles(basePath string) error {
+	if err := os.Remove(d.partsFilePath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for _, file := range d.info.Files {
+		p := filepath.Join(basePath, file.Path)
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		for dir := filepath.Dir(p); dir != basePath && len(dir) > len(basePath); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+
+	if filepath.Base(basePath) == d.info.Name {
+		// fail if directory is not empty
+		_ = os.Remove(basePath)
+	}
+
+	return nil
+}
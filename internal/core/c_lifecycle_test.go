@@ -0,0 +1,93 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/pkg/mempool"
+)
+
+// addTestDownload create a test download managed by client.
+func addTestDownload(t *testing.T) (*Download, []byte) {
+	t.Helper()
+
+	d, data := newTestDownload(t)
+
+	d.c.m.Lock()
+	d.c.addDownload(d)
+	d.c.m.Unlock()
+
+	return d, data
+}
+
+func TestRemoveDownload(t *testing.T) {
+	d, data := addTestDownload(t)
+	c := d.c
+
+	for index := range d.info.NumPieces {
+		writeTestPiece(t, d, data, index)
+	}
+
+	require.NoError(t, c.RemoveDownload(d.info.Hash, false))
+	require.ErrorIs(t, c.RemoveDownload(d.info.Hash, false), ErrTorrentNotFound)
+	require.Empty(t, c.downloads)
+
+	b, err := os.ReadFile(filepath.Join(d.basePath, "a"))
+	require.NoError(t, err)
+	require.Equal(t, data[:20000], b, "data is kept")
+
+	require.ErrorIs(t, d.Move(t.TempDir()), ErrTorrentNotFound)
+}
+
+func TestRemoveDownloadDeleteData(t *testing.T) {
+	d, data := addTestDownload(t)
+	c := d.c
+
+	writeTestPiece(t, d, data, 0)
+
+	// piece is verified and being written when torrent is removed
+	go d.task(func() {
+		time.Sleep(time.Millisecond * 100)
+
+		buf := mempool.Get()
+		buf.Write(data[testPieceLength : 2*testPieceLength])
+		d.savePiece(1, buf)
+	})()
+
+	require.NoError(t, c.RemoveDownload(d.info.Hash, true))
+
+	_, err := os.Stat(d.basePath)
+	require.ErrorIs(t, err, os.ErrNotExist, "files should not be created again after removed")
+
+	// tasks are not run after removed
+	var ran bool
+	d.task(func() { ran = true })()
+	require.False(t, ran)
+}
+
+func TestMoveCanceled(t *testing.T) {
+	d, data := newTestDownload(t)
+
+	for index := range d.info.NumPieces {
+		writeTestPiece(t, d, data, index)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	target := t.TempDir()
+	require.Error(t, d.move(ctx, target))
+
+	for _, f := range d.info.Files {
+		_, err := os.Stat(filepath.Join(target, f.Path))
+		require.ErrorIs(t, err, os.ErrNotExist, "copied files should be removed")
+
+		_, err = os.Stat(filepath.Join(d.basePath, f.Path))
+		require.NoError(t, err, "source files should be kept")
+	}
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/samber/lo"
+
+	"tyr/internal/meta"
+	"tyr/internal/pkg/empty"
+)
+
+// active download with transfer rate lower than this is stalled.
+const stalledRate = 2 * units.KiB
+
+// download just started need some time to connect to peers, it's not stalled before this.
+const stalledTimeout = time.Minute
+
+type QueueAction string
+
+const (
+	QueueTop    QueueAction = "top"
+	QueueUp     QueueAction = "up"
+	QueueDown   QueueAction = "down"
+	QueueBottom QueueAction = "bottom"
+)
+
+// notifyQueue wake up queue manager, never block.
+func (c *Client) notifyQueue() {
+	select {
+	case c.queueNotify <- empty.Empty{}:
+	default:
+	}
+}
+
+func (c *Client) backgroundQueue() {
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.queueNotify:
+		}
+
+		c.processQueue()
+	}
+}
+
+// processQueue start or queue downloads by queue order and limits.
+// Torrents earlier in queue get slots first, active torrents beyond limit are queued again.
+func (c *Client) processQueue() {
+	c.m.RLock()
+	queue := lo.Map(c.queue, func(h meta.Hash, _ int) *Download {
+		return c.downloadMap[h]
+	})
+	c.m.RUnlock()
+
+	now := time.Now()
+	app := &c.Config.App
+
+	var checking int
+	for _, d := range queue {
+		if d.getState() == Checking {
+			checking++
+		}
+	}
+
+	var downloading, uploading int
+
+	for _, d := range queue {
+		state := d.getState()
+
+		if state == CheckQueued {
+			if app.MaxActiveChecking == 0 || checking < app.MaxActiveChecking {
+				checking++
+				_ = d.fire(eventDequeue)
+			}
+
+			continue
+		}
+
+		var limit int
+		var used *int
+
+		switch state {
+		case Downloading, FetchingMetadata:
+			limit, used = app.MaxActiveDownloads, &downloading
+		case Uploading:
+			limit, used = app.MaxActiveUploads, &uploading
+		case Queued:
+			if d.isCompleted() {
+				limit, used = app.MaxActiveUploads, &uploading
+			} else {
+				limit, used = app.MaxActiveDownloads, &downloading
+			}
+		case Stopped, Checking, Moving, Error, CheckQueued:
+			continue
+		}
+
+		if app.QueueIgnoreStalled && isActive(state) && d.isStalled(now) {
+			continue
+		}
+
+		if limit == 0 || *used < limit {
+			*used++
+			if state == Queued {
+				_ = d.fire(eventDequeue)
+			}
+
+			continue
+		}
+
+		if isActive(state) {
+			d.log.Debug().Msg("queue limit reached, pause download")
+			_ = d.fire(eventQueue)
+		}
+	}
+}
+
+// isStalled check if an active download has no transfer for a while.
+func (d *Download) isStalled(now time.Time) bool {
+	if now.Sub(time.Unix(d.activeAt.Load(), 0)) < stalledTimeout {
+		return false
+	}
+
+	if d.getState() == Uploading {
+		return d.ioUp.Status().CurRate < stalledRate
+	}
+
+	return d.ioDown.Status().CurRate < stalledRate
+}
+
+// MoveQueue change queue position of downloads.
+// Downloads are moved in order of hashes, so their relative order is kept for top and bottom.
+func (c *Client) MoveQueue(hashes []meta.Hash, action QueueAction) error {
+	hashes = lo.Uniq(hashes)
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, h := range hashes {
+		if _, ok := c.downloadMap[h]; !ok {
+			return ErrTorrentNotFound
+		}
+	}
+
+	switch action {
+	case QueueTop:
+		c.queue = slices.DeleteFunc(c.queue, func(h meta.Hash) bool { return slices.Contains(hashes, h) })
+		c.queue = slices.Insert(c.queue, 0, hashes...)
+	case QueueBottom:
+		c.queue = slices.DeleteFunc(c.queue, func(h meta.Hash) bool { return slices.Contains(hashes, h) })
+		c.queue = append(c.queue, hashes...)
+	case QueueUp:
+		for i := 1; i < len(c.queue); i++ {
+			if slices.Contains(hashes, c.queue[i]) && !slices.Contains(hashes, c.queue[i-1]) {
+				c.queue[i], c.queue[i-1] = c.queue[i-1], c.queue[i]
+			}
+		}
+	case QueueDown:
+		for i := len(c.queue) - 2; i >= 0; i-- {
+			if slices.Contains(hashes, c.queue[i]) && !slices.Contains(hashes, c.queue[i+1]) {
+				c.queue[i], c.queue[i+1] = c.queue[i+1], c.queue[i]
+			}
+		}
+	default:
+		return fmt.Errorf("unknown queue action %q", action)
+	}
+
+	c.updateQueuePosition()
+	c.notifyQueue()
+
+	return nil
+}
+
+// updateQueuePosition must be called with c.m locked.
+func (c *Client) updateQueuePosition() {
+	for i, h := range c.queue {
+		c.downloadMap[h].queuePosition.Store(int64(i))
+	}
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/config"
+	"tyr/internal/meta"
+)
+
+func newTestQueue(t *testing.T, n int) (*Client, []meta.Hash) {
+	t.Helper()
+
+	c := New(config.Config{App: config.Application{MaxActiveDownloads: 2}}, t.TempDir())
+
+	var hashes []meta.Hash
+	for i := 0; i < n; i++ {
+		h := meta.Hash{byte(i + 1)}
+		d := c.NewDownload(&metainfo.MetaInfo{}, meta.Info{Hash: h, Name: h.Hex()}, t.TempDir(), nil)
+		d.state = Queued
+
+		c.downloadMap[h] = d
+		c.downloads = append(c.downloads, d)
+		c.queue = append(c.queue, h)
+		hashes = append(hashes, h)
+	}
+
+	c.updateQueuePosition()
+
+	return c, hashes
+}
+
+func queueStates(c *Client) []State {
+	var r []State
+	for _, h := range c.queue {
+		r = append(r, c.downloadMap[h].getState())
+	}
+
+	return r
+}
+
+func TestProcessQueue(t *testing.T) {
+	c, hashes := newTestQueue(t, 3)
+
+	c.processQueue()
+	require.Equal(t, []State{FetchingMetadata, FetchingMetadata, Queued}, queueStates(c))
+
+	require.NoError(t, c.MoveQueue([]meta.Hash{hashes[2]}, QueueTop))
+	require.Equal(t, []meta.Hash{hashes[2], hashes[0], hashes[1]}, c.queue)
+
+	c.processQueue()
+	require.Equal(t, []State{FetchingMetadata, FetchingMetadata, Queued}, queueStates(c))
+	require.Equal(t, Queued, c.downloadMap[hashes[1]].getState(), "download beyond limit should be queued")
+
+	require.NoError(t, c.downloadMap[hashes[2]].Stop())
+	c.processQueue()
+	require.Equal(t, []State{Stopped, FetchingMetadata, FetchingMetadata}, queueStates(c))
+}
+
+func TestMoveQueue(t *testing.T) {
+	c, h := newTestQueue(t, 4)
+
+	require.NoError(t, c.MoveQueue([]meta.Hash{h[2], h[3]}, QueueUp))
+	require.Equal(t, []meta.Hash{h[0], h[2], h[3], h[1]}, c.queue)
+
+	require.NoError(t, c.MoveQueue([]meta.Hash{h[0], h[2]}, QueueDown))
+	require.Equal(t, []meta.Hash{h[3], h[0], h[2], h[1]}, c.queue)
+
+	require.NoError(t, c.MoveQueue([]meta.Hash{h[3]}, QueueBottom))
+	require.Equal(t, []meta.Hash{h[0], h[2], h[1], h[3]}, c.queue)
+
+	require.EqualValues(t, 1, c.downloadMap[h[2]].queuePosition.Load())
+
+	require.ErrorIs(t, c.MoveQueue([]meta.Hash{{0xff}}, QueueTop), ErrTorrentNotFound)
+	require.Error(t, c.MoveQueue([]meta.Hash{h[0]}, "left"))
+}
@@ -1,17 +1,29 @@
 package core
 
 import (
+	"context"
+	"fmt"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/anacrolix/torrent/bencode"
-	"github.com/samber/lo"
+	"github.com/rs/zerolog/log"
+	"github.com/sourcegraph/conc/pool"
+	"github.com/trim21/errgo"
 
 	"tyr/internal/meta"
 	"tyr/internal/pkg/null"
 )
 
+const scrapeInterval = time.Minute * 15
+
+// some trackers and proxies refuse url longer than 2048
+const maxScrapeURLLength = 2000
+
 type scrapeResponse struct {
-	Files map[string]scrapeResponseFile `bencode:"files"`
+	Files         map[string]scrapeResponseFile `bencode:"files"`
+	FailureReason null.String                   `bencode:"failure reason"`
 }
 
 type scrapeResponseFile struct {
@@ -21,17 +33,53 @@ type scrapeResponseFile struct {
 	Incomplete    int         `bencode:"incomplete"`
 }
 
-//var p = pool.New(func() map[string][]metainfo.Hash {
-//	// 1000 url length limit / 70 per info_hash
-//	return make(map[string][]metainfo.Hash, 20)
-//})
+type scrapeTarget struct {
+	t    *Tracker
+	hash meta.Hash
+}
 
-func (c *Client) scrape() {
-	r := c.http.R()
+// scrapeURL convert announce url to scrape url, return empty string if tracker doesn't support scrape.
+// https://www.bittorrent.org/beps/bep_0048.html
+func scrapeURL(announce string) string {
+	u, err := url.Parse(announce)
+	if err != nil {
+		return ""
+	}
 
-	var m = make(map[string][]meta.Hash, 20)
-	//defer p.Put(m)
-	//clear(m)
+	// udp tracker use same url
+	if u.Scheme == "udp" {
+		return announce
+	}
+
+	i := strings.LastIndexByte(u.Path, '/')
+	if i < 0 || !strings.HasPrefix(u.Path[i+1:], "announce") {
+		return ""
+	}
+
+	u.Path = u.Path[:i+1] + "scrape" + u.Path[i+1+len("announce"):]
+	u.RawPath = ""
+
+	return u.String()
+}
+
+func (c *Client) backgroundScrape() {
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-timer.C:
+			c.scrape()
+			timer.Reset(scrapeInterval)
+		}
+	}
+}
+
+// scrape request all trackers of active torrents, info hashes are batched by scrape url.
+func (c *Client) scrape() {
+	var m = make(map[string][]scrapeTarget, 20)
 
 	c.m.RLock()
 	for h, d := range c.downloadMap {
@@ -40,18 +88,105 @@ func (c *Client) scrape() {
 			d.m.RUnlock()
 			continue
 		}
-		m[d.ScrapeUrl()] = append(m[d.ScrapeUrl()], h)
 		d.m.RUnlock()
-	}
 
+		for _, tier := range d.trackers {
+			for _, t := range tier.trackers {
+				if u := t.ScrapeUrl(); u != "" {
+					m[u] = append(m[u], scrapeTarget{t: t, hash: h})
+				}
+			}
+		}
+	}
 	c.m.RUnlock()
-	r.QueryParam = url.Values{"info_hash": []string{}}
+
+	p := pool.New().WithMaxGoroutines(5)
+
+	for u, targets := range m {
+		p.Go(func() {
+			var err error
+			if isUDPTracker(u) {
+				err = c.scrapeUDP(u, targets)
+			} else {
+				err = c.scrapeHTTP(u, targets)
+			}
+
+			if err != nil {
+				log.Debug().Err(err).Str("url", u).Msg("failed to scrape tracker")
+			}
+		})
+	}
+
+	p.Wait()
 }
 
-func init() {
-	var s scrapeResponse
+func (c *Client) scrapeHTTP(u string, targets []scrapeTarget) error {
+	for len(targets) != 0 {
+		var values = url.Values{}
+		var length = len(u)
+		var n int
+
+		for n < len(targets) {
+			param := url.QueryEscape(targets[n].hash.AsString())
+			if n != 0 && length+len("&info_hash=")+len(param) > maxScrapeURLLength {
+				break
+			}
+
+			length += len("&info_hash=") + len(param)
+			values.Add("info_hash", targets[n].hash.AsString())
+			n++
+		}
+
+		batch := targets[:n]
+		targets = targets[n:]
+
+		req := c.http.R()
+		req.QueryParam = values
+
+		res, err := req.Get(u)
+		if err != nil {
+			return errgo.Wrap(err, "failed to connect to tracker")
+		}
+
+		var r scrapeResponse
+		if err = bencode.Unmarshal(res.Body(), &r); err != nil {
+			return errgo.Wrap(err, "failed to parse tracker scrape response")
+		}
+
+		if r.FailureReason.Set {
+			return fmt.Errorf("tracker refuse scrape request: %s", r.FailureReason.Value)
+		}
+
+		for _, target := range batch {
+			f, ok := r.Files[target.hash.AsString()]
+			if !ok || f.FailureReason.Set {
+				continue
+			}
+
+			target.t.setScrape(f.Complete, f.Incomplete, f.Downloaded)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) scrapeUDP(u string, targets []scrapeTarget) error {
+	ctx, cancel := context.WithTimeout(c.ctx, time.Minute*2)
+	defer cancel()
+
+	var hashes = make([][20]byte, len(targets))
+	for i, target := range targets {
+		hashes[i] = target.hash
+	}
+
+	results, err := c.udpTracker.Scrape(ctx, u, hashes)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range results {
+		targets[i].t.setScrape(int(r.Seeders), int(r.Leechers), int(r.Completed))
+	}
 
-	lo.Must0(bencode.Unmarshal([]byte("d5:filesd30:\xc2\xbd\xc2\x89<\xc2\x9bH\xc2\xb5\xc2\x95}\xc2\xb5\x18\x0es'\xc2\x90\xc2\xb5\xc2\xbe.\xc2\xa2\x14:d8:completei972e10:downloadedi2811e10:incompletei2eeee"), &s))
-	//fmt.Println(err)
-	//spew.Dump(s)
+	return nil
 }
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/config"
+	"tyr/internal/meta"
+)
+
+func TestScrapeURL(t *testing.T) {
+	testCases := []struct {
+		announce string
+		expected string
+	}{
+		{announce: "http://example.com/announce", expected: "http://example.com/scrape"},
+		{announce: "http://example.com/x/announce", expected: "http://example.com/x/scrape"},
+		{announce: "http://example.com/announce.php", expected: "http://example.com/scrape.php"},
+		{announce: "http://example.com/announce?passkey=abc", expected: "http://example.com/scrape?passkey=abc"},
+		{announce: "https://example.com/x/announce%20b", expected: "https://example.com/x/scrape%20b"},
+		{announce: "http://example.com/a", expected: ""},
+		{announce: "http://example.com/announce/x", expected: ""},
+		{announce: "http://example.com", expected: ""},
+		{announce: "udp://tracker.example.com:80", expected: "udp://tracker.example.com:80"},
+		{announce: "udp://tracker.example.com:80/announce", expected: "udp://tracker.example.com:80/announce"},
+		{announce: "://bad", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.announce, func(t *testing.T) {
+			require.Equal(t, tc.expected, scrapeURL(tc.announce))
+		})
+	}
+}
+
+func TestScrapeHTTPBatch(t *testing.T) {
+	var m sync.Mutex
+	var requests int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		requests++
+		m.Unlock()
+
+		if len("http://"+r.Host+r.URL.RequestURI()) > maxScrapeURLLength {
+			w.WriteHeader(http.StatusRequestURITooLong)
+			return
+		}
+
+		var files = make(map[string]any)
+		for _, h := range r.URL.Query()["info_hash"] {
+			files[h] = map[string]int{"complete": int(h[0]), "incomplete": 1, "downloaded": 2}
+		}
+
+		b, err := bencode.Marshal(map[string]any{"files": files})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = w.Write(b)
+	}))
+	defer srv.Close()
+
+	c := New(config.Config{}, t.TempDir())
+
+	var targets []scrapeTarget
+	for i := 0; i < 200; i++ {
+		var h meta.Hash
+		for j := range h {
+			// bytes need url escaping make url longer
+			h[j] = byte(i + j*11)
+		}
+
+		targets = append(targets, scrapeTarget{t: &Tracker{url: srv.URL + "/announce"}, hash: h})
+	}
+
+	require.NoError(t, c.scrapeHTTP(srv.URL+"/scrape", targets))
+	require.Greater(t, requests, 1, "info hashes should be split into batches")
+
+	for _, target := range targets {
+		require.False(t, target.t.lastScrape.IsZero(), "tracker should be scraped")
+		require.Equal(t, int(target.hash[0]), target.t.seeders)
+		require.Equal(t, 1, target.t.leechers)
+		require.Equal(t, 2, target.t.completed)
+	}
+}
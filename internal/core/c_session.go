@@ -0,0 +1,163 @@
+package core
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/rs/zerolog/log"
+	"github.com/trim21/errgo"
+
+	"tyr/internal/meta"
+)
+
+func (c *Client) resumeFilePath(h meta.Hash) string {
+	name := fmt.Sprintf("%x.resume", h)
+
+	return filepath.Join(c.sessionPath, "resume", name[0:2], name)
+}
+
+func (c *Client) torrentFilePath(h meta.Hash) string {
+	return filepath.Join(c.sessionPath, "torrents", fmt.Sprintf("%x.torrent", h))
+}
+
+func (c *Client) magnetFilePath(h meta.Hash) string {
+	return filepath.Join(c.sessionPath, "torrents", fmt.Sprintf("%x.magnet", h))
+}
+
+// saveMagnetFile save magnet link of torrents without metadata,
+// it will be replaced by torrent file after metadata is fetched.
+func (c *Client) saveMagnetFile(m metainfo.Magnet) error {
+	p := c.magnetFilePath(meta.Hash(m.InfoHash))
+
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return errgo.Wrap(err, "failed to create torrents directory")
+	}
+
+	return errgo.Wrap(os.WriteFile(p, []byte(m.String()), os.ModePerm), "failed to save magnet file")
+}
+
+func (c *Client) saveTorrentFile(m *metainfo.MetaInfo, h meta.Hash) error {
+	p := c.torrentFilePath(h)
+
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return errgo.Wrap(err, "failed to create torrents directory")
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		return errgo.Wrap(err, "failed to save torrent file")
+	}
+	defer f.Close()
+
+	return errgo.Wrap(m.Write(f), "failed to save torrent file")
+}
+
+// loadSession restore downloads from session directory.
+func (c *Client) loadSession() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if err := c.loadCategories(); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(c.sessionPath, "torrents"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return errgo.Wrap(err, "failed to read session directory")
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		var d *Download
+		var err error
+
+		p := filepath.Join(c.sessionPath, "torrents", entry.Name())
+		switch filepath.Ext(entry.Name()) {
+		case ".torrent":
+			d, err = c.restoreDownload(p)
+		case ".magnet":
+			d, err = c.restoreMagnet(p)
+		default:
+			continue
+		}
+
+		if err != nil {
+			log.Err(err).Str("file", entry.Name()).Msg("failed to restore download")
+			continue
+		}
+
+		if _, ok := c.downloadMap[d.info.Hash]; ok {
+			continue
+		}
+
+		c.addDownload(d)
+	}
+
+	// restore queue order of last session
+	slices.SortStableFunc(c.queue, func(a, b meta.Hash) int {
+		return cmp.Compare(c.downloadMap[a].queuePosition.Load(), c.downloadMap[b].queuePosition.Load())
+	})
+	c.updateQueuePosition()
+
+	log.Info().Msgf("restored %d torrents from session", len(c.downloads))
+
+	return nil
+}
+
+func (c *Client) restoreDownload(torrentPath string) (*Download, error) {
+	m, err := metainfo.LoadFromFile(torrentPath)
+	if err != nil {
+		return nil, errgo.Wrap(err, "failed to parse torrent file")
+	}
+
+	info, err := meta.FromTorrent(*m)
+	if err != nil {
+		return nil, errgo.Wrap(err, "failed to parse torrent info")
+	}
+
+	return c.loadResume(c.NewDownload(m, info, c.Config.App.DownloadDir, []string{}))
+}
+
+func (c *Client) restoreMagnet(magnetPath string) (*Download, error) {
+	raw, err := os.ReadFile(magnetPath)
+	if err != nil {
+		return nil, errgo.Wrap(err, "failed to read magnet file")
+	}
+
+	m, err := metainfo.ParseMagnetUri(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, errgo.Wrap(err, "failed to parse magnet file")
+	}
+
+	return c.loadResume(c.NewMagnetDownload(m, c.Config.App.DownloadDir, []string{}))
+}
+
+func (c *Client) loadResume(d *Download) (*Download, error) {
+	data, err := os.ReadFile(c.resumeFilePath(d.info.Hash))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, errgo.Wrap(err, "failed to read resume file")
+		}
+
+		// torrent added but resume data is not saved yet
+		return d, nil
+	}
+
+	if err = d.UnmarshalBinary(data); err != nil {
+		return nil, errgo.Wrap(err, "failed to parse resume file")
+	}
+
+	return d, nil
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"tyr/internal/meta"
+)
+
+// SpeedLimits is speed limit of client in bytes per second, 0 for unlimited.
+// DownloadLimit and UploadLimit are configured limits,
+// ActiveDownloadLimit and ActiveUploadLimit are limits in use, may be overridden by speed schedule.
+type SpeedLimits struct {
+	DownloadLimit       int64
+	UploadLimit         int64
+	ActiveDownloadLimit int64
+	ActiveUploadLimit   int64
+	Scheduled           bool
+}
+
+func (c *Client) SpeedLimits() SpeedLimits {
+	return SpeedLimits{
+		DownloadLimit:       c.downloadLimit.Load(),
+		UploadLimit:         c.uploadLimit.Load(),
+		ActiveDownloadLimit: c.downLimiter.Rate(),
+		ActiveUploadLimit:   c.upLimiter.Rate(),
+		Scheduled:           c.Config.App.ActiveSpeedProfile(time.Now()) != nil,
+	}
+}
+
+// SetSpeedLimits change client-wide speed limit, it's overridden by speed schedule if any profile is active.
+func (c *Client) SetSpeedLimits(download, upload int64) {
+	c.downloadLimit.Store(download)
+	c.uploadLimit.Store(upload)
+
+	c.applySpeedLimits()
+}
+
+func (c *Client) SetDownloadSpeedLimits(h meta.Hash, download, upload int64) error {
+	d, err := c.getDownload(h)
+	if err != nil {
+		return err
+	}
+
+	d.downLimiter.SetRate(download)
+	d.upLimiter.SetRate(upload)
+
+	return nil
+}
+
+// applySpeedLimits update rate of client limiters from speed schedule and configured limits.
+func (c *Client) applySpeedLimits() {
+	download := c.downloadLimit.Load()
+	upload := c.uploadLimit.Load()
+
+	if p := c.Config.App.ActiveSpeedProfile(time.Now()); p != nil {
+		download = p.DownloadLimit
+		upload = p.UploadLimit
+	}
+
+	if c.downLimiter.Rate() != download || c.upLimiter.Rate() != upload {
+		log.Info().Int64("download", download).Int64("upload", upload).Msg("change speed limit")
+		c.downLimiter.SetRate(download)
+		c.upLimiter.SetRate(upload)
+	}
+}
+
+func (c *Client) backgroundSpeedSchedule() {
+	if len(c.Config.App.SpeedSchedule) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second * 30)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.applySpeedLimits()
+		}
+	}
+}
@@ -1,27 +1,51 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/netip"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/samber/lo"
 	"github.com/trim21/errgo"
 
+	"tyr/internal/config"
+	"tyr/internal/dht"
 	"tyr/internal/mse"
 	"tyr/internal/pkg/global/tasks"
+	"tyr/internal/pkg/udpmux"
+	"tyr/internal/pkg/utp"
 	"tyr/internal/proto"
 )
 
 func (c *Client) Start() error {
+	if err := c.loadSession(); err != nil {
+		return err
+	}
+
+	if _, err := c.ReloadIPFilter(); err != nil {
+		return err
+	}
+
 	if err := c.startListen(); err != nil {
 		return err
 	}
 
+	if err := c.startUDP(); err != nil {
+		return err
+	}
+
 	go c.ch.Start()
+	go c.handleConn()
+	go c.backgroundScrape()
+	go c.backgroundSpeedSchedule()
+	go c.backgroundQueue()
+	go c.backgroundSeedingGoal()
 
 	if log.Debug().Enabled() {
 		go func() {
@@ -77,58 +101,114 @@ func (c *Client) Start() error {
 	return nil
 }
 
+// startListen listen on TCP p2p port if tcp transport is enabled.
 func (c *Client) startListen() error {
+	if !slices.Contains(c.Config.App.Transports, config.TransportTCP) {
+		return nil
+	}
+
 	var lc net.ListenConfig
 	l, err := lc.Listen(c.ctx, "tcp", fmt.Sprintf(":%d", c.Config.App.P2PPort))
 	if err != nil {
 		return errgo.Wrap(err, "failed to listen on p2p port")
 	}
-	go func() {
-		for {
-			// it may only return timeout error, so we can ignore this
-			//_ = c.sem.Acquire(context.Background(), 1)
-			conn, err := l.Accept()
-			if err != nil {
-				c.sem.Release(1)
-				continue
-			}
 
-			if !c.sem.TryAcquire(1) {
-				_ = conn.Close()
-				continue
-			}
+	go c.serve(l)
 
-			c.connectionCount.Add(1)
-			if c.mseDisabled {
-				c.connChan <- incomingConn{
-					addr: lo.Must(netip.ParseAddrPort(conn.RemoteAddr().String())),
-					conn: conn,
-				}
-				continue
+	return nil
+}
+
+// startUDP listen on UDP p2p port, which is shared by DHT and uTP.
+func (c *Client) startUDP() error {
+	if !c.Config.App.DHT && !c.Config.App.UTPEnabled() {
+		return nil
+	}
+
+	var lc net.ListenConfig
+	conn, err := lc.ListenPacket(c.ctx, "udp4", fmt.Sprintf(":%d", c.Config.App.P2PPort))
+	if err != nil {
+		return errgo.Wrap(err, "failed to listen on udp p2p port")
+	}
+
+	c.udp = udpmux.New(conn)
+
+	var utpConn, dhtConn net.PacketConn
+	if c.Config.App.UTPEnabled() {
+		utpConn = c.udp.Route(utp.IsPacket)
+	}
+
+	if c.Config.App.DHT {
+		// DHT messages are bencode dict
+		dhtConn = c.udp.Route(func(b []byte) bool { return len(b) > 0 && b[0] == 'd' })
+	}
+
+	c.udp.Start()
+
+	if dhtConn != nil {
+		s := dht.New(dhtConn, dht.Config{
+			StatePath: filepath.Join(c.sessionPath, "dht.dat"),
+			Bootstrap: dht.DefaultBootstrap,
+		})
+
+		s.Start()
+		c.dht.Store(s)
+	}
+
+	if utpConn != nil {
+		s := utp.NewSocket(utpConn)
+		c.utp.Store(s)
+		go c.serve(s)
+	}
+
+	return nil
+}
+
+// serve accept incoming peer connections from TCP listener or uTP socket.
+func (c *Client) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
 			}
 
-			// handle mse
-			go func() {
-				c.m.RLock()
-				keys := c.infoHashes
-				c.m.RUnlock()
+			continue
+		}
 
-				rwc, err := mse.NewAccept(conn, keys, c.mseSelector)
-				if err != nil {
-					c.sem.Release(1)
-					c.connectionCount.Sub(1)
-					_ = conn.Close()
-					return
-				}
+		if !c.sem.TryAcquire(1) {
+			_ = conn.Close()
+			continue
+		}
 
-				c.connChan <- incomingConn{
-					addr: lo.Must(netip.ParseAddrPort(conn.RemoteAddr().String())),
-					conn: rwc,
-				}
-			}()
+		c.connectionCount.Add(1)
+		if c.mseDisabled {
+			c.connChan <- incomingConn{
+				addr: lo.Must(netip.ParseAddrPort(conn.RemoteAddr().String())),
+				conn: conn,
+			}
+			continue
 		}
-	}()
-	return nil
+
+		// handle mse
+		go func() {
+			c.m.RLock()
+			keys := c.infoHashes
+			c.m.RUnlock()
+
+			rwc, err := mse.NewAccept(conn, keys, c.mseSelector)
+			if err != nil {
+				c.sem.Release(1)
+				c.connectionCount.Sub(1)
+				_ = conn.Close()
+				return
+			}
+
+			c.connChan <- incomingConn{
+				addr: lo.Must(netip.ParseAddrPort(conn.RemoteAddr().String())),
+				conn: rwc,
+			}
+		}()
+	}
 }
 
 func (c *Client) handleConn() {
@@ -149,9 +229,9 @@ func (c *Client) handleConn() {
 				log.Debug().Stringer("info_hash", h.InfoHash).Msg("incoming connection")
 
 				c.m.RLock()
-				defer c.m.RUnlock()
+				d, ok := c.peerHashes[h.InfoHash]
+				c.m.RUnlock()
 
-				d, ok := c.downloadMap[h.InfoHash]
 				if !ok {
 					c.sem.Release(1)
 					c.connectionCount.Sub(1)
@@ -159,6 +239,15 @@ func (c *Client) handleConn() {
 					return
 				}
 
+				// checked after handshake, so blocked connections are counted for the torrent
+				if c.isBlocked(conn.addr.Addr()) {
+					d.blocked.Inc()
+					c.sem.Release(1)
+					c.connectionCount.Sub(1)
+					_ = conn.conn.Close()
+					return
+				}
+
 				d.AddConn(conn.addr, conn.conn, h)
 			})
 		}
@@ -1,7 +1,6 @@
 package core
 
 import (
-	"fmt"
 	"os"
 	"path/filepath"
 
@@ -18,6 +17,20 @@ func (c *Client) Shutdown() {
 
 	c.saveSession()
 
+	if s := c.dht.Load(); s != nil {
+		if err := s.Close(); err != nil {
+			log.Err(err).Msg("failed to close dht")
+		}
+	}
+
+	if s := c.utp.Load(); s != nil {
+		_ = s.Close()
+	}
+
+	if c.udp != nil {
+		_ = c.udp.Close()
+	}
+
 	c.cancel()
 }
 
@@ -29,28 +42,28 @@ func (c *Client) saveSession() *panics.Recovered {
 			d.m.Lock()
 			defer d.m.Unlock()
 
-			b, err := d.MarshalBinary()
-			if err != nil {
+			if err := c.saveResume(d); err != nil {
 				log.Err(err).Msg("failed to save download")
-				return
 			}
+		})
+	}
 
-			name := fmt.Sprintf("%x.resume", d.info.Hash)
+	return w.WaitAndRecover()
+}
 
-			dirPath := filepath.Join(c.sessionPath, "resume", name[0:2])
+// saveResume write resume data of download to session, must be called with d.m locked.
+func (c *Client) saveResume(d *Download) error {
+	b, err := d.MarshalBinary()
+	if err != nil {
+		return err
+	}
 
-			err = os.MkdirAll(dirPath, os.ModePerm)
-			if err != nil {
-				log.Err(err).Msg("failed to save download")
-				return
-			}
+	p := c.resumeFilePath(d.info.Hash)
 
-			err = os.WriteFile(filepath.Join(dirPath, name), b, os.ModePerm)
-			if err != nil {
-				log.Err(err).Msg("failed to save download")
-			}
-		})
+	err = os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err != nil {
+		return err
 	}
 
-	return w.WaitAndRecover()
+	return os.WriteFile(p, b, os.ModePerm)
 }
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+
+	"tyr/internal/meta"
+)
+
+var errEmptyTag = errors.New("tag can't be empty")
+
+// TagCount is a tag and how many torrents have it.
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+func (c *Client) AddTags(h meta.Hash, tags []string) error {
+	if slices.Contains(tags, "") {
+		return errEmptyTag
+	}
+
+	d, err := c.getDownload(h)
+	if err != nil {
+		return err
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	for _, tag := range tags {
+		if !slices.Contains(d.tags, tag) {
+			d.tags = append(d.tags, tag)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) RemoveTags(h meta.Hash, tags []string) error {
+	d, err := c.getDownload(h)
+	if err != nil {
+		return err
+	}
+
+	d.m.Lock()
+	d.tags = slices.DeleteFunc(d.tags, func(tag string) bool { return slices.Contains(tags, tag) })
+	d.m.Unlock()
+
+	return nil
+}
+
+// RenameTag rename tag of all torrents, tag is merged if torrent already has new tag.
+func (c *Client) RenameTag(from, to string) error {
+	if to == "" {
+		return errEmptyTag
+	}
+
+	if from == to {
+		return nil
+	}
+
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	for _, d := range c.downloads {
+		d.m.Lock()
+		if i := slices.Index(d.tags, from); i != -1 {
+			if slices.Contains(d.tags, to) {
+				d.tags = slices.Delete(d.tags, i, i+1)
+			} else {
+				d.tags[i] = to
+			}
+		}
+		d.m.Unlock()
+	}
+
+	return nil
+}
+
+// ListTags return all tags used by torrents, sorted by name.
+func (c *Client) ListTags() []TagCount {
+	var counts = make(map[string]int)
+
+	c.m.RLock()
+	for _, d := range c.downloads {
+		d.m.RLock()
+		for _, tag := range d.tags {
+			counts[tag]++
+		}
+		d.m.RUnlock()
+	}
+	c.m.RUnlock()
+
+	var r = make([]TagCount, 0, len(counts))
+	for name, count := range counts {
+		r = append(r, TagCount{Name: name, Count: count})
+	}
+
+	slices.SortFunc(r, func(a, b TagCount) int { return cmp.Compare(a.Name, b.Name) })
+
+	return r
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/config"
+)
+
+func TestTags(t *testing.T) {
+	c, h := newTestQueue(t, 2)
+
+	require.NoError(t, c.AddTags(h[0], []string{"a", "b"}))
+	require.NoError(t, c.AddTags(h[1], []string{"b", "b"}))
+	require.Error(t, c.AddTags(h[1], []string{""}))
+	require.Equal(t, []TagCount{{Name: "a", Count: 1}, {Name: "b", Count: 2}}, c.ListTags())
+
+	require.NoError(t, c.RenameTag("a", "b"))
+	require.Equal(t, []string{"b"}, c.downloadMap[h[0]].tags, "renamed tag should be merged")
+
+	require.NoError(t, c.RenameTag("b", "c"))
+	require.NoError(t, c.RemoveTags(h[1], []string{"c"}))
+	require.Equal(t, []TagCount{{Name: "c", Count: 1}}, c.ListTags())
+}
+
+func TestCategories(t *testing.T) {
+	dir := t.TempDir()
+	c := New(config.Config{}, dir)
+
+	require.NoError(t, c.SetCategory("movie", "/data/movie"))
+	require.NoError(t, c.SetCategory("tv", ""))
+	require.Error(t, c.SetCategory("", ""))
+
+	c = New(config.Config{}, dir)
+	require.NoError(t, c.loadSession())
+	require.Equal(t, []Category{{Name: "movie", SavePath: "/data/movie"}, {Name: "tv"}}, c.ListCategories())
+
+	require.NoError(t, c.RemoveCategory("tv"))
+	require.Error(t, c.RemoveCategory("tv"))
+}
+
+func TestSetTorrentCategory(t *testing.T) {
+	d, data := newTestDownload(t)
+	c := d.c
+
+	c.downloadMap[d.info.Hash] = d
+	c.downloads = append(c.downloads, d)
+
+	for i := range d.info.NumPieces {
+		writeTestPiece(t, d, data, i)
+	}
+	d.state = Stopped
+
+	target := t.TempDir()
+	require.NoError(t, c.SetCategory("movie", target))
+	require.Error(t, c.SetTorrentCategory(d.info.Hash, "tv"))
+
+	require.NoError(t, c.SetTorrentCategory(d.info.Hash, "movie"))
+	require.Equal(t, "movie", d.Status().Category)
+	require.Equal(t, filepath.Join(target, d.info.Name), d.Status().DownloadDir)
+
+	_, err := os.Stat(filepath.Join(target, d.info.Name, d.info.Files[0].Path))
+	require.NoError(t, err)
+
+	require.NoError(t, c.RemoveCategory("movie"))
+	require.Empty(t, d.Status().Category)
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/trim21/errgo"
+
+	"tyr/internal/config"
+	"tyr/internal/pkg/global"
+)
+
+const connectTimeout = time.Second * 10
+
+// transport dial outgoing peer connection.
+type transport interface {
+	name() string
+	dial(ctx context.Context, addr netip.AddrPort) (net.Conn, error)
+}
+
+type tcpTransport struct{}
+
+func (tcpTransport) name() string {
+	return config.TransportTCP
+}
+
+func (tcpTransport) dial(ctx context.Context, addr netip.AddrPort) (net.Conn, error) {
+	return global.Dialer.DialContext(ctx, "tcp", addr.String())
+}
+
+type utpTransport struct {
+	c *Client
+}
+
+func (utpTransport) name() string {
+	return config.TransportUTP
+}
+
+func (t utpTransport) dial(ctx context.Context, addr netip.AddrPort) (net.Conn, error) {
+	s := t.c.utp.Load()
+	if s == nil {
+		return nil, errors.New("utp socket is not started")
+	}
+
+	conn, err := s.DialContext(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// transports return enabled transports in preference order.
+func (c *Client) transports() []transport {
+	var transports = make([]transport, 0, len(c.Config.App.Transports))
+
+	for _, name := range c.Config.App.Transports {
+		switch name {
+		case config.TransportTCP:
+			transports = append(transports, tcpTransport{})
+		case config.TransportUTP:
+			if c.utp.Load() != nil {
+				transports = append(transports, utpTransport{c: c})
+			}
+		}
+	}
+
+	if len(transports) == 0 {
+		transports = append(transports, tcpTransport{})
+	}
+
+	return transports
+}
+
+// dialPeer try transports in preference order, each transport get an equal share of connect timeout.
+func (c *Client) dialPeer(addr netip.AddrPort) (net.Conn, error) {
+	transports := c.transports()
+
+	var errs = make([]error, 0, len(transports))
+	for _, t := range transports {
+		ctx, cancel := context.WithTimeout(context.Background(), connectTimeout/time.Duration(len(transports)))
+		conn, err := t.dial(ctx, addr)
+		cancel()
+
+		if err == nil {
+			return conn, nil
+		}
+
+		errs = append(errs, errgo.Wrap(err, t.name()))
+	}
+
+	return nil, errors.Join(errs...)
+}
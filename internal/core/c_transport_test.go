@@ -0,0 +1,47 @@
+package core
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/config"
+	"tyr/internal/pkg/utp"
+)
+
+func newTestUTPSocket(t *testing.T) *utp.Socket {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := utp.NewSocket(pc)
+	t.Cleanup(func() { _ = s.Close() })
+
+	return s
+}
+
+func TestDialPeerFallback(t *testing.T) {
+	c := New(config.Config{App: config.Application{
+		Transports: []string{config.TransportTCP, config.TransportUTP},
+	}}, t.TempDir())
+
+	// peer only accept uTP connection
+	peer := newTestUTPSocket(t)
+	addr := netip.MustParseAddrPort(peer.Addr().String())
+
+	_, err := c.dialPeer(addr)
+	require.Error(t, err, "uTP socket is not started, only tcp should be tried")
+
+	c.utp.Store(newTestUTPSocket(t))
+	require.Len(t, c.transports(), 2)
+
+	conn, err := c.dialPeer(addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.IsType(t, &utp.Conn{}, conn)
+	require.Equal(t, addr.String(), conn.RemoteAddr().String())
+}
@@ -7,6 +7,7 @@ import (
 	"math"
 	"net/netip"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -21,7 +22,9 @@ import (
 	"go.uber.org/atomic"
 
 	"tyr/internal/meta"
+	"tyr/internal/pkg/bandwidth"
 	"tyr/internal/pkg/bm"
+	"tyr/internal/pkg/empty"
 	"tyr/internal/pkg/flowrate"
 	"tyr/internal/pkg/global"
 	"tyr/internal/pkg/heap"
@@ -38,6 +41,13 @@ const Uploading State = 2
 const Checking State = 3
 const Moving State = 4
 const Error State = 5
+const FetchingMetadata State = 6
+
+// CheckQueued is waiting for a checking slot.
+const CheckQueued State = 7
+
+// Queued is waiting for a downloading or seeding slot.
+const Queued State = 8
 
 // Download manage a download task
 // ctx should be canceled when torrent is removed, not stopped.
@@ -45,46 +55,81 @@ type Download struct {
 	log               zerolog.Logger
 	ctx               context.Context
 	err               error
-	reqHistory        *xsync.MapOf[uint32, downloadReq]
+	reqHistory        *xsync.MapOf[proto.ChunkRequest, downloadReq]
+	hashReqHistory    *xsync.MapOf[proto.HashesRequest, time.Time]
+	webSeedPieces     *xsync.MapOf[uint32, empty.Empty]
 	cancel            context.CancelFunc
 	cond              *sync.Cond
 	c                 *Client
 	ioDown            *flowrate.Monitor
 	ioUp              *flowrate.Monitor
-	ResChan           chan proto.ChunkResponse
+	downLimiter       *bandwidth.Limiter
+	upLimiter         *bandwidth.Limiter
+	ResChan           chan peerChunk
 	conn              *xsync.MapOf[netip.AddrPort, *Peer]
 	connectionHistory *xsync.MapOf[netip.AddrPort, connHistory]
 	bm                *bm.Bitmap
-	pieceData         map[uint32][]*proto.ChunkResponse
+	wanted            *bm.Bitmap
+	pieceData         map[uint32][]*peerChunk
+	corruptedBlocks   map[uint32][]corruptedBlock
+	streams           map[*FileReader]pieceRange
+	streamFiles       map[int]int // count of stream readers of skipped files
+	pieceNotify       chan empty.Empty
 	peers             *heap.Heap[peerWithPriority]
 	fileOpenMutex     *sync.Cond
 	fileOpenCache     map[int]*fileOpenCache
 	basePath          string
 	key               string
 	downloadDir       string
+	category          string
 	tags              []string
+	filePriority      []FilePriority
+	piecePriority     []FilePriority
 	pieceInfo         []pieceFileChunks
+	piecesV2          []meta.HashV2
+	infoBytes         []byte
+	metadataPieces    [][]byte
+	resume            *resume
+	seedingLimits     *SeedingLimits
 	trackers          []TrackerTier
+	webSeeds          []*webSeed
 	info              meta.Info
 	AddAt             int64
+	metadataSize      int
 	CompletedAt       atomic.Int64
+	activeAt          atomic.Int64
+	queuePosition     atomic.Int64
+	seedingTime       atomic.Int64
+	blocked           atomic.Int64
+	lastUploadAt      atomic.Int64
 	downloaded        atomic.Int64
 	corrupted         atomic.Int64
-	done              atomic.Bool
 	uploaded          atomic.Int64
-	completed         atomic.Int64
 	checkProgress     atomic.Int64
 	uploadAtStart     int64
 	downloadAtStart   int64
 	lazyInitialized   atomic.Bool
 	seq               atomic.Bool
+	// bitmap is checked with torrent data, it is not reliable before checking is done
+	verified          atomic.Bool
+	endgame           atomic.Bool
 	announcePending   atomic.Bool
+	piecesLayersSaved atomic.Bool
 	m                 sync.RWMutex
 	pdMutex           sync.RWMutex
 	connMutex         sync.RWMutex
+	taskMutex         sync.RWMutex
+	taskWG            sync.WaitGroup
 	peersMutex        sync.Mutex
+	metadataMutex     sync.Mutex
+	priorityMutex     sync.RWMutex
+	hashMutex         sync.RWMutex
+	streamMutex       sync.Mutex
+	optimisticUnchoke netip.AddrPort
 	peerID            PeerID
 	state             State
+	beforeMove        State
+	stopAfterCheck    bool
 	private           bool
 }
 
@@ -114,25 +159,31 @@ func (c *Client) NewDownload(m *metainfo.MetaInfo, info meta.Info, basePath stri
 	ctx, cancel := context.WithCancel(context.Background())
 
 	d := &Download{
-		ctx:      ctx,
-		info:     info,
-		cancel:   cancel,
-		c:        c,
-		log:      log.With().Stringer("info_hash", info.Hash).Logger(),
-		state:    Checking,
-		peerID:   NewPeerID(),
-		tags:     tags,
-		basePath: basePath,
-
-		reqHistory: xsync.NewMapOf[uint32, downloadReq](),
+		ctx:       ctx,
+		info:      info,
+		infoBytes: m.InfoBytes,
+		cancel:    cancel,
+		c:         c,
+		log:       log.With().Stringer("info_hash", info.Hash).Logger(),
+		state:     Checking,
+		peerID:    NewPeerID(),
+		tags:      tags,
+		basePath:  basePath,
+
+		reqHistory:     xsync.NewMapOf[proto.ChunkRequest, downloadReq](),
+		hashReqHistory: xsync.NewMapOf[proto.HashesRequest, time.Time](),
+		webSeedPieces:  xsync.NewMapOf[uint32, empty.Empty](),
 
 		AddAt: time.Now().Unix(),
 
-		ResChan: make(chan proto.ChunkResponse, 1),
+		ResChan: make(chan peerChunk, 1),
 
 		ioDown: flowrate.New(time.Second, time.Second),
 		ioUp:   flowrate.New(time.Second, time.Second),
 
+		downLimiter: bandwidth.New(0),
+		upLimiter:   bandwidth.New(0),
+
 		conn:              xsync.NewMapOf[netip.AddrPort, *Peer](),
 		connectionHistory: xsync.NewMapOf[netip.AddrPort, connHistory](),
 
@@ -140,7 +191,14 @@ func (c *Client) NewDownload(m *metainfo.MetaInfo, info meta.Info, basePath stri
 
 		// will use about 1mb per torrent, can be optimized later
 		pieceInfo: buildPieceInfos(info),
-		pieceData: make(map[uint32][]*proto.ChunkResponse, 20),
+		piecesV2:  slices.Clone(info.PiecesV2),
+		pieceData: make(map[uint32][]*peerChunk, 20),
+
+		corruptedBlocks: make(map[uint32][]corruptedBlock),
+
+		streams:     make(map[*FileReader]pieceRange),
+		streamFiles: make(map[int]int),
+		pieceNotify: make(chan empty.Empty),
 
 		private: info.Private,
 
@@ -154,9 +212,9 @@ func (c *Client) NewDownload(m *metainfo.MetaInfo, info meta.Info, basePath stri
 	}
 
 	d.cond = sync.NewCond(&d.m)
+	d.setFilePriority(nil)
 
 	if global.Dev {
-		d.seq.Store(true)
 		d.peersMutex.Lock()
 		d.peers.Push(peerWithPriority{
 			addrPort: netip.MustParseAddrPort("192.168.1.3:50025"),
@@ -167,6 +225,7 @@ func (c *Client) NewDownload(m *metainfo.MetaInfo, info meta.Info, basePath stri
 		//	assert.LessOrEqual(piece[len(piece)-1].Length, uint32(defaultBlockSize))
 	} else {
 		d.setAnnounceList(m)
+		d.setWebSeeds(m.UrlList, info.HTTPSeeds)
 	}
 
 	d.log.Info().Msg("download created")
@@ -186,35 +245,24 @@ func (d *Download) Display() string {
 
 	rate := d.ioDown.Status()
 
-	var completed int64
+	wanted, completed := d.wantedProgress()
 
-	if !d.bm.Get(d.info.NumPieces - 1) {
-		completed = int64(d.bm.Count()) * d.info.PieceLength
-	} else {
-		completed = int64(d.bm.Count()-1)*d.info.PieceLength + d.info.LastPieceSize
-	}
+	left := wanted - completed
 
-	left := d.info.TotalLength - completed
+	var progress float64
+	if wanted != 0 {
+		progress = float64(completed*1000/wanted) / 10
+	}
 
 	var eta time.Duration
 	if rate.CurRate != 0 {
 		eta = time.Second * time.Duration(left/rate.CurRate)
 	}
 
-	if d.state == Downloading {
-		if d.info.NumPieces-d.bm.Count() < 10 {
-			for i := uint32(0); i < d.info.NumPieces; i++ {
-				if !d.bm.Get(i) {
-					fmt.Println("missing", i)
-				}
-			}
-		}
-	}
-
 	_, _ = fmt.Fprintf(buf, "%11s | %s | %6.1f%% | %8s | %8s | %10s ↓ | %5s | %d",
 		d.state,
 		d.info.Hash,
-		float64(completed*1000/d.info.TotalLength)/10,
+		progress,
 		humanize.IBytes(uint64(d.info.TotalLength)),
 		humanize.IBytes(uint64(left)),
 		rate.RateString(),
@@ -272,12 +320,11 @@ type peerDisplay struct {
 	Addr   netip.AddrPort
 }
 
-// if download encounter an error must stop downloading/uploading
-func (d *Download) setError(err error) {
-	d.m.Lock()
-	d.err = err
-	d.state = Error
-	d.m.Unlock()
+func (d *Download) isPrivate() bool {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	return d.private
 }
 
 func canonicalName(info metainfo.Info, infoHash infohash.T) string {
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const chokeInterval = time.Second * 10
+
+// optimistic unchoke rotate every 3 choke round
+const optimisticUnchokeRounds = 3
+
+// backgroundChoker run the tit-for-tat choking algorithm from BEP 3.
+func (d *Download) backgroundChoker() {
+	ticker := time.NewTicker(chokeInterval)
+	defer ticker.Stop()
+
+	var round int
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			d.m.RLock()
+			state := d.state
+			d.m.RUnlock()
+
+			if !(state == Downloading || state == Uploading) {
+				continue
+			}
+
+			d.rechoke(state == Uploading, round%optimisticUnchokeRounds == 0)
+			round++
+		}
+	}
+}
+
+type chokeCandidate struct {
+	p    *Peer
+	rate int64
+}
+
+func (d *Download) rechoke(seeding bool, rotateOptimistic bool) {
+	var interested []chokeCandidate
+	var notInterested []*Peer
+
+	d.conn.Range(func(_ netip.AddrPort, p *Peer) bool {
+		if !p.peerInterested.Load() {
+			notInterested = append(notInterested, p)
+			return true
+		}
+
+		var rate int64
+		if seeding {
+			// we don't care about peer's upload rate when seeding,
+			// prefer peers we can upload fast.
+			rate = p.ioOut.Status().CurRate
+		} else {
+			rate = p.ioIn.Status().CurRate
+		}
+
+		interested = append(interested, chokeCandidate{p: p, rate: rate})
+		return true
+	})
+
+	slices.SortFunc(interested, func(a, b chokeCandidate) int {
+		if a.rate == b.rate {
+			return 0
+		}
+
+		if a.rate > b.rate {
+			return -1
+		}
+
+		return 1
+	})
+
+	slots := int(d.c.Config.App.UnchokeSlots)
+
+	var unchoke = make(map[netip.AddrPort]*Peer, slots+1)
+	for _, c := range interested[:min(slots, len(interested))] {
+		unchoke[c.p.Address] = c.p
+	}
+
+	rest := interested[min(slots, len(interested)):]
+
+	// keep current optimistic unchoke peer if it's still connected and interested.
+	if !rotateOptimistic {
+		_, ok := lo.Find(rest, func(item chokeCandidate) bool {
+			return item.p.Address == d.optimisticUnchoke
+		})
+		if !ok {
+			rotateOptimistic = true
+		}
+	}
+
+	if rotateOptimistic {
+		d.optimisticUnchoke = netip.AddrPort{}
+		if len(rest) != 0 {
+			d.optimisticUnchoke = lo.Sample(rest).p.Address
+		}
+	}
+
+	if d.optimisticUnchoke.IsValid() {
+		if p, ok := d.conn.Load(d.optimisticUnchoke); ok {
+			unchoke[p.Address] = p
+		}
+	}
+
+	for _, c := range interested {
+		if _, ok := unchoke[c.p.Address]; ok {
+			c.p.Unchoke()
+		} else {
+			c.p.Choke()
+		}
+	}
+
+	for _, p := range notInterested {
+		p.Choke()
+	}
+}
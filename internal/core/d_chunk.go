@@ -1,7 +1,6 @@
 package core
 
 import (
-	"tyr/internal/meta"
 	"tyr/internal/proto"
 )
 
@@ -13,26 +12,17 @@ func (d *Download) pieceLength(index uint32) int64 {
 	return d.info.PieceLength
 }
 
-func pieceChunks(info meta.Info, index uint32) []proto.ChunkRequest {
-	var numPerPiece = (info.PieceLength + defaultBlockSize - 1) / defaultBlockSize
-	var rr = make([]proto.ChunkRequest, 0, numPerPiece)
+// pieceChunks return requests of piece data, pad files at the end of piece are not requested.
+func (d *Download) pieceChunks(index uint32) []proto.ChunkRequest {
+	pieceLen := d.pieceInfo[index].length
 
-	pieceStart := int64(index) * info.PieceLength
-
-	pieceLen := min(info.PieceLength, info.TotalLength-pieceStart)
-
-	for n := int64(0); n < numPerPiece; n++ {
-		begin := defaultBlockSize * int64(n)
-		length := uint32(min(pieceLen-begin, defaultBlockSize))
-
-		if length <= 0 {
-			break
-		}
+	var rr = make([]proto.ChunkRequest, 0, (pieceLen+defaultBlockSize-1)/defaultBlockSize)
 
+	for begin := int64(0); begin < pieceLen; begin += defaultBlockSize {
 		rr = append(rr, proto.ChunkRequest{
 			PieceIndex: index,
 			Begin:      uint32(begin),
-			Length:     length,
+			Length:     uint32(min(pieceLen-begin, defaultBlockSize)),
 		})
 	}
 
@@ -8,15 +8,24 @@ import (
 	"time"
 
 	"tyr/internal/mse"
-	"tyr/internal/pkg/global"
 	"tyr/internal/pkg/global/tasks"
 	"tyr/internal/proto"
 )
 
 // AddConn add an incoming connection from client listener
 func (d *Download) AddConn(addr netip.AddrPort, conn net.Conn, h proto.Handshake) {
-	//d.connMutex.Lock()
-	//defer d.connMutex.Unlock()
+	// peers are not created while metadata is applied
+	d.connMutex.RLock()
+	defer d.connMutex.RUnlock()
+
+	// download may be removed after it's found by listener
+	if d.ctx.Err() != nil {
+		d.c.sem.Release(1)
+		d.c.connectionCount.Sub(1)
+		_ = conn.Close()
+		return
+	}
+
 	d.connectionHistory.Store(addr, connHistory{})
 	d.conn.Store(addr, NewIncomingPeer(conn, d, addr, h))
 }
@@ -31,10 +40,8 @@ func (d *Download) connectToPeers() {
 
 		if item := d.c.ch.Get(pp.addrPort); item != nil {
 			ch := item.Value()
-			if ch.timeout {
-				continue
-			}
-			if ch.err != nil {
+			if ch.timeout || ch.err != nil {
+				d.peers.Pop()
 				continue
 			}
 		}
@@ -44,6 +51,12 @@ func (d *Download) connectToPeers() {
 			continue
 		}
 
+		if d.c.isBlocked(pp.addrPort.Addr()) {
+			d.blocked.Inc()
+			d.peers.Pop()
+			continue
+		}
+
 		if !d.c.sem.TryAcquire(1) {
 			break
 		}
@@ -54,14 +67,11 @@ func (d *Download) connectToPeers() {
 
 		tasks.Submit(func() {
 			ch := connHistory{lastTry: time.Now()}
-			defer func(h connHistory) {
-				d.c.ch.Set(pp.addrPort, h, time.Hour)
-			}(ch)
-
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-			defer cancel()
+			defer func() {
+				d.c.ch.Set(pp.addrPort, ch, time.Hour)
+			}()
 
-			conn, err := global.Dialer.DialContext(ctx, "tcp", pp.addrPort.String())
+			conn, err := d.c.dialPeer(pp.addrPort)
 			if err != nil {
 				if errors.Is(err, context.DeadlineExceeded) {
 					ch.timeout = true
@@ -73,20 +83,28 @@ func (d *Download) connectToPeers() {
 				return
 			}
 
-			if d.c.mseDisabled {
-				d.conn.Store(pp.addrPort, NewOutgoingPeer(conn, d, pp.addrPort))
-				return
+			if !d.c.mseDisabled {
+				conn, err = mse.NewConnection(d.infoHashes()[0].Bytes(), conn)
+				if err != nil {
+					ch.err = err
+					d.c.sem.Release(1)
+					d.c.connectionCount.Sub(1)
+					return
+				}
 			}
 
-			rwc, err := mse.NewConnection(d.info.Hash.Bytes(), conn)
-			if err != nil {
-				ch.err = err
+			// peers are not created while metadata is applied
+			d.connMutex.RLock()
+			defer d.connMutex.RUnlock()
+
+			if d.ctx.Err() != nil {
 				d.c.sem.Release(1)
 				d.c.connectionCount.Sub(1)
+				_ = conn.Close()
 				return
 			}
 
-			d.conn.Store(pp.addrPort, NewOutgoingPeer(rwc, d, pp.addrPort))
+			d.conn.Store(pp.addrPort, NewOutgoingPeer(conn, d, pp.addrPort))
 		})
 	}
 }
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"tyr/internal/dht"
+)
+
+const dhtAnnounceInterval = time.Minute * 15
+
+// backgroundDHT announce to DHT and add found peers, private torrents are skipped.
+// DHT may be started after downloads restored from session, so it's checked on each tick.
+func (d *Download) backgroundDHT() {
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+
+	var nextAnnounce time.Time
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s := d.c.dht.Load()
+		if s == nil || time.Now().Before(nextAnnounce) {
+			continue
+		}
+
+		d.m.RLock()
+		state := d.state
+		private := d.private
+		d.m.RUnlock()
+
+		if private {
+			continue
+		}
+
+		switch state {
+		case Downloading, Uploading, FetchingMetadata:
+		case Stopped, Moving, Checking, Error, CheckQueued, Queued:
+			continue
+		}
+
+		d.announceDHT(s)
+		nextAnnounce = time.Now().Add(dhtAnnounceInterval)
+	}
+}
+
+func (d *Download) announceDHT(s *dht.Server) {
+	ctx, cancel := context.WithTimeout(d.ctx, time.Minute)
+	defer cancel()
+
+	// hybrid torrent is announced with both info hashes
+	var peers []netip.AddrPort
+	for _, h := range d.infoHashes() {
+		peers = append(peers, s.Announce(ctx, h, d.c.Config.App.P2PPort)...)
+	}
+
+	d.log.Trace().Msgf("found %d peers from dht", len(peers))
+
+	if len(peers) == 0 {
+		return
+	}
+
+	d.peersMutex.Lock()
+	for _, peer := range peers {
+		d.peers.Push(peerWithPriority{
+			addrPort: peer,
+			priority: d.c.PeerPriority(peer),
+		})
+	}
+	d.peersMutex.Unlock()
+}
+
+// addDHTNode add node from PORT message to DHT routing table.
+func (c *Client) addDHTNode(addr netip.AddrPort) {
+	s := c.dht.Load()
+	if s == nil || addr.Port() == 0 {
+		return
+	}
+
+	s.AddNode(addr)
+}
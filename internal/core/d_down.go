@@ -2,12 +2,11 @@ package core
 
 import (
 	"crypto/sha1"
-	"fmt"
 	"net/netip"
-	"sort"
 	"time"
 
-	"github.com/docker/go-units"
+	"github.com/samber/lo"
+	"github.com/valyala/bytebufferpool"
 
 	"tyr/internal/pkg/global/tasks"
 	"tyr/internal/pkg/mempool"
@@ -15,8 +14,14 @@ import (
 )
 
 type downloadReq struct {
-	conn *Peer
-	r    proto.ChunkRequest
+	sentAt time.Time
+	conn   *Peer
+}
+
+// peerChunk is a chunk received from peer, peer is kept to find who sent corrupted data.
+type peerChunk struct {
+	proto.ChunkResponse
+	from netip.AddrPort
 }
 
 func (d *Download) have(index uint32) {
@@ -28,7 +33,7 @@ func (d *Download) have(index uint32) {
 	})
 }
 
-func (d *Download) handleRes(res proto.ChunkResponse) {
+func (d *Download) handleRes(res peerChunk) {
 	d.log.Trace().
 		Any("res", map[string]any{
 			"piece":  res.PieceIndex,
@@ -39,194 +44,214 @@ func (d *Download) handleRes(res proto.ChunkResponse) {
 	d.ioDown.Update(len(res.Data))
 	d.downloaded.Add(int64(len(res.Data)))
 
+	req := proto.ChunkRequest{
+		PieceIndex: res.PieceIndex,
+		Begin:      res.Begin,
+		Length:     uint32(len(res.Data)),
+	}
+
+	d.reqHistory.Delete(req)
+
+	if d.endgame.Load() {
+		d.cancelEndgame(req)
+	}
+
+	if d.bm.Get(res.PieceIndex) {
+		return
+	}
+
 	d.pdMutex.Lock()
 	defer d.pdMutex.Unlock()
 
 	chunks, ok := d.pieceData[res.PieceIndex]
 	if !ok {
-		chunks = make([]*proto.ChunkResponse, (d.pieceLength(res.PieceIndex)+defaultBlockSize-1)/defaultBlockSize)
+		chunks = make([]*peerChunk, (d.pieceInfo[res.PieceIndex].length+defaultBlockSize-1)/defaultBlockSize)
+		d.pieceData[res.PieceIndex] = chunks
 	}
 
 	pi := res.Begin / defaultBlockSize
+	if chunks[pi] != nil {
+		// duplicated response, piece may be writing to disk
+		return
+	}
+
 	chunks[pi] = &res
 
-	filled := true
-	for _, res := range chunks {
-		if res == nil {
-			filled = false
-			break
-		}
+	if !chunksFilled(chunks) {
+		return
 	}
 
-	if filled {
-		go func() {
-			err := d.writePieceToDisk(res.PieceIndex, chunks)
-			if err != nil {
-				d.setError(err)
-			}
-		}()
+	// keep filled chunks in pieceData until piece is written to disk,
+	// so piece picker won't request it again.
+	go d.task(func() {
+		err := d.writePieceToDisk(res.PieceIndex, chunks)
+		if err != nil {
+			d.setError(err)
+		}
+	})()
+}
 
-		delete(d.pieceData, res.PieceIndex)
-		return
+func chunksFilled(chunks []*peerChunk) bool {
+	for _, res := range chunks {
+		if res == nil {
+			return false
+		}
 	}
 
-	d.pieceData[res.PieceIndex] = chunks
+	return true
 }
 
-func (d *Download) writePieceToDisk(pieceIndex uint32, chunks []*proto.ChunkResponse) error {
+func (d *Download) writePieceToDisk(pieceIndex uint32, chunks []*peerChunk) error {
 	buf := mempool.Get()
 
 	for _, chunk := range chunks {
 		buf.Write(chunk.Data)
 	}
 
-	h := sha1.Sum(buf.B)
-	if h != d.info.Pieces[pieceIndex] {
+	// pad files at the end of piece are not transferred, they are all zero.
+	buf.B = append(buf.B, make([]byte, d.pieceLength(pieceIndex)-int64(buf.Len()))...)
+
+	if !d.verifyPiece(pieceIndex, buf.B) {
 		d.corrupted.Add(d.info.PieceLength)
-		fmt.Println("data mismatch", pieceIndex)
+		d.log.Debug().Msgf("piece %d data mismatch", pieceIndex)
 		mempool.Put(buf)
-		return nil
-	}
-
-	tasks.Submit(func() {
-		defer mempool.Put(buf)
-		pieces := d.pieceInfo[pieceIndex]
-		var offset int64 = 0
 
-		for _, chunk := range pieces.fileChunks {
-			f, err := d.openFileWithCache(chunk.fileIndex)
-			if err != nil {
-				d.setError(err)
-				return
-			}
-			defer f.Release()
-
-			_, err = f.File.WriteAt(buf.B[offset:offset+chunk.length], chunk.offsetOfFile)
-			if err != nil {
-				d.setError(err)
-				return
-			}
+		contributors := lo.Uniq(lo.Map(chunks, func(item *peerChunk, _ int) netip.Addr {
+			return item.from.Addr()
+		}))
 
-			offset += chunk.length
+		if len(contributors) == 1 {
+			d.c.ban(d, contributors)
 		}
 
 		d.pdMutex.Lock()
 		delete(d.pieceData, pieceIndex)
+		if len(contributors) != 1 {
+			d.recordCorruptedBlocks(pieceIndex, chunks)
+		}
 		d.pdMutex.Unlock()
 
-		d.bm.Set(pieceIndex)
-
-		d.log.Trace().Msgf("buf %d done", pieceIndex)
-		d.have(pieceIndex)
+		return nil
+	}
 
-		if d.bm.Count() == d.info.NumPieces {
-			d.m.Lock()
-			d.state = Uploading
-			d.ioDown.Reset()
-			d.m.Unlock()
-		}
-	})
+	tasks.Submit(d.task(func() {
+		d.savePiece(pieceIndex, buf)
+	}))
 
 	return nil
 }
 
-func (d *Download) backgroundReqHandle() {
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
+// savePiece write verified piece data to disk and mark it as completed, buf is returned to pool.
+func (d *Download) savePiece(pieceIndex uint32, buf *bytebufferpool.ByteBuffer) {
+	defer mempool.Put(buf)
 
-	for {
-		select {
-		case <-d.ctx.Done():
-			return
-		case <-ticker.C:
-			if d.ctx.Err() != nil {
-				return
-			}
-			d.m.Lock()
-			if d.state == Uploading {
-				d.cond.Wait()
-			}
-			d.m.Unlock()
+	d.strikeCorruptedBlocks(pieceIndex, buf.B)
 
-			//d.log.Debug().Msg("backgroundReqHandle")
+	pieces := d.pieceInfo[pieceIndex]
+	var offset int64 = 0
 
-			//weight := avaPool.Get()
-
-			//if cap(weight) < int(d.numPieces) {
-			//}
-			//var h heap.Interface[pair.Pair[uint32, uint32]]
-			//weight := make([]pair.Pair[uint32, uint32], 0, int(d.numPieces))
-
-			if d.seq.Load() {
-				d.scheduleSeq()
-				continue
-			}
+	for _, chunk := range pieces.fileChunks {
+		f, fileOffset, err := d.openChunk(chunk)
+		if err != nil {
+			d.setError(err)
+			return
+		}
+		defer f.Release()
 
-			h := make(PriorityQueue, d.info.NumPieces)
+		_, err = f.File.WriteAt(buf.B[offset:offset+chunk.length], fileOffset)
+		if err != nil {
+			d.setError(err)
+			return
+		}
 
-			for i := range h {
-				h[i].Index = uint32(i)
-			}
+		offset += chunk.length
+	}
 
-			d.conn.Range(func(key netip.AddrPort, p *Peer) bool {
-				if p.Bitmap.Count() == 0 {
-					return true
-				}
+	d.pdMutex.Lock()
+	delete(d.pieceData, pieceIndex)
+	d.pdMutex.Unlock()
 
-				p.Bitmap.Range(func(i uint32) {
-					h[i].Weight++
-				})
+	d.bm.Set(pieceIndex)
+	d.notifyPiece()
+	d.c.publish(ClientEvent{Type: EventPieceCompleted, InfoHash: d.info.Hash, Piece: pieceIndex})
 
-				return true
-			})
+	d.log.Trace().Msgf("buf %d done", pieceIndex)
+	d.have(pieceIndex)
 
-			sort.Sort(&h)
+	if d.isCompleted() {
+		_ = d.fire(eventCompleted)
+	}
+}
 
-			for i, priority := range h {
-				if i > 5 {
-					break
-				}
+// corruptedBlock is a block of corrupted piece, peer sent it can't be found until we get correct data of the piece.
+type corruptedBlock struct {
+	from   netip.Addr
+	begin  uint32
+	length uint32
+	hash   [sha1.Size]byte
+}
 
-				fmt.Println(priority.Index, priority.Weight)
-			}
-		}
-		//fmt.Println("index", v.Index)
-		//avaPool.Put(weight)
+// recordCorruptedBlocks keep hash of blocks from a corrupted piece with multiple contributors, should hold pdMutex.
+func (d *Download) recordCorruptedBlocks(pieceIndex uint32, chunks []*peerChunk) {
+	for _, chunk := range chunks {
+		d.corruptedBlocks[pieceIndex] = append(d.corruptedBlocks[pieceIndex], corruptedBlock{
+			from:   chunk.from.Addr(),
+			begin:  chunk.Begin,
+			length: uint32(len(chunk.Data)),
+			hash:   sha1.Sum(chunk.Data),
+		})
 	}
 }
 
-func (d *Download) scheduleSeq() {
-	var found int64 = 0
+// strikeCorruptedBlocks compare recorded blocks with verified piece data,
+// and strike peers sent blocks not matching it, honest peers contributed to the same piece are not struck.
+func (d *Download) strikeCorruptedBlocks(pieceIndex uint32, data []byte) {
+	d.pdMutex.Lock()
+	blocks, ok := d.corruptedBlocks[pieceIndex]
+	delete(d.corruptedBlocks, pieceIndex)
+	d.pdMutex.Unlock()
+
+	if !ok {
+		return
+	}
 
-	for index := uint32(0); index < d.info.NumPieces; index++ {
-		//for pi, chunks := range d.pieceChunks {
-		//	index := uint32(pi)
-		if d.bm.Get(index) {
-			continue
+	var offenders []netip.Addr
+	for _, b := range blocks {
+		if int(b.begin)+int(b.length) > len(data) || sha1.Sum(data[b.begin:b.begin+b.length]) != b.hash {
+			offenders = append(offenders, b.from)
 		}
+	}
 
-		chunks := pieceChunks(d.info, index)
+	if len(offenders) != 0 {
+		d.c.strike(d, lo.Uniq(offenders))
+	}
+}
 
-		send := false
-		d.conn.Range(func(addr netip.AddrPort, p *Peer) bool {
-			if !p.Bitmap.Get(index) {
-				return true
-			}
+func (d *Download) backgroundReqHandle() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
-			for _, chunk := range chunks {
-				p.Request(chunk)
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			if d.ctx.Err() != nil {
+				return
 			}
+			d.m.Lock()
+			for d.state != Downloading {
+				if d.ctx.Err() != nil {
+					d.m.Unlock()
+					return
+				}
+				d.cond.Wait()
+			}
+			d.m.Unlock()
 
-			send = true
-			return false
-		})
-
-		if send {
-			found++
-		}
-
-		if found*d.info.PieceLength >= units.GiB {
-			break
+			d.expireRequests()
+			d.requestPieceLayers()
+			d.pickPieces()
 		}
 	}
 }
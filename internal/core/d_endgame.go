@@ -0,0 +1,78 @@
+package core
+
+import (
+	"net/netip"
+
+	"tyr/internal/proto"
+)
+
+// isEndgame check if all missing chunks are already requested.
+func (d *Download) isEndgame() bool {
+	if d.isCompleted() {
+		return false
+	}
+
+	d.pdMutex.RLock()
+	defer d.pdMutex.RUnlock()
+
+	for index := uint32(0); index < d.info.NumPieces; index++ {
+		if d.bm.Get(index) || d.getPiecePriority(index) == FilePrioritySkip {
+			continue
+		}
+
+		chunks := d.pieceData[index]
+
+		for ci, req := range d.pieceChunks(index) {
+			if chunks != nil && chunks[ci] != nil {
+				continue
+			}
+
+			if _, ok := d.reqHistory.Load(req); !ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// requestEndgame send all pending requests to every peer having the piece,
+// so download won't be blocked by a single slow peer.
+func (d *Download) requestEndgame(peers []*pickerPeer) {
+	d.reqHistory.Range(func(req proto.ChunkRequest, r downloadReq) bool {
+		for _, pp := range peers {
+			if pp.free <= 0 || pp.p == r.conn {
+				continue
+			}
+
+			if !pp.p.Bitmap.Get(req.PieceIndex) {
+				continue
+			}
+
+			if pp.p.peerChoked.Load() && !pp.p.allowFast.Get(req.PieceIndex) {
+				continue
+			}
+
+			if _, rejected := pp.p.rejected.Load(req); rejected {
+				continue
+			}
+
+			if pp.p.Request(req) {
+				pp.free--
+			}
+		}
+
+		return true
+	})
+}
+
+// cancelEndgame cancel duplicated requests after chunk is received.
+func (d *Download) cancelEndgame(req proto.ChunkRequest) {
+	d.conn.Range(func(_ netip.AddrPort, p *Peer) bool {
+		if _, ok := p.requests.Load(req); ok {
+			p.Cancel(req)
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/pkg/empty"
+)
+
+func TestEndgame(t *testing.T) {
+	d, _ := newTestDownload(t)
+
+	slow := newTestSeed(t, d, "10.0.0.1:6881", 0)
+	fast := newTestSeed(t, d, "10.0.0.2:6881", 0)
+	choked := newTestSeed(t, d, "10.0.0.3:6881", 0)
+	choked.peerChoked.Store(true)
+	rejected := newTestSeed(t, d, "10.0.0.4:6881", 0)
+	missing := newTestSeed(t, d, "10.0.0.5:6881")
+
+	req := d.pieceChunks(0)[0]
+	rejected.rejected.Store(req, empty.Empty{})
+
+	require.True(t, slow.Request(req))
+	d.reqHistory.Store(req, downloadReq{conn: slow})
+
+	peers := []*pickerPeer{{p: slow, free: 1}, {p: fast, free: 1}, {p: choked, free: 1}, {p: rejected, free: 1}, {p: missing, free: 1}}
+	d.requestEndgame(peers)
+
+	for _, p := range []*Peer{slow, fast} {
+		_, ok := p.requests.Load(req)
+		require.True(t, ok, "request should be sent to %s", p.Address)
+	}
+
+	for _, p := range []*Peer{choked, rejected, missing} {
+		_, ok := p.requests.Load(req)
+		require.False(t, ok, "request should not be sent to %s", p.Address)
+	}
+
+	require.Equal(t, 1, peers[0].free, "request is not duplicated to peer already having it")
+	require.Zero(t, peers[1].free)
+
+	// chunk received from fast peer
+	fast.requests.Delete(req)
+	d.cancelEndgame(req)
+
+	_, ok := slow.requests.Load(req)
+	require.False(t, ok)
+	_, ok = slow.cancelled.Load(req)
+	require.True(t, ok, "duplicated request should be cancelled")
+	_, ok = fast.cancelled.Load(req)
+	require.False(t, ok)
+}
@@ -0,0 +1,279 @@
+package core
+
+import (
+	"crypto/sha1"
+	"math/bits"
+	"math/rand/v2"
+	"net/netip"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/anacrolix/torrent/merkle"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/trim21/errgo"
+
+	"tyr/internal/meta"
+	"tyr/internal/pkg/global/tasks"
+	"tyr/internal/proto"
+)
+
+// BEP 52 recommend to reject hash requests with more than 512 hashes.
+const maxHashesPerRequest = 512
+
+// pieceHashV2 return SHA-256 hash of piece, false if piece layer of its file is not known yet.
+func (d *Download) pieceHashV2(index uint32) (meta.HashV2, bool) {
+	d.hashMutex.RLock()
+	defer d.hashMutex.RUnlock()
+
+	if int(index) >= len(d.piecesV2) || d.piecesV2[index].Zero() {
+		return meta.HashV2{}, false
+	}
+
+	return d.piecesV2[index], true
+}
+
+// canVerify check if we have hash of piece, pieces of v2 torrent can't be verified before piece layers are received.
+func (d *Download) canVerify(index uint32) bool {
+	if d.info.HasV1() {
+		return true
+	}
+
+	_, ok := d.pieceHashV2(index)
+	return ok
+}
+
+// verifyPiece check piece data with piece hashes, both hashes of hybrid torrent are checked.
+// data is full piece, including zero bytes of pad files.
+func (d *Download) verifyPiece(index uint32, data []byte) bool {
+	h, hasV2 := d.pieceHashV2(index)
+	if !hasV2 && !d.info.HasV1() {
+		return false
+	}
+
+	if hasV2 && d.hashPieceV2(index, data) != h {
+		return false
+	}
+
+	if d.info.HasV1() && sha1.Sum(data) != d.info.Pieces[index] {
+		return false
+	}
+
+	return true
+}
+
+// hashPieceV2 compute merkle root of piece, pad files are not included.
+// Last piece of file is padded with zero leaves to piece length, unless whole file is smaller than a piece.
+func (d *Download) hashPieceV2(index uint32, data []byte) meta.HashV2 {
+	piece := d.pieceInfo[index]
+
+	h := merkle.NewHash()
+	_, _ = h.Write(data[:piece.length])
+
+	for _, chunk := range piece.fileChunks {
+		if chunk.length != 0 && d.info.Files[chunk.fileIndex].Length > d.info.PieceLength {
+			return meta.HashV2(h.SumMinLength(nil, int(d.info.PieceLength)))
+		}
+	}
+
+	return meta.HashV2(h.Sum(nil))
+}
+
+// pieceLayer return piece layer of file with pieces root, false if it's not complete.
+func (d *Download) pieceLayer(root meta.HashV2) ([]meta.HashV2, bool) {
+	index := d.info.FileByPiecesRoot(root)
+	if index < 0 || d.info.Files[index].Length <= d.info.PieceLength {
+		return nil, false
+	}
+
+	first, count := d.info.FilePieces(index)
+
+	d.hashMutex.RLock()
+	defer d.hashMutex.RUnlock()
+
+	layer := d.piecesV2[first : first+count]
+	if slices.Contains(layer, meta.HashV2{}) {
+		return nil, false
+	}
+
+	return slices.Clone(layer), true
+}
+
+// missingPieceLayers return hash requests for piece layers we don't have,
+// each request contains at most 512 hashes with uncle hashes to pieces root.
+func (d *Download) missingPieceLayers() []proto.HashesRequest {
+	if !d.info.HasV2() {
+		return nil
+	}
+
+	base := uint32(meta.PieceLayerBase(d.info.PieceLength))
+
+	d.hashMutex.RLock()
+	defer d.hashMutex.RUnlock()
+
+	var r []proto.HashesRequest
+
+	for i, f := range d.info.Files {
+		if f.Pad || f.Length <= d.info.PieceLength {
+			continue
+		}
+
+		first, count := d.info.FilePieces(i)
+
+		size := 1 << bits.Len32(count-1)
+		length := min(size, maxHashesPerRequest)
+		layers := uint32(bits.Len(uint(size)) - 1)
+
+		for index := 0; index < int(count); index += length {
+			hashes := d.piecesV2[int(first)+index : int(first)+min(index+length, int(count))]
+			if !slices.Contains(hashes, meta.HashV2{}) {
+				continue
+			}
+
+			r = append(r, proto.HashesRequest{
+				PiecesRoot:  f.PiecesRoot,
+				BaseLayer:   base,
+				Index:       uint32(index),
+				Length:      uint32(length),
+				ProofLayers: layers,
+			})
+		}
+	}
+
+	return r
+}
+
+func validHashesRange(index, length uint32) bool {
+	return length >= 2 && length <= maxHashesPerRequest && length&(length-1) == 0 && index%length == 0
+}
+
+// hashesForRequest return base layer hashes and uncle hashes for hash request from peer.
+// Only piece layer is kept, so requests of other layers can't be served.
+func (d *Download) hashesForRequest(req proto.HashesRequest) ([]meta.HashV2, bool) {
+	if !d.hasMetadata() || !d.info.HasV2() || int(req.BaseLayer) != meta.PieceLayerBase(d.info.PieceLength) {
+		return nil, false
+	}
+
+	if !validHashesRange(req.Index, req.Length) {
+		return nil, false
+	}
+
+	layer, ok := d.pieceLayer(req.PiecesRoot)
+	if !ok {
+		return nil, false
+	}
+
+	tree := meta.NewMerkleTree(layer, meta.PiecePadHash(d.info.PieceLength))
+	if int(req.Index+req.Length) > len(tree[0]) {
+		return nil, false
+	}
+
+	// proof layers are counted from base layer, uncles in requested subtree are omitted.
+	uncles := int(req.ProofLayers) - bits.Len32(req.Length) + 1
+
+	hashes := slices.Clone(tree[0][req.Index : req.Index+req.Length])
+
+	return append(hashes, tree.Proof(int(req.Index), int(req.Length), max(uncles, 0))...), true
+}
+
+// onHashes verify hashes received from peer with pieces root and save them.
+// Torrent file is updated with piece layers after all of them are received.
+func (d *Download) onHashes(res proto.HashesResponse) error {
+	d.hashReqHistory.Delete(res.HashesRequest)
+
+	if !d.hasMetadata() || !d.info.HasV2() || int(res.BaseLayer) != meta.PieceLayerBase(d.info.PieceLength) {
+		return ErrPeerSendInvalidData
+	}
+
+	index := d.info.FileByPiecesRoot(res.PiecesRoot)
+	if index < 0 || !validHashesRange(res.Index, res.Length) || len(res.Hashes) < int(res.Length) {
+		return ErrPeerSendInvalidData
+	}
+
+	hashes := res.Hashes[:res.Length]
+	if !meta.VerifyProof(res.PiecesRoot, hashes, int(res.Index), res.Hashes[res.Length:]) {
+		return errgo.Wrap(ErrPeerSendInvalidData, "hashes mismatch pieces root")
+	}
+
+	first, count := d.info.FilePieces(index)
+	if res.Index >= count {
+		return ErrPeerSendInvalidData
+	}
+
+	hashes = hashes[:min(count-res.Index, res.Length)]
+
+	d.hashMutex.Lock()
+	copy(d.piecesV2[first+res.Index:], hashes)
+	d.hashMutex.Unlock()
+
+	if len(d.missingPieceLayers()) == 0 && d.piecesLayersSaved.CompareAndSwap(false, true) {
+		tasks.Submit(d.savePieceLayers)
+	}
+
+	return nil
+}
+
+// savePieceLayers add piece layers to saved torrent file, so they don't need to be fetched again.
+func (d *Download) savePieceLayers() {
+	p := d.c.torrentFilePath(d.info.Hash)
+
+	m, err := metainfo.LoadFromFile(p)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			d.log.Warn().Err(err).Msg("failed to load torrent file")
+		}
+		return
+	}
+
+	m.PieceLayers = make(map[string]string)
+
+	for _, f := range d.info.Files {
+		layer, ok := d.pieceLayer(f.PiecesRoot)
+		if f.Pad || !ok {
+			continue
+		}
+
+		var b = make([]byte, 0, len(layer)*len(meta.HashV2{}))
+		for _, h := range layer {
+			b = append(b, h[:]...)
+		}
+
+		m.PieceLayers[string(f.PiecesRoot[:])] = string(b)
+	}
+
+	if err = d.c.saveTorrentFile(m, d.info.Hash); err != nil {
+		d.log.Warn().Err(err).Msg("failed to save piece layers")
+	}
+}
+
+// requestPieceLayers send requests of missing piece layers to random peers support v2 protocol,
+// request is sent to another peer if it's rejected or not responded in time.
+func (d *Download) requestPieceLayers() {
+	requests := d.missingPieceLayers()
+	if len(requests) == 0 {
+		return
+	}
+
+	var peers []*Peer
+	d.conn.Range(func(_ netip.AddrPort, p *Peer) bool {
+		if p.supportV2 {
+			peers = append(peers, p)
+		}
+		return true
+	})
+
+	if len(peers) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, req := range requests {
+		if sentAt, ok := d.hashReqHistory.Load(req); ok && now.Sub(sentAt) < requestTimeout {
+			continue
+		}
+
+		if peers[rand.IntN(len(peers))].RequestHashes(req) {
+			d.hashReqHistory.Store(req, now)
+		}
+	}
+}
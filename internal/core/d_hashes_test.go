@@ -0,0 +1,162 @@
+package core
+
+import (
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/merkle"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/config"
+	"tyr/internal/meta"
+	"tyr/internal/proto"
+)
+
+const testV2PieceLength = 32 * 1024
+
+// newTestV2Torrent create a v2 only torrent with piece layers, returns torrent data with pad files.
+// pieces: 0 [a], 1 [a], 2 [a, pad], 3 [b]
+func newTestV2Torrent(t *testing.T) (metainfo.MetaInfo, []byte) {
+	t.Helper()
+
+	a := make([]byte, 80*1024)
+	b := make([]byte, 10*1024)
+	_, _ = rand.Read(a)
+	_, _ = rand.Read(b)
+
+	root := func(data []byte) []byte {
+		h := merkle.NewHash()
+		_, _ = h.Write(data)
+		return h.Sum(nil)
+	}
+
+	var layer []byte
+	for start := 0; start < len(a); start += testV2PieceLength {
+		h := merkle.NewHash()
+		_, _ = h.Write(a[start:min(start+testV2PieceLength, len(a))])
+		layer = h.SumMinLength(layer, testV2PieceLength)
+	}
+
+	infoBytes, err := bencode.Marshal(map[string]any{
+		"name":         "t",
+		"piece length": testV2PieceLength,
+		"meta version": 2,
+		"file tree": map[string]any{
+			"a": map[string]any{"": map[string]any{"length": len(a), "pieces root": root(a)}},
+			"b": map[string]any{"": map[string]any{"length": len(b), "pieces root": root(b)}},
+		},
+	})
+	require.NoError(t, err)
+
+	m := metainfo.MetaInfo{InfoBytes: infoBytes, PieceLayers: map[string]string{string(root(a)): string(layer)}}
+
+	return m, append(append(a, make([]byte, 16*1024)...), b...)
+}
+
+func newTestV2Download(t *testing.T, m metainfo.MetaInfo) *Download {
+	t.Helper()
+
+	info, err := meta.FromTorrent(m)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	c := New(config.Config{}, dir)
+
+	return c.NewDownload(&m, info, filepath.Join(dir, "t"), nil)
+}
+
+func testPiece(data []byte, index uint32) []byte {
+	start := int(index) * testV2PieceLength
+	return data[start:min(start+testV2PieceLength, len(data))]
+}
+
+func TestV2PieceVerify(t *testing.T) {
+	m, data := newTestV2Torrent(t)
+	d := newTestV2Download(t, m)
+
+	require.EqualValues(t, 4, d.info.NumPieces)
+	require.Equal(t, []FilePriority{FilePriorityNormal, FilePrioritySkip, FilePriorityNormal}, d.filePriority)
+
+	// pad file is not requested
+	require.Equal(t, []proto.ChunkRequest{{PieceIndex: 2, Begin: 0, Length: 16 * 1024}}, d.pieceChunks(2))
+
+	for i := uint32(0); i < d.info.NumPieces; i++ {
+		require.True(t, d.verifyPiece(i, testPiece(data, i)), "piece %d", i)
+	}
+
+	corrupted := append([]byte{}, testPiece(data, 1)...)
+	corrupted[100]++
+	require.False(t, d.verifyPiece(1, corrupted))
+
+	piece := testPiece(data, 2)
+	require.NoError(t, d.writePieceToDisk(2, []*peerChunk{{ChunkResponse: proto.ChunkResponse{PieceIndex: 2, Data: piece[:16*1024]}}}))
+	require.Eventually(t, func() bool { return d.bm.Get(2) }, time.Second, time.Millisecond*10)
+
+	read, err := d.readPiece(2)
+	require.NoError(t, err)
+	require.Equal(t, piece, read)
+
+	_, err = os.Stat(filepath.Join(d.basePath, d.info.Files[1].Path))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	wanted, completed := d.wantedProgress()
+	require.EqualValues(t, 90*1024, wanted)
+	require.EqualValues(t, 16*1024, completed)
+}
+
+func TestV2HashRequest(t *testing.T) {
+	m, data := newTestV2Torrent(t)
+	seeder := newTestV2Download(t, m)
+
+	// metadata fetched from peers doesn't have piece layers
+	m.PieceLayers = nil
+	leecher := newTestV2Download(t, m)
+
+	require.False(t, leecher.canVerify(0))
+	require.True(t, leecher.canVerify(3), "small file is verified by pieces root")
+
+	requests := leecher.missingPieceLayers()
+	require.Equal(t, []proto.HashesRequest{{
+		PiecesRoot:  seeder.info.Files[0].PiecesRoot,
+		BaseLayer:   1,
+		Index:       0,
+		Length:      4,
+		ProofLayers: 2,
+	}}, requests)
+
+	_, ok := leecher.hashesForRequest(requests[0])
+	require.False(t, ok, "leecher doesn't have piece layer")
+
+	// request a subtree with uncle hash
+	req := proto.HashesRequest{PiecesRoot: requests[0].PiecesRoot, BaseLayer: 1, Index: 2, Length: 2, ProofLayers: 2}
+	hashes, ok := seeder.hashesForRequest(req)
+	require.True(t, ok)
+	require.Len(t, hashes, 3)
+
+	tampered := append([]meta.HashV2{}, hashes...)
+	tampered[2][0]++
+	require.ErrorIs(t, leecher.onHashes(proto.HashesResponse{HashesRequest: req, Hashes: tampered}), ErrPeerSendInvalidData)
+
+	require.NoError(t, leecher.onHashes(proto.HashesResponse{HashesRequest: req, Hashes: hashes}))
+	require.True(t, leecher.canVerify(2))
+	require.True(t, leecher.verifyPiece(2, testPiece(data, 2)))
+	require.False(t, leecher.canVerify(0))
+
+	require.NoError(t, leecher.c.saveTorrentFile(&m, leecher.info.Hash))
+
+	hashes, ok = seeder.hashesForRequest(requests[0])
+	require.True(t, ok)
+	require.NoError(t, leecher.onHashes(proto.HashesResponse{HashesRequest: requests[0], Hashes: hashes}))
+	require.Empty(t, leecher.missingPieceLayers())
+
+	// piece layers are saved to torrent file
+	require.Eventually(t, func() bool {
+		saved, err := metainfo.LoadFromFile(leecher.c.torrentFilePath(leecher.info.Hash))
+		return err == nil && len(saved.PieceLayers) == 1
+	}, time.Second, time.Millisecond*10)
+}
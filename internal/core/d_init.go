@@ -1,21 +1,18 @@
 package core
 
 import (
-	"crypto/sha1"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/docker/go-units"
 	"github.com/juju/ratelimit"
-	"github.com/negrel/assert"
 	"github.com/trim21/errgo"
 
 	"tyr/internal/meta"
 	"tyr/internal/pkg/fallocate"
-	"tyr/internal/pkg/gfs"
 	"tyr/internal/pkg/global"
 )
 
@@ -34,7 +31,9 @@ func (d *Download) initCheck() error {
 	var efs = make(map[int]*existingFile, len(d.info.Files)+1)
 	for i, tf := range d.info.Files {
 		p := tf.Path
-		f, e := tryAllocFile(i, filepath.Join(d.basePath, p), tf.Length, d.c.Config.App.Fallocate.Load())
+		// skipped files are not created
+		doAlloc := d.c.Config.App.Fallocate.Load() && d.getFilePriority(i) != FilePrioritySkip
+		f, e := tryAllocFile(i, filepath.Join(d.basePath, p), tf.Length, doAlloc)
 		if e != nil {
 			return e
 		}
@@ -43,54 +42,74 @@ func (d *Download) initCheck() error {
 		}
 	}
 
-	h := d.buildPieceToCheck(efs)
+	var partsSize int64
+	if stat, err := os.Stat(d.partsFilePath()); err == nil {
+		partsSize = stat.Size()
+	}
+
+	h := d.buildPieceToCheck(efs, partsSize)
 	if len(h) == 0 {
 		return nil
 	}
 
 	d.log.Debug().Msg("start checking")
 
-	sum := sha1.New()
-
-	var w io.Writer = sum
-
+	var bucket *ratelimit.Bucket
 	if global.Dev {
-		bucket := ratelimit.NewBucketWithQuantum(time.Second/10, units.MiB*50, units.MiB*50)
-		w = ratelimit.Writer(sum, bucket)
+		bucket = ratelimit.NewBucketWithQuantum(time.Second/10, units.MiB*50, units.MiB*50)
 	}
 
+	var buf []byte
+
 	for _, pieceIndex := range h {
-		piece := d.pieceInfo[pieceIndex]
-		for _, chunk := range piece.fileChunks {
+		if !d.canVerify(pieceIndex) {
+			continue
+		}
+
+		// pad files are all zero, they are not stored on disk.
+		buf = slices.Grow(buf[:0], int(d.pieceLength(pieceIndex)))[:d.pieceLength(pieceIndex)]
+		clear(buf)
+
+		var offset int64
+		for _, chunk := range d.pieceInfo[pieceIndex].fileChunks {
 			select {
 			case <-d.ctx.Done():
 				return d.ctx.Err()
 			default:
 			}
 
-			f, err := d.openFileWithCache(chunk.fileIndex)
+			f, fileOffset, err := d.openChunk(chunk)
 			if err != nil {
 				return errgo.Wrap(err, fmt.Sprintf("failed to open file %q", filepath.Join(d.basePath, d.info.Files[chunk.fileIndex].Path)))
 			}
 
-			_, err = d.ioDown.IO64(gfs.CopyReaderAt(w, f.File, chunk.offsetOfFile, chunk.length))
+			_, err = d.ioDown.IO(f.File.ReadAt(buf[offset:offset+chunk.length], fileOffset))
 			if err != nil {
+				defer f.Release()
 				return errgo.Wrap(err, fmt.Sprintf("failed to read file %s", f.File.Name()))
 			}
+
+			f.Release()
+
+			offset += chunk.length
 		}
 
-		if [sha1.Size]byte(sum.Sum(nil)) == d.info.Pieces[pieceIndex] {
-			d.bm.Set(pieceIndex)
+		if bucket != nil {
+			bucket.Wait(offset)
 		}
 
-		sum.Reset()
+		if d.verifyPiece(pieceIndex, buf) {
+			d.bm.Set(pieceIndex)
+		}
 	}
 
 	return nil
 }
 
-func (d *Download) buildPieceToCheck(efs map[int]*existingFile) []uint32 {
-	if len(efs) == 0 {
+// buildPieceToCheck return pieces which data exist on disk,
+// data of skipped files may exist in parts file with size partsSize.
+func (d *Download) buildPieceToCheck(efs map[int]*existingFile, partsSize int64) []uint32 {
+	if len(efs) == 0 && partsSize == 0 {
 		return nil
 	}
 
@@ -102,6 +121,10 @@ func (d *Download) buildPieceToCheck(efs map[int]*existingFile) []uint32 {
 		for _, c := range p.fileChunks {
 			ef, ok := efs[c.fileIndex]
 			if !ok {
+				if d.getFilePriority(c.fileIndex) == FilePrioritySkip && c.offset+c.length <= partsSize {
+					continue
+				}
+
 				shouldCheck = false
 				break
 			}
@@ -122,6 +145,8 @@ func (d *Download) buildPieceToCheck(efs map[int]*existingFile) []uint32 {
 
 type pieceFileChunks struct {
 	fileChunks []pieceInfoFileChunk
+	// length of piece data without pad files, pad files are always at the end of piece.
+	length int64
 }
 
 func buildPieceInfos(info meta.Info) []pieceFileChunks {
@@ -134,18 +159,28 @@ func buildPieceInfos(info meta.Info) []pieceFileChunks {
 	return p
 }
 
+// getPieceInfo return chunks of files in piece, pad files are not stored so they are excluded.
 func getPieceInfo(i uint32, info meta.Info) pieceFileChunks {
-	assert.False(info.Pieces[i] == [20]byte{})
+	var p pieceFileChunks
 
-	return pieceFileChunks{
-		fileChunks: pieceFileInfos(i, info),
+	for _, chunk := range pieceFileInfos(i, info) {
+		if info.Files[chunk.fileIndex].Pad {
+			continue
+		}
+
+		p.fileChunks = append(p.fileChunks, chunk)
+		p.length += chunk.length
 	}
+
+	return p
 }
 
 type pieceInfoFileChunk struct {
 	fileIndex    int
 	offsetOfFile int64
-	length       int64
+	// offset in whole torrent
+	offset int64
+	length int64
 }
 
 func pieceFileInfos(i uint32, info meta.Info) []pieceInfoFileChunk {
@@ -168,6 +203,7 @@ func pieceFileInfos(i uint32, info meta.Info) []pieceInfoFileChunk {
 			result = append(result, pieceInfoFileChunk{
 				fileIndex:    fileIndex,
 				offsetOfFile: currentReadStart - currentFileStart,
+				offset:       currentReadStart,
 				length:       shouldRead,
 			})
 
@@ -6,66 +6,57 @@ import (
 	"time"
 
 	"github.com/docker/go-units"
-	"github.com/dustin/go-humanize"
 
 	"tyr/internal/pkg/filepool"
+	"tyr/internal/proto"
 )
 
 const defaultBlockSize = units.KiB * 16
 
-func (d *Download) Start() {
-	d.m.Lock()
-	if d.done.Load() {
-		d.state = Uploading
-	} else {
-		d.state = Downloading
-	}
-	d.m.Unlock()
-	d.cond.Broadcast()
+func (d *Download) Start() error {
+	return d.fire(eventStart)
 }
 
-func (d *Download) Stop() {
-	d.m.Lock()
-	d.state = Stopped
-	d.m.Unlock()
-	d.cond.Broadcast()
+func (d *Download) Stop() error {
+	return d.fire(eventStop)
 }
 
-func (d *Download) Check() {
-	d.m.Lock()
-	d.state = Checking
-	d.bm.Clear()
-	d.m.Unlock()
-	d.cond.Broadcast()
+// Check rehash all pieces in background.
+func (d *Download) Check() error {
+	return d.fire(eventCheck)
+}
+
+// Resume download from error state.
+func (d *Download) Resume() error {
+	return d.fire(eventResume)
 }
 
-// Init check existing files
+// Init check existing files and start background goroutines.
 func (d *Download) Init() {
 	d.log.Debug().Msg("initializing download")
 
-	d.m.Lock()
-	d.state = Checking
-	d.m.Unlock()
-
-	err := d.initCheck()
-	if err != nil {
-		d.setError(err)
-		d.log.Err(err).Msg("failed to initCheck torrent data")
-	}
-
-	d.ioDown.Reset()
-
-	d.log.Debug().Msgf("done size %s", humanize.IBytes(uint64(d.bm.Count())*uint64(d.info.PieceLength)))
+	go d.startBackground()
 
 	d.m.Lock()
-	if d.bm.Count() == d.info.NumPieces {
-		d.state = Uploading
-	} else {
-		d.state = Downloading
+	// keep stopped if it's stopped in last session
+	d.stopAfterCheck = d.resume != nil && d.resume.State == Stopped
+
+	switch {
+	case d.hasMetadata():
+		d.state = CheckQueued
+	case d.stopAfterCheck:
+		d.state = Stopped
+	default:
+		d.state = Queued
 	}
 	d.m.Unlock()
+	d.cond.Broadcast()
 
-	go d.startBackground()
+	d.c.notifyQueue()
+
+	if !d.hasMetadata() {
+		go d.backgroundMetadata()
+	}
 }
 
 func (d *Download) startBackground() {
@@ -73,6 +64,9 @@ func (d *Download) startBackground() {
 
 	go d.backgroundReqHandle()
 	go d.backgroundResHandler()
+	go d.backgroundChoker()
+	go d.backgroundDHT()
+	go d.backgroundWebSeeds()
 
 	go func() {
 		for {
@@ -87,9 +81,13 @@ func (d *Download) startBackground() {
 		LOOP:
 			for {
 				switch d.state {
-				case Uploading, Downloading:
+				case Uploading, Downloading, FetchingMetadata:
 					break LOOP
-				case Stopped, Moving, Checking, Error:
+				case Stopped, Moving, Checking, Error, CheckQueued, Queued:
+					if d.ctx.Err() != nil {
+						d.m.Unlock()
+						return
+					}
 					d.cond.Wait()
 				}
 			}
@@ -110,7 +108,12 @@ func (d *Download) startBackground() {
 		}
 
 		d.m.Lock()
-		if d.state == Stopped {
+		for !isActive(d.state) {
+			if d.ctx.Err() != nil {
+				d.m.Unlock()
+				return
+			}
+
 			d.log.Trace().Msg("paused, waiting")
 			d.cond.Wait()
 		}
@@ -122,37 +125,6 @@ func (d *Download) startBackground() {
 	}
 }
 
-type Priority struct {
-	Index  uint32
-	Weight uint32
-}
-
-type PriorityQueue []Priority
-
-func (p *PriorityQueue) Len() int {
-	return len(*p)
-}
-
-func (p *PriorityQueue) Less(i, j int) bool {
-	return (*p)[i].Weight > (*p)[j].Weight
-}
-
-func (p *PriorityQueue) Swap(i, j int) {
-	(*p)[i], (*p)[j] = (*p)[j], (*p)[i]
-}
-
-func (p *PriorityQueue) Push(item Priority) {
-	*p = append(*p, item)
-}
-
-func (p *PriorityQueue) Pop() Priority {
-	old := *p
-	n := len(old)
-	x := old[n-1]
-	*p = old[:n-1]
-	return x
-}
-
 func (d *Download) backgroundResHandler() {
 	for {
 		select {
@@ -180,12 +152,12 @@ func (d *Download) readPiece(index uint32) ([]byte, error) {
 
 	var offset int64 = 0
 	for _, chunk := range pieces.fileChunks {
-		f, err := d.openFileWithCache(chunk.fileIndex)
+		f, fileOffset, err := d.openChunk(chunk)
 		if err != nil {
 			return nil, err
 		}
 
-		_, err = f.File.ReadAt(buf[offset:offset+chunk.length], chunk.offsetOfFile)
+		_, err = f.File.ReadAt(buf[offset:offset+chunk.length], fileOffset)
 		if err != nil {
 			f.Release()
 			return nil, err
@@ -197,3 +169,43 @@ func (d *Download) readPiece(index uint32) ([]byte, error) {
 
 	return buf, nil
 }
+
+// readChunk read a block of piece from disk, used to response request from peers
+func (d *Download) readChunk(req proto.ChunkRequest) ([]byte, error) {
+	pieces := d.pieceInfo[req.PieceIndex]
+	var buf = make([]byte, req.Length)
+
+	var chunkStart int64 = 0
+	var begin = int64(req.Begin)
+	var end = int64(req.Begin) + int64(req.Length)
+
+	for _, chunk := range pieces.fileChunks {
+		chunkEnd := chunkStart + chunk.length
+		if chunkEnd <= begin {
+			chunkStart = chunkEnd
+			continue
+		}
+
+		if chunkStart >= end {
+			break
+		}
+
+		readStart := max(begin, chunkStart)
+		readEnd := min(end, chunkEnd)
+
+		f, fileOffset, err := d.openChunk(chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = f.File.ReadAt(buf[readStart-begin:readEnd-begin], fileOffset+readStart-chunkStart)
+		f.Release()
+		if err != nil {
+			return nil, err
+		}
+
+		chunkStart = chunkEnd
+	}
+
+	return buf, nil
+}
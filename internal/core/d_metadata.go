@@ -0,0 +1,233 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/docker/go-units"
+	"github.com/samber/lo"
+
+	"tyr/internal/meta"
+	"tyr/internal/pkg/bm"
+	"tyr/internal/pkg/global/tasks"
+)
+
+// refuse peers sending huge metadata
+const maxMetadataSize = units.MiB * 64
+
+// NewMagnetDownload create a download without metadata, metadata will be fetched from peers.
+func (c *Client) NewMagnetDownload(magnet metainfo.Magnet, basePath string, tags []string) *Download {
+	h := meta.Hash(magnet.InfoHash)
+
+	name := magnet.DisplayName
+	if name == "" {
+		name = h.Hex()
+	}
+
+	var m metainfo.MetaInfo
+	if len(magnet.Trackers) != 0 {
+		m.AnnounceList = [][]string{magnet.Trackers}
+	}
+
+	// BEP 19 web seeds of magnet link
+	m.UrlList = magnet.Params["ws"]
+
+	return c.NewDownload(&m, meta.Info{Hash: h, Name: name}, basePath, tags)
+}
+
+func (d *Download) getInfoBytes() []byte {
+	d.metadataMutex.Lock()
+	defer d.metadataMutex.Unlock()
+
+	return d.infoBytes
+}
+
+// infoHashes return info hashes of torrent, info is replaced after metadata is fetched.
+func (d *Download) infoHashes() []meta.Hash {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	return d.info.InfoHashes()
+}
+
+func (d *Download) hasMetadata() bool {
+	return d.getInfoBytes() != nil
+}
+
+// onMetadataSize is called when peer tell us metadata size in extended handshake.
+func (d *Download) onMetadataSize(p *Peer, size int) {
+	if size <= 0 || size > maxMetadataSize {
+		return
+	}
+
+	d.metadataMutex.Lock()
+	if d.infoBytes != nil {
+		d.metadataMutex.Unlock()
+		return
+	}
+
+	if d.metadataPieces == nil {
+		d.metadataSize = size
+		d.metadataPieces = make([][]byte, (size+metadataPieceSize-1)/metadataPieceSize)
+	}
+	d.metadataMutex.Unlock()
+
+	p.requestMetadata()
+}
+
+func (d *Download) missingMetadataPieces() []int {
+	d.metadataMutex.Lock()
+	defer d.metadataMutex.Unlock()
+
+	var r []int
+	for i, piece := range d.metadataPieces {
+		if piece == nil {
+			r = append(r, i)
+		}
+	}
+
+	return r
+}
+
+func (d *Download) metadataPieceReceived(piece int, totalSize int, data []byte) {
+	d.metadataMutex.Lock()
+	defer d.metadataMutex.Unlock()
+
+	if d.infoBytes != nil || d.metadataPieces == nil {
+		return
+	}
+
+	if totalSize != d.metadataSize || piece < 0 || piece >= len(d.metadataPieces) {
+		return
+	}
+
+	expectedSize := metadataPieceSize
+	if piece == len(d.metadataPieces)-1 {
+		expectedSize = d.metadataSize - piece*metadataPieceSize
+	}
+
+	if len(data) != expectedSize {
+		return
+	}
+
+	d.metadataPieces[piece] = data
+
+	for _, p := range d.metadataPieces {
+		if p == nil {
+			return
+		}
+	}
+
+	infoBytes := bytes.Join(d.metadataPieces, nil)
+	if sha1.Sum(infoBytes) != d.info.Hash {
+		d.log.Debug().Msg("metadata hash mismatch, fetching again")
+		d.metadataPieces = make([][]byte, len(d.metadataPieces))
+		return
+	}
+
+	d.infoBytes = infoBytes
+	d.metadataPieces = nil
+
+	tasks.Submit(d.task(d.onMetadataComplete))
+}
+
+func (d *Download) onMetadataComplete() {
+	d.log.Info().Msg("metadata fetched")
+
+	m := &metainfo.MetaInfo{
+		InfoBytes: d.getInfoBytes(),
+		AnnounceList: lo.Map(d.trackers, func(tier TrackerTier, _ int) []string {
+			return lo.Map(tier.trackers, func(t *Tracker, _ int) string {
+				return t.url
+			})
+		}),
+		UrlList: d.webSeedURLs(webSeedGetRight),
+	}
+
+	info, err := meta.FromTorrent(*m)
+	if err != nil {
+		d.setError(err)
+		return
+	}
+
+	if err = d.c.saveTorrentFile(m, info.Hash); err != nil {
+		d.setError(err)
+		return
+	}
+
+	_ = os.Remove(d.c.magnetFilePath(info.Hash))
+
+	// no new peers are created until metadata is applied.
+	d.connMutex.Lock()
+
+	// peers are created without piece info, close and reconnect them after metadata is applied,
+	// their goroutines must exit before info is replaced.
+	var peers []*Peer
+	d.conn.Range(func(addr netip.AddrPort, p *Peer) bool {
+		p.close()
+		peers = append(peers, p)
+
+		d.peersMutex.Lock()
+		d.peers.Push(peerWithPriority{addrPort: addr, priority: d.c.PeerPriority(addr)})
+		d.peersMutex.Unlock()
+
+		d.c.ch.Delete(addr)
+		return true
+	})
+
+	for _, p := range peers {
+		p.wait()
+	}
+
+	d.m.Lock()
+	d.info = info
+	d.private = info.Private
+	d.pieceInfo = buildPieceInfos(info)
+	d.bm = bm.New(info.NumPieces)
+	d.m.Unlock()
+
+	d.connMutex.Unlock()
+
+	d.c.m.Lock()
+	d.c.updateInfoHashes()
+	d.c.m.Unlock()
+
+	d.hashMutex.Lock()
+	d.piecesV2 = info.PiecesV2
+	d.hashMutex.Unlock()
+
+	d.setFilePriority(nil)
+
+	if err = d.fire(eventMetadataFetched); err != nil {
+		d.log.Warn().Err(err).Msg("failed to check data after metadata fetched")
+	}
+}
+
+// backgroundMetadata request metadata from connected peers until we get it.
+func (d *Download) backgroundMetadata() {
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			if d.hasMetadata() {
+				return
+			}
+
+			d.conn.Range(func(_ netip.AddrPort, p *Peer) bool {
+				if p.utMetadataID.Load() != 0 {
+					tasks.Submit(p.requestMetadata)
+				}
+
+				return true
+			})
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/types/infohash"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/semaphore"
+
+	"tyr/internal/proto"
+)
+
+func TestMetadataCompleteWithPeer(t *testing.T) {
+	torrent, _ := newTestDownload(t)
+	c := torrent.c
+
+	d := c.NewMagnetDownload(metainfo.Magnet{InfoHash: infohash.T(torrent.info.Hash)}, t.TempDir(), nil)
+	c.m.Lock()
+	c.addDownload(d)
+	c.m.Unlock()
+
+	conn, remote := net.Pipe()
+	defer remote.Close()
+
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+
+	// connection slot is taken by listener for incoming connections
+	c.sem = semaphore.NewWeighted(1)
+	require.True(t, c.sem.TryAcquire(1))
+	c.connectionCount.Add(1)
+
+	addr := netip.MustParseAddrPort("10.0.0.1:6881")
+	d.AddConn(addr, conn, proto.Handshake{InfoHash: torrent.info.Hash, FastExtension: true})
+
+	// peer keep sending messages while metadata is applied
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := uint32(0); ; i++ {
+			if proto.SendHave(remote, i%torrent.info.NumPieces) != nil {
+				return
+			}
+		}
+	}()
+
+	require.Eventually(t, func() bool {
+		_, ok := d.conn.Load(addr)
+		return ok
+	}, time.Second, time.Millisecond)
+
+	d.metadataMutex.Lock()
+	d.infoBytes = torrent.infoBytes
+	d.metadataMutex.Unlock()
+
+	d.onMetadataComplete()
+
+	require.Equal(t, torrent.info.NumPieces, d.info.NumPieces)
+	require.Len(t, d.pieceInfo, int(torrent.info.NumPieces))
+
+	<-done
+	_, ok := d.conn.Load(addr)
+	require.False(t, ok, "peers connected without metadata are closed")
+}
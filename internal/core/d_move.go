@@ -12,20 +12,17 @@ import (
 )
 
 func (d *Download) Move(target string) error {
-	ctx, cancel := context.WithCancel(d.ctx)
-	defer cancel()
-
-	d.m.RLock()
-	originalState := d.state
-	d.m.RUnlock()
+	if !d.acquireTask() {
+		return ErrTorrentNotFound
+	}
+	defer d.taskWG.Done()
 
-	if originalState == Moving || originalState == Checking {
-		return nil
+	if err := d.fire(eventMove); err != nil {
+		return err
 	}
 
-	d.m.Lock()
-	d.state = Moving
-	d.m.Unlock()
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
 
 	err := d.move(ctx, target)
 	if err != nil {
@@ -35,20 +32,62 @@ func (d *Download) Move(target string) error {
 
 	d.m.Lock()
 	d.basePath = target
-	d.state = originalState
 	d.m.Unlock()
 
+	if err := d.fire(eventMoved); err != nil {
+		return err
+	}
+
+	d.c.publish(ClientEvent{Type: EventMoveDone, InfoHash: d.info.Hash, Message: target})
+
 	return nil
 }
 
 func (d *Download) move(ctx context.Context, target string) error {
 	originalBasePath := d.basePath
 
-	for index := range d.info.Files {
-		err := d.moveFile(ctx, target, uint32(index))
+	// source files are kept until all files are copied,
+	// copied files are removed on failure so move can be retried or torrent can be removed.
+	var copied []string
+	for index, file := range d.info.Files {
+		// skipped file never created
+		if d.useParts(index) {
+			continue
+		}
+
+		p := filepath.Join(target, file.Path)
+
+		err := ctx.Err()
+		if err == nil {
+			err = d.moveFile(ctx, target, uint32(index))
+			// file being copied is incomplete
+			if err != nil && ctx.Err() != nil {
+				copied = append(copied, p)
+			}
+		}
+
 		if err != nil {
+			for _, f := range copied {
+				_ = os.Remove(f)
+			}
+
 			return err
 		}
+
+		copied = append(copied, p)
+	}
+
+	partsPath := d.partsFilePath()
+	if _, err := os.Stat(partsPath); err == nil {
+		if err = os.MkdirAll(target, os.ModePerm); err != nil {
+			return err
+		}
+
+		if err = gfs.SmartCopy(ctx, partsPath, filepath.Join(target, filepath.Base(partsPath)), d.ioDown); err != nil {
+			return err
+		}
+
+		_ = os.Remove(partsPath)
 	}
 
 	for _, file := range d.info.Files {
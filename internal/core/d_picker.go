@@ -0,0 +1,266 @@
+package core
+
+import (
+	"net/netip"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/samber/lo"
+
+	"tyr/internal/pkg/empty"
+	"tyr/internal/proto"
+)
+
+// peer may be too slow or never response a request.
+// After timeout, chunk will be requested from other peers.
+const requestTimeout = time.Second * 30
+
+type Priority struct {
+	Index  uint32
+	Weight uint32
+	Level  FilePriority
+}
+
+// PriorityQueue sort pieces by file priority, then availability, rarest first.
+type PriorityQueue []Priority
+
+func (p *PriorityQueue) Len() int {
+	return len(*p)
+}
+
+func (p *PriorityQueue) Less(i, j int) bool {
+	if (*p)[i].Level != (*p)[j].Level {
+		return (*p)[i].Level > (*p)[j].Level
+	}
+
+	return (*p)[i].Weight < (*p)[j].Weight
+}
+
+func (p *PriorityQueue) Swap(i, j int) {
+	(*p)[i], (*p)[j] = (*p)[j], (*p)[i]
+}
+
+type pickerPeer struct {
+	p    *Peer
+	free int
+}
+
+// pickPieces send chunk requests to connected peers.
+func (d *Download) pickPieces() {
+	var peers []*pickerPeer
+
+	d.conn.Range(func(_ netip.AddrPort, p *Peer) bool {
+		if p.Bitmap.Count() == 0 {
+			return true
+		}
+
+		if p.peerChoked.Load() && p.allowFast.Count() == 0 {
+			return true
+		}
+
+		free := int(p.QueueLimit.Load()) - p.requests.Size()
+		if free <= 0 {
+			return true
+		}
+
+		peers = append(peers, &pickerPeer{p: p, free: free})
+		return true
+	})
+
+	if len(peers) == 0 {
+		return
+	}
+
+	for _, index := range d.pieceCandidates() {
+		if !d.requestPiece(index, peers) {
+			return
+		}
+	}
+
+	if d.isEndgame() {
+		if d.endgame.CompareAndSwap(false, true) {
+			d.log.Debug().Msg("enter endgame mode")
+		}
+
+		d.requestEndgame(peers)
+		return
+	}
+
+	d.endgame.Store(false)
+}
+
+// pieceCandidates return wanted pieces to download in order.
+// Pieces read by stream readers come first, then partially downloaded pieces, then pieces of higher priority files.
+// Pieces with same priority are picked rarest first, or in sequential order if enabled.
+func (d *Download) pieceCandidates() []uint32 {
+	streaming := d.streamPieces()
+
+	d.pdMutex.RLock()
+	partial := lo.Keys(d.pieceData)
+	d.pdMutex.RUnlock()
+
+	d.priorityMutex.RLock()
+	defer d.priorityMutex.RUnlock()
+
+	partial = lo.Filter(partial, func(index uint32, _ int) bool {
+		return d.piecePriority[index] != FilePrioritySkip && !slices.Contains(streaming, index)
+	})
+
+	slices.Sort(partial)
+
+	var availability = make([]uint32, d.info.NumPieces)
+
+	d.conn.Range(func(_ netip.AddrPort, p *Peer) bool {
+		p.Bitmap.Range(func(i uint32) {
+			availability[i]++
+		})
+		return true
+	})
+
+	h := make(PriorityQueue, 0, d.info.NumPieces)
+	for i := uint32(0); i < d.info.NumPieces; i++ {
+		if availability[i] == 0 || d.bm.Get(i) || d.piecePriority[i] == FilePrioritySkip {
+			continue
+		}
+
+		// piece of v2 torrent can't be verified before its piece layer is received
+		if !d.canVerify(i) {
+			continue
+		}
+
+		if _, found := slices.BinarySearch(partial, i); found {
+			continue
+		}
+
+		if d.fetchingFromWebSeed(i) {
+			continue
+		}
+
+		if _, found := slices.BinarySearch(streaming, i); found {
+			continue
+		}
+
+		h = append(h, Priority{Index: i, Weight: availability[i], Level: d.piecePriority[i]})
+	}
+
+	if d.seq.Load() {
+		sort.SliceStable(h, func(i, j int) bool {
+			return h[i].Level > h[j].Level
+		})
+	} else {
+		// random order between pieces with same priority and availability
+		h = lo.Shuffle(h)
+		sort.Stable(&h)
+	}
+
+	var result = make([]uint32, 0, len(streaming)+len(partial)+len(h))
+	result = append(result, streaming...)
+	result = append(result, partial...)
+	for _, p := range h {
+		result = append(result, p.Index)
+	}
+
+	return result
+}
+
+// requestPiece request missing chunks of piece from peers.
+// return false if all peers are busy.
+func (d *Download) requestPiece(index uint32, peers []*pickerPeer) bool {
+	var received []bool
+
+	d.pdMutex.RLock()
+	if chunks, ok := d.pieceData[index]; ok {
+		received = lo.Map(chunks, func(item *peerChunk, _ int) bool {
+			return item != nil
+		})
+	}
+	d.pdMutex.RUnlock()
+
+	for ci, req := range d.pieceChunks(index) {
+		if received != nil && received[ci] {
+			continue
+		}
+
+		if _, ok := d.reqHistory.Load(req); ok {
+			continue
+		}
+
+		pp := pickPeer(peers, req)
+		if pp == nil {
+			continue
+		}
+
+		if !pp.p.Request(req) {
+			pp.free = 0
+			continue
+		}
+
+		pp.free--
+		d.reqHistory.Store(req, downloadReq{conn: pp.p, sentAt: time.Now()})
+	}
+
+	return lo.SomeBy(peers, func(item *pickerPeer) bool {
+		return item.free > 0
+	})
+}
+
+// pickPeer find the peer with most free request slots who can serve this request.
+func pickPeer(peers []*pickerPeer, req proto.ChunkRequest) *pickerPeer {
+	var best *pickerPeer
+
+	for _, pp := range peers {
+		if pp.free <= 0 {
+			continue
+		}
+
+		if !pp.p.Bitmap.Get(req.PieceIndex) {
+			continue
+		}
+
+		if pp.p.peerChoked.Load() && !pp.p.allowFast.Get(req.PieceIndex) {
+			continue
+		}
+
+		if _, rejected := pp.p.rejected.Load(req); rejected {
+			continue
+		}
+
+		if best == nil || pp.free > best.free {
+			best = pp
+		}
+	}
+
+	return best
+}
+
+// expireRequests cancel requests not responded in time, so they can be sent to other peers.
+func (d *Download) expireRequests() {
+	now := time.Now()
+
+	d.reqHistory.Range(func(req proto.ChunkRequest, r downloadReq) bool {
+		if now.Sub(r.sentAt) > requestTimeout {
+			d.reqHistory.Delete(req)
+			r.conn.Cancel(req)
+		}
+
+		return true
+	})
+}
+
+// releaseRequest mark request as not sent, so piece picker will request it again.
+func (d *Download) releaseRequest(p *Peer, req proto.ChunkRequest) {
+	d.reqHistory.Compute(req, func(oldValue downloadReq, loaded bool) (downloadReq, bool) {
+		return oldValue, !loaded || oldValue.conn == p
+	})
+}
+
+// releasePeerRequests release all pending requests sent to peer,
+// should be called when peer is closed or choke us.
+func (d *Download) releasePeerRequests(p *Peer) {
+	p.requests.Range(func(req proto.ChunkRequest, _ empty.Empty) bool {
+		p.requests.Delete(req)
+		d.releaseRequest(p, req)
+		return true
+	})
+}
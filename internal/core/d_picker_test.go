@@ -0,0 +1,84 @@
+package core
+
+import (
+	"io"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSeed create an unchoked peer having pieces, messages sent to it are discarded.
+func newTestSeed(t *testing.T, d *Download, addr string, pieces ...uint32) *Peer {
+	t.Helper()
+
+	p, remote := newTestPeer(t, d, netip.MustParseAddrPort(addr))
+	p.peerChoked.Store(false)
+	for _, index := range pieces {
+		p.Bitmap.Set(index)
+	}
+
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+
+	return p
+}
+
+func TestPieceCandidates(t *testing.T) {
+	d, _ := newTestDownload(t)
+
+	newTestSeed(t, d, "10.0.0.1:6881", 0, 1, 2, 3)
+	newTestSeed(t, d, "10.0.0.2:6881", 1, 3)
+	newTestSeed(t, d, "10.0.0.3:6881", 3)
+
+	// rarest first, pieces with same availability are shuffled
+	candidates := d.pieceCandidates()
+	require.ElementsMatch(t, []uint32{0, 2}, candidates[:2])
+	require.Equal(t, []uint32{1, 3}, candidates[2:])
+
+	// downloaded pieces are skipped
+	d.bm.Set(0)
+	require.Equal(t, []uint32{2, 1, 3}, d.pieceCandidates())
+
+	// partially downloaded pieces come first
+	d.pieceData[3] = make([]*peerChunk, len(d.pieceChunks(3)))
+	require.Equal(t, []uint32{3, 2, 1}, d.pieceCandidates())
+
+	d.seq.Store(true)
+	require.Equal(t, []uint32{3, 1, 2}, d.pieceCandidates())
+}
+
+func TestPieceCandidatesNotAvailable(t *testing.T) {
+	d, _ := newTestDownload(t)
+	require.Empty(t, d.pieceCandidates())
+
+	newTestSeed(t, d, "10.0.0.1:6881", 2)
+	require.Equal(t, []uint32{2}, d.pieceCandidates())
+}
+
+func TestExpireRequests(t *testing.T) {
+	d, _ := newTestDownload(t)
+	p := newTestSeed(t, d, "10.0.0.1:6881", 0, 1)
+
+	expired := d.pieceChunks(0)[0]
+	pending := d.pieceChunks(1)[0]
+
+	require.True(t, p.Request(expired))
+	require.True(t, p.Request(pending))
+	d.reqHistory.Store(expired, downloadReq{conn: p, sentAt: time.Now().Add(-requestTimeout - time.Second)})
+	d.reqHistory.Store(pending, downloadReq{conn: p, sentAt: time.Now()})
+
+	d.expireRequests()
+
+	_, ok := d.reqHistory.Load(expired)
+	require.False(t, ok, "expired request should be released")
+	_, ok = p.requests.Load(expired)
+	require.False(t, ok)
+	_, ok = p.cancelled.Load(expired)
+	require.True(t, ok, "expired request should be cancelled")
+
+	_, ok = d.reqHistory.Load(pending)
+	require.True(t, ok)
+	_, ok = p.requests.Load(pending)
+	require.True(t, ok)
+}
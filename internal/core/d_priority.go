@@ -0,0 +1,366 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/trim21/errgo"
+
+	"tyr/internal/meta"
+	"tyr/internal/pkg/bm"
+	"tyr/internal/pkg/filepool"
+)
+
+type FilePriority uint8
+
+const (
+	// FilePrioritySkip file is not downloaded and not created on disk.
+	FilePrioritySkip FilePriority = iota
+	FilePriorityLow
+	FilePriorityNormal
+	FilePriorityHigh
+)
+
+func (p FilePriority) String() string {
+	switch p {
+	case FilePrioritySkip:
+		return "skip"
+	case FilePriorityLow:
+		return "low"
+	case FilePriorityNormal:
+		return "normal"
+	case FilePriorityHigh:
+		return "high"
+	}
+
+	return fmt.Sprintf("FilePriority(%d)", p)
+}
+
+func ParseFilePriority(s string) (FilePriority, error) {
+	switch strings.ToLower(s) {
+	case "skip":
+		return FilePrioritySkip, nil
+	case "low":
+		return FilePriorityLow, nil
+	case "normal":
+		return FilePriorityNormal, nil
+	case "high":
+		return FilePriorityHigh, nil
+	}
+
+	return FilePriorityNormal, fmt.Errorf("invalid file priority %q", s)
+}
+
+var errNoMetadata = errors.New("torrent metadata is not available yet")
+
+// setFilePriority replace priority of all files and rebuild piece priority.
+// nil or mismatched length means all files are normal priority, pad files are always skipped.
+func (d *Download) setFilePriority(priority []FilePriority) {
+	if len(priority) != len(d.info.Files) {
+		priority = make([]FilePriority, len(d.info.Files))
+		for i := range priority {
+			priority[i] = FilePriorityNormal
+		}
+	}
+
+	for i, f := range d.info.Files {
+		if f.Pad {
+			priority[i] = FilePrioritySkip
+		}
+	}
+
+	d.priorityMutex.Lock()
+	defer d.priorityMutex.Unlock()
+
+	d.filePriority = priority
+	d.buildPiecePriority()
+}
+
+// buildPiecePriority set priority of piece to the highest priority of files it overlaps,
+// must be called with priorityMutex locked.
+func (d *Download) buildPiecePriority() {
+	d.piecePriority = make([]FilePriority, d.info.NumPieces)
+	d.wanted = bm.New(d.info.NumPieces)
+
+	for i, piece := range d.pieceInfo {
+		for _, chunk := range piece.fileChunks {
+			d.piecePriority[i] = max(d.piecePriority[i], d.filePriority[chunk.fileIndex])
+		}
+
+		if d.piecePriority[i] != FilePrioritySkip {
+			d.wanted.Set(uint32(i))
+		}
+	}
+}
+
+func (d *Download) getFilePriority(index int) FilePriority {
+	d.priorityMutex.RLock()
+	defer d.priorityMutex.RUnlock()
+
+	return d.filePriority[index]
+}
+
+func (d *Download) filePriorities() []FilePriority {
+	d.priorityMutex.RLock()
+	defer d.priorityMutex.RUnlock()
+
+	return slices.Clone(d.filePriority)
+}
+
+// savedFilePriorities return priority of files to save in resume data,
+// files wanted only by stream readers are still skipped.
+func (d *Download) savedFilePriorities() []FilePriority {
+	d.priorityMutex.RLock()
+	defer d.priorityMutex.RUnlock()
+
+	r := slices.Clone(d.filePriority)
+	for index := range d.streamFiles {
+		r[index] = FilePrioritySkip
+	}
+
+	return r
+}
+
+func (d *Download) getPiecePriority(index uint32) FilePriority {
+	d.priorityMutex.RLock()
+	defer d.priorityMutex.RUnlock()
+
+	return d.piecePriority[index]
+}
+
+// isCompleted check if all wanted pieces are downloaded.
+func (d *Download) isCompleted() bool {
+	if d.info.NumPieces == 0 {
+		return false
+	}
+
+	d.priorityMutex.RLock()
+	defer d.priorityMutex.RUnlock()
+
+	return d.wanted.WithAndNot(d.bm).Count() == 0
+}
+
+// wantedProgress return total and downloaded bytes of files not skipped.
+func (d *Download) wantedProgress() (wanted int64, completed int64) {
+	d.priorityMutex.RLock()
+	defer d.priorityMutex.RUnlock()
+
+	for i, file := range d.info.Files {
+		if d.filePriority[i] != FilePrioritySkip {
+			wanted += file.Length
+		}
+	}
+
+	d.bm.Range(func(index uint32) {
+		for _, chunk := range d.pieceInfo[index].fileChunks {
+			if d.filePriority[chunk.fileIndex] != FilePrioritySkip {
+				completed += chunk.length
+			}
+		}
+	})
+
+	return wanted, completed
+}
+
+func (d *Download) fileInfos() []FileInfo {
+	var r = make([]FileInfo, len(d.info.Files))
+
+	priority := d.filePriorities()
+	for i, file := range d.info.Files {
+		r[i] = FileInfo{Path: file.Path, Length: file.Length, Priority: priority[i], Pad: file.Pad}
+	}
+
+	d.bm.Range(func(index uint32) {
+		for _, chunk := range d.pieceInfo[index].fileChunks {
+			r[chunk.fileIndex].Completed += chunk.length
+		}
+	})
+
+	return r
+}
+
+func (c *Client) SetFilePriority(h meta.Hash, files []int, priority FilePriority) error {
+	d, err := c.getDownload(h)
+	if err != nil {
+		return err
+	}
+
+	return d.SetFilePriority(files, priority)
+}
+
+// SetFilePriority change priority of files.
+// Download state is changed between Downloading and Uploading if wanted pieces are changed.
+func (d *Download) SetFilePriority(files []int, priority FilePriority) error {
+	if !d.hasMetadata() {
+		return errNoMetadata
+	}
+
+	for _, index := range files {
+		if index < 0 || index >= len(d.info.Files) {
+			return fmt.Errorf("file index %d out of range", index)
+		}
+	}
+
+	// priority set by user is kept after stream readers are closed
+	d.priorityMutex.Lock()
+	for _, index := range files {
+		delete(d.streamFiles, index)
+	}
+	d.priorityMutex.Unlock()
+
+	return d.changeFilePriority(files, priority)
+}
+
+// changeFilePriority change priority of valid file indexes.
+func (d *Download) changeFilePriority(files []int, priority FilePriority) error {
+	if priority != FilePrioritySkip {
+		for _, index := range files {
+			if d.info.Files[index].Pad || d.getFilePriority(index) != FilePrioritySkip {
+				continue
+			}
+
+			if err := d.restoreFromParts(index); err != nil {
+				return err
+			}
+		}
+	}
+
+	d.priorityMutex.Lock()
+	for _, index := range files {
+		if !d.info.Files[index].Pad {
+			d.filePriority[index] = priority
+		}
+	}
+	d.buildPiecePriority()
+	d.priorityMutex.Unlock()
+
+	d.m.RLock()
+	state := d.state
+	d.m.RUnlock()
+
+	completed := d.isCompleted()
+
+	if state == Uploading && !completed {
+		return d.fire(eventIncomplete)
+	}
+
+	if state == Downloading && completed {
+		return d.fire(eventCompleted)
+	}
+
+	return nil
+}
+
+// partsFilePath is where data of skipped files are stored, when their pieces overlap wanted files.
+// data is stored at its offset in torrent, so it's a sparse file.
+func (d *Download) partsFilePath() string {
+	return filepath.Join(d.basePath, "."+d.info.Hash.Hex()+".parts")
+}
+
+func (d *Download) openPartsFile() (*filepool.File, error) {
+	if err := os.MkdirAll(d.basePath, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	return filepool.Open(d.partsFilePath(), os.O_RDWR|os.O_CREATE, os.ModePerm, time.Hour)
+}
+
+// useParts check if chunk should be read from or written to parts file.
+// Skipped files already on disk are still used, so partially downloaded files are not lost.
+func (d *Download) useParts(fileIndex int) bool {
+	if d.getFilePriority(fileIndex) != FilePrioritySkip {
+		return false
+	}
+
+	_, err := os.Stat(filepath.Join(d.basePath, d.info.Files[fileIndex].Path))
+
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// openChunk open file containing data of chunk, return file and offset of chunk in it.
+func (d *Download) openChunk(chunk pieceInfoFileChunk) (*filepool.File, int64, error) {
+	if d.useParts(chunk.fileIndex) {
+		f, err := d.openPartsFile()
+		return f, chunk.offset, err
+	}
+
+	f, err := d.openFileWithCache(chunk.fileIndex)
+	return f, chunk.offsetOfFile, err
+}
+
+// restoreFromParts copy downloaded data of a skipped file from parts file to the file itself,
+// before it's wanted again.
+// Data is copied to a temporary file and renamed to the file after it's done,
+// because existence of file decides where data is read from.
+func (d *Download) restoreFromParts(fileIndex int) error {
+	if !d.useParts(fileIndex) {
+		return nil
+	}
+
+	parts, err := os.Open(d.partsFilePath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+	defer parts.Close()
+
+	p := filepath.Join(d.basePath, d.info.Files[fileIndex].Path)
+	if err = os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p+".restoring", os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	if err = d.copyFromParts(parts, f, fileIndex); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return errgo.Wrap(err, fmt.Sprintf("failed to write file %s", f.Name()))
+	}
+
+	return errgo.Wrap(os.Rename(f.Name(), p), "failed to restore file from parts file")
+}
+
+// copyFromParts copy completed chunks of file from parts file to f.
+func (d *Download) copyFromParts(parts *os.File, f *os.File, fileIndex int) error {
+	var buf []byte
+	var failed error
+
+	d.bm.RangeX(func(index uint32) bool {
+		for _, chunk := range d.pieceInfo[index].fileChunks {
+			if chunk.fileIndex != fileIndex {
+				continue
+			}
+
+			buf = slices.Grow(buf[:0], int(chunk.length))[:chunk.length]
+			if _, err := parts.ReadAt(buf, chunk.offset); err != nil {
+				failed = errgo.Wrap(err, "failed to read parts file")
+				return false
+			}
+
+			if _, err := f.WriteAt(buf, chunk.offsetOfFile); err != nil {
+				failed = errgo.Wrap(err, fmt.Sprintf("failed to write file %s", f.Name()))
+				return false
+			}
+		}
+
+		return true
+	})
+
+	return failed
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"crypto/sha1"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/meta"
+)
+
+func TestPiecePriority(t *testing.T) {
+	d, _ := newTestDownload(t)
+
+	d.setFilePriority([]FilePriority{FilePriorityLow, FilePrioritySkip, FilePriorityHigh})
+
+	require.Equal(t, []FilePriority{FilePriorityLow, FilePriorityLow, FilePrioritySkip, FilePriorityHigh}, d.piecePriority)
+	require.EqualValues(t, 3, d.wanted.Count())
+
+	wanted, completed := d.wantedProgress()
+	require.EqualValues(t, 35000, wanted)
+	require.EqualValues(t, 0, completed)
+
+	d.setFilePriority(nil)
+	require.EqualValues(t, 4, d.wanted.Count())
+}
+
+func TestSkippedFileParts(t *testing.T) {
+	d, data := newTestDownload(t)
+	d.state = Uploading
+	d.setFilePriority([]FilePriority{FilePriorityNormal, FilePrioritySkip, FilePriorityNormal})
+
+	for _, index := range []uint32{0, 1, 3} {
+		writeTestPiece(t, d, data, index)
+	}
+
+	require.True(t, d.isCompleted())
+
+	_, err := os.Stat(filepath.Join(d.basePath, "b"))
+	require.ErrorIs(t, err, os.ErrNotExist, "skipped file should not be created")
+
+	for _, index := range []uint32{0, 1, 3} {
+		piece, err := d.readPiece(index)
+		require.NoError(t, err)
+		require.Equal(t, d.info.Pieces[index], meta.Hash(sha1.Sum(piece)))
+	}
+
+	d.bm.Clear()
+	require.NoError(t, d.initCheck())
+	require.EqualValues(t, 3, d.bm.Count(), "pieces should be checked with parts file")
+
+	require.NoError(t, d.SetFilePriority([]int{1}, FilePriorityNormal))
+	require.Equal(t, Downloading, d.state)
+
+	b, err := os.ReadFile(filepath.Join(d.basePath, "b"))
+	require.NoError(t, err)
+	require.Equal(t, data[20000:2*testPieceLength], b[:2*testPieceLength-20000], "data should be restored from parts file")
+	require.Equal(t, data[3*testPieceLength:50000], b[3*testPieceLength-20000:30000])
+}
+
+func TestRestoreFromPartsFailed(t *testing.T) {
+	d, data := newTestDownload(t)
+	d.state = Uploading
+	d.setFilePriority([]FilePriority{FilePriorityNormal, FilePrioritySkip, FilePriorityNormal})
+
+	for _, index := range []uint32{0, 1, 3} {
+		writeTestPiece(t, d, data, index)
+	}
+
+	// data of piece 3 is lost
+	require.NoError(t, os.Truncate(d.partsFilePath(), 2*testPieceLength))
+
+	require.Error(t, d.SetFilePriority([]int{1}, FilePriorityNormal))
+	require.Equal(t, FilePrioritySkip, d.getFilePriority(1))
+	require.True(t, d.useParts(1), "data is still read from parts file")
+
+	entries, err := os.ReadDir(d.basePath)
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.False(t, strings.HasPrefix(e.Name(), "b"), "file %s should not be created", e.Name())
+	}
+}
@@ -2,38 +2,185 @@ package core
 
 import (
 	"encoding"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/anacrolix/torrent/bencode"
+	"github.com/samber/lo"
+
+	"tyr/internal/pkg/bm"
 )
 
 var _ encoding.BinaryMarshaler = (*Download)(nil)
 var _ encoding.BinaryUnmarshaler = (*Download)(nil)
 
 type resume struct {
-	BasePath    string
-	Bitmap      []byte
-	Tags        []string
-	AddAt       int64
-	CompletedAt int64
-	Downloaded  int64
-	Uploaded    int64
-	State       State
+	BasePath      string
+	Bitmap        []byte
+	Category      string
+	Tags          []string
+	Files         []resumeFile
+	FilePriority  []byte
+	AddAt         int64
+	CompletedAt   int64
+	Downloaded    int64
+	Uploaded      int64
+	DownloadLimit int64
+	UploadLimit   int64
+	State         State
+	QueuePosition int64
+	SeedingTime   int64
+	SeedingLimits *resumeSeedingLimits `bencode:",omitempty"`
+	Sequential    bool
+	// Verified is false if bitmap is saved before checking is done.
+	Verified bool
+	// HTTPSeeds is BEP 17 http seeds, they are not saved in torrent file.
+	HTTPSeeds []string `bencode:",omitempty"`
+}
+
+// resumeSeedingLimits is seeding limits of torrent, nil for global limits.
+// bencode doesn't support float, ratio is stored in thousandths.
+type resumeSeedingLimits struct {
+	Action   string
+	Ratio    int64
+	Time     int64
+	IdleTime int64
+}
+
+// resumeFile is file stat when resume data is saved,
+// if it doesn't change, we can skip checking torrent data.
+type resumeFile struct {
+	// -1 for not exists files
+	Size    int64
+	ModTime int64
 }
 
 func (d *Download) MarshalBinary() (data []byte, err error) {
 	return bencode.Marshal(resume{
-		BasePath:    d.basePath,
-		Downloaded:  d.downloaded.Load(),
-		Uploaded:    d.uploaded.Load(),
-		Tags:        d.tags,
-		State:       d.state,
-		AddAt:       d.AddAt,
-		CompletedAt: d.CompletedAt.Load(),
-		Bitmap:      d.bm.CompressedBytes(),
+		BasePath:      d.basePath,
+		Downloaded:    d.downloaded.Load(),
+		Uploaded:      d.uploaded.Load(),
+		Category:      d.category,
+		Tags:          d.tags,
+		State:         d.state,
+		AddAt:         d.AddAt,
+		CompletedAt:   d.CompletedAt.Load(),
+		DownloadLimit: d.downLimiter.Rate(),
+		UploadLimit:   d.upLimiter.Rate(),
+		Bitmap:        d.bm.CompressedBytes(),
+		Files:         d.fileStats(),
+		Sequential:    d.seq.Load(),
+		Verified:      d.verified.Load(),
+		HTTPSeeds:     d.webSeedURLs(webSeedHoffman),
+		QueuePosition: d.queuePosition.Load(),
+		SeedingTime:   d.seedingTime.Load(),
+		SeedingLimits: toResumeSeedingLimits(d.seedingLimits),
+		FilePriority:  lo.Map(d.savedFilePriorities(), func(p FilePriority, _ int) byte { return byte(p) }),
 	})
 }
 
 func (d *Download) UnmarshalBinary(data []byte) error {
-	//TODO implement me
-	panic("implement me")
+	var r resume
+	if err := bencode.Unmarshal(data, &r); err != nil {
+		return err
+	}
+
+	b, err := bm.FromCompressed(r.Bitmap, d.info.NumPieces)
+	if err != nil {
+		return err
+	}
+
+	d.basePath = r.BasePath
+	d.downloadDir = r.BasePath
+	d.category = r.Category
+	d.tags = r.Tags
+	d.AddAt = r.AddAt
+	d.CompletedAt.Store(r.CompletedAt)
+	d.downloaded.Store(r.Downloaded)
+	d.uploaded.Store(r.Uploaded)
+	d.downloadAtStart = r.Downloaded
+	d.uploadAtStart = r.Uploaded
+	d.seq.Store(r.Sequential)
+	d.verified.Store(r.Verified)
+	d.queuePosition.Store(r.QueuePosition)
+	d.seedingTime.Store(r.SeedingTime)
+	d.seedingLimits = r.SeedingLimits.toSeedingLimits()
+	d.downLimiter.SetRate(r.DownloadLimit)
+	d.upLimiter.SetRate(r.UploadLimit)
+	d.bm = b
+	d.resume = &r
+	d.addWebSeeds(webSeedHoffman, r.HTTPSeeds)
+
+	d.setFilePriority(lo.Map(r.FilePriority, func(p byte, _ int) FilePriority { return FilePriority(p) }))
+
+	return nil
+}
+
+func toResumeSeedingLimits(l *SeedingLimits) *resumeSeedingLimits {
+	if l == nil {
+		return nil
+	}
+
+	return &resumeSeedingLimits{
+		Action:   string(l.Action),
+		Ratio:    int64(math.Round(l.Ratio * 1000)),
+		Time:     int64(l.Time / time.Second),
+		IdleTime: int64(l.IdleTime / time.Second),
+	}
+}
+
+func (r *resumeSeedingLimits) toSeedingLimits() *SeedingLimits {
+	if r == nil {
+		return nil
+	}
+
+	action, err := ParseSeedingAction(r.Action)
+	if err != nil {
+		action = SeedingActionStop
+	}
+
+	return &SeedingLimits{
+		Action:   action,
+		Ratio:    float64(r.Ratio) / 1000,
+		Time:     time.Duration(r.Time) * time.Second,
+		IdleTime: time.Duration(r.IdleTime) * time.Second,
+	}
+}
+
+func (d *Download) fileStats() []resumeFile {
+	var files = make([]resumeFile, len(d.info.Files))
+
+	for i, file := range d.info.Files {
+		stat, err := os.Stat(filepath.Join(d.basePath, file.Path))
+		if err != nil {
+			files[i] = resumeFile{Size: -1}
+			continue
+		}
+
+		files[i] = resumeFile{Size: stat.Size(), ModTime: stat.ModTime().UnixNano()}
+	}
+
+	return files
+}
+
+// resumeValid check if files are not modified after resume data is saved.
+func (d *Download) resumeValid() bool {
+	if d.resume == nil || len(d.resume.Files) != len(d.info.Files) {
+		return false
+	}
+
+	// saved before checking is done, bitmap is not reliable
+	if !d.resume.Verified {
+		return false
+	}
+
+	for i, f := range d.fileStats() {
+		if f != d.resume.Files[i] {
+			return false
+		}
+	}
+
+	return true
 }
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+// restoreTestDownload save resume data of d and restore it like client starting.
+func restoreTestDownload(t *testing.T, d *Download) *Download {
+	t.Helper()
+
+	d.m.Lock()
+	b, err := d.MarshalBinary()
+	d.m.Unlock()
+	require.NoError(t, err)
+
+	r := d.c.NewDownload(&metainfo.MetaInfo{}, d.info, "", nil)
+	require.NoError(t, r.UnmarshalBinary(b))
+
+	return r
+}
+
+func TestResumeRoundTrip(t *testing.T) {
+	d, data := newTestDownload(t)
+
+	for index := range d.info.NumPieces {
+		writeTestPiece(t, d, data, index)
+	}
+
+	d.state = Checking
+	d.check()
+	require.True(t, d.verified.Load())
+	require.True(t, d.isCompleted())
+
+	r := restoreTestDownload(t, d)
+	require.Equal(t, d.basePath, r.basePath)
+	require.Equal(t, d.bm.Count(), r.bm.Count())
+	require.True(t, r.resumeValid(), "checked data doesn't need checking again")
+
+	// saved while waiting for checking slot
+	require.NoError(t, d.fire(eventCheck))
+	require.Equal(t, CheckQueued, d.getState())
+	require.False(t, restoreTestDownload(t, d).resumeValid())
+
+	// stopped before checking
+	require.NoError(t, d.fire(eventStop))
+	require.Equal(t, Stopped, d.getState())
+	require.False(t, restoreTestDownload(t, d).resumeValid())
+
+	d.verified.Store(true)
+	require.True(t, restoreTestDownload(t, d).resumeValid())
+
+	require.NoError(t, os.Remove(filepath.Join(d.basePath, d.info.Files[0].Path)))
+	require.False(t, r.resumeValid(), "files changed after resume data is saved")
+}
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"tyr/internal/meta"
+)
+
+type SeedingAction string
+
+const (
+	SeedingActionStop       SeedingAction = "stop"
+	SeedingActionRemove     SeedingAction = "remove"
+	SeedingActionRemoveData SeedingAction = "remove-data"
+)
+
+func ParseSeedingAction(s string) (SeedingAction, error) {
+	switch a := SeedingAction(s); a {
+	case SeedingActionStop, SeedingActionRemove, SeedingActionRemoveData:
+		return a, nil
+	}
+
+	return SeedingActionStop, fmt.Errorf("invalid seeding action %q, only 'stop', 'remove' or 'remove-data' are allowed", s)
+}
+
+const seedingGoalInterval = time.Second * 30
+
+// SeedingLimits is goal of seeding after download is completed, 0 for unlimited.
+// Action run when any limit is reached.
+// IdleTime is how long torrent is seeding without uploading to any peer.
+type SeedingLimits struct {
+	Action   SeedingAction
+	Ratio    float64
+	Time     time.Duration
+	IdleTime time.Duration
+}
+
+type seedingProgress struct {
+	ratio       float64
+	seedingTime time.Duration
+	idleTime    time.Duration
+}
+
+// SeedingGoalLeft is how far seeding is from limits, -1 for unlimited.
+type SeedingGoalLeft struct {
+	Ratio    float64
+	Time     time.Duration
+	IdleTime time.Duration
+}
+
+func (l SeedingLimits) left(p seedingProgress) SeedingGoalLeft {
+	var r = SeedingGoalLeft{Ratio: -1, Time: -1, IdleTime: -1}
+
+	if l.Ratio > 0 {
+		r.Ratio = max(l.Ratio-p.ratio, 0)
+	}
+
+	if l.Time > 0 {
+		r.Time = max(l.Time-p.seedingTime, 0)
+	}
+
+	if l.IdleTime > 0 {
+		r.IdleTime = max(l.IdleTime-p.idleTime, 0)
+	}
+
+	return r
+}
+
+func (l SeedingLimits) reached(p seedingProgress) bool {
+	left := l.left(p)
+
+	return left.Ratio == 0 || left.Time == 0 || left.IdleTime == 0
+}
+
+func (c *Client) globalSeedingLimits() SeedingLimits {
+	app := &c.Config.App
+
+	return SeedingLimits{
+		Action:   SeedingAction(app.SeedLimitAction),
+		Ratio:    app.SeedRatioLimit,
+		Time:     time.Duration(app.SeedTimeLimit) * time.Second,
+		IdleTime: time.Duration(app.SeedIdleLimit) * time.Second,
+	}
+}
+
+// getSeedingLimits return limits of download, or global limits if not set.
+// must be called with d.m locked.
+func (d *Download) getSeedingLimits() SeedingLimits {
+	if d.seedingLimits != nil {
+		return *d.seedingLimits
+	}
+
+	return d.c.globalSeedingLimits()
+}
+
+// seedingProgress must be called with d.m locked.
+// Ratio is based on wanted size if torrent is not downloaded by us.
+func (d *Download) seedingProgress(now time.Time) seedingProgress {
+	_, completed := d.wantedProgress()
+
+	var p = seedingProgress{
+		seedingTime: time.Duration(d.seedingTime.Load()) * time.Second,
+	}
+
+	if base := max(d.downloaded.Load(), completed); base > 0 {
+		p.ratio = float64(d.uploaded.Load()) / float64(base)
+	}
+
+	if d.state == Uploading {
+		p.idleTime = now.Sub(time.Unix(d.lastUploadAt.Load(), 0))
+	}
+
+	return p
+}
+
+func (c *Client) SetSeedingLimits(h meta.Hash, limits *SeedingLimits) error {
+	d, err := c.getDownload(h)
+	if err != nil {
+		return err
+	}
+
+	d.m.Lock()
+	d.seedingLimits = limits
+	d.m.Unlock()
+
+	return nil
+}
+
+func (c *Client) backgroundSeedingGoal() {
+	ticker := time.NewTicker(seedingGoalInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.checkSeedingGoal(now, now.Sub(last))
+			last = now
+		}
+	}
+}
+
+// checkSeedingGoal add seeding time to seeding torrents, and run action if any goal is reached.
+func (c *Client) checkSeedingGoal(now time.Time, elapsed time.Duration) {
+	c.m.RLock()
+	downloads := slices.Clone(c.downloads)
+	c.m.RUnlock()
+
+	for _, d := range downloads {
+		d.m.RLock()
+		if d.state != Uploading {
+			d.m.RUnlock()
+			continue
+		}
+
+		seedingTime := d.seedingTime.Add(int64(elapsed.Seconds()))
+		limits := d.getSeedingLimits()
+		reached := limits.reached(d.seedingProgress(now))
+		d.m.RUnlock()
+
+		if !reached {
+			continue
+		}
+
+		d.log.Info().
+			Str("action", string(limits.Action)).
+			Stringer("seeding_time", time.Duration(seedingTime)*time.Second).
+			Msg("seeding goal reached")
+
+		var err error
+		switch limits.Action {
+		case SeedingActionRemove:
+			err = c.RemoveDownload(d.info.Hash, false)
+		case SeedingActionRemoveData:
+			err = c.RemoveDownload(d.info.Hash, true)
+		case SeedingActionStop:
+			fallthrough
+		default:
+			err = d.Stop()
+		}
+
+		if err != nil {
+			d.log.Err(err).Msg("failed to run seeding goal action")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedingLimitsLeft(t *testing.T) {
+	l := SeedingLimits{Ratio: 2, Time: time.Hour}
+	p := seedingProgress{ratio: 0.5, seedingTime: time.Minute * 20, idleTime: time.Hour * 10}
+
+	require.Equal(t, SeedingGoalLeft{Ratio: 1.5, Time: time.Minute * 40, IdleTime: -1}, l.left(p))
+	require.False(t, l.reached(p), "idle time is unlimited")
+
+	p.seedingTime = time.Hour * 2
+	require.Equal(t, time.Duration(0), l.left(p).Time)
+	require.True(t, l.reached(p))
+
+	require.False(t, SeedingLimits{}.reached(p), "no limit")
+}
+
+func TestCheckSeedingGoal(t *testing.T) {
+	d, _ := newTestDownload(t)
+	c := d.c
+
+	c.downloadMap[d.info.Hash] = d
+	c.downloads = append(c.downloads, d)
+
+	d.bm.Fill()
+	d.state = Uploading
+	d.uploaded.Store(d.info.TotalLength)
+	d.lastUploadAt.Store(time.Now().Unix())
+	d.seedingLimits = &SeedingLimits{Action: SeedingActionStop, Ratio: 2}
+
+	c.checkSeedingGoal(time.Now(), time.Minute)
+	require.Equal(t, Uploading, d.getState())
+	require.EqualValues(t, 60, d.seedingTime.Load())
+	require.InDelta(t, 1, d.Status().SeedingGoalLeft.Ratio, 0.0001)
+
+	d.uploaded.Store(d.info.TotalLength * 2)
+	c.checkSeedingGoal(time.Now(), time.Minute)
+	require.Equal(t, Stopped, d.getState())
+}
+
+func TestSeedingLimitsResume(t *testing.T) {
+	d, _ := newTestDownload(t)
+
+	d.seedingTime.Store(100)
+	d.seedingLimits = &SeedingLimits{Action: SeedingActionRemove, Ratio: 1.25, IdleTime: time.Hour}
+
+	b, err := d.MarshalBinary()
+	require.NoError(t, err)
+
+	d.seedingTime.Store(0)
+	d.seedingLimits = nil
+	require.NoError(t, d.UnmarshalBinary(b))
+	require.EqualValues(t, 100, d.seedingTime.Load())
+	require.Equal(t, &SeedingLimits{Action: SeedingActionRemove, Ratio: 1.25, IdleTime: time.Hour}, d.seedingLimits)
+
+	d.seedingLimits = nil
+	b, err = d.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, d.UnmarshalBinary(b))
+	require.Nil(t, d.seedingLimits)
+}
+
+func TestGlobalSeedingLimits(t *testing.T) {
+	d, _ := newTestDownload(t)
+
+	d.c.Config.App.SeedTimeLimit = 3600
+	d.c.Config.App.SeedIdleLimit = 60
+	d.c.Config.App.SeedLimitAction = "remove"
+
+	require.Equal(t, SeedingLimits{Action: SeedingActionRemove, Time: time.Hour, IdleTime: time.Minute}, d.c.globalSeedingLimits())
+}
@@ -0,0 +1,317 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"tyr/internal/pkg/global/tasks"
+)
+
+type stateEvent uint8
+
+const (
+	// user start a stopped download
+	eventStart stateEvent = iota
+	// user stop an active download
+	eventStop
+	// user request rehash
+	eventCheck
+	// rehash finished
+	eventChecked
+	// metadata of magnet link fetched, need to check existing files
+	eventMetadataFetched
+	// all wanted pieces are downloaded
+	eventCompleted
+	// skipped files become wanted after download is completed
+	eventIncomplete
+	eventMove
+	eventMoved
+	// download encounter an io error
+	eventFail
+	// user resume download from error, all pieces will be checked again
+	eventResume
+	// queue manager start a queued download or checking
+	eventDequeue
+	// queue manager pause an active download because of queue limit
+	eventQueue
+)
+
+func (e stateEvent) String() string {
+	switch e {
+	case eventStart:
+		return "start"
+	case eventStop:
+		return "stop"
+	case eventCheck:
+		return "check"
+	case eventChecked:
+		return "checked"
+	case eventMetadataFetched:
+		return "metadata fetched"
+	case eventCompleted:
+		return "completed"
+	case eventIncomplete:
+		return "incomplete"
+	case eventMove:
+		return "move"
+	case eventMoved:
+		return "moved"
+	case eventFail:
+		return "fail"
+	case eventResume:
+		return "resume"
+	case eventDequeue:
+		return "dequeue"
+	case eventQueue:
+		return "queue"
+	}
+
+	return fmt.Sprintf("stateEvent(%d)", e)
+}
+
+// stateContext is what we need to know about a download to decide next state.
+type stateContext struct {
+	// state before moving
+	beforeMove  State
+	hasMetadata bool
+	completed   bool
+	// download is stopped before checking, keep it stopped after checking
+	stopAfterCheck bool
+	// download is stopped before checking, check it again when started
+	checkPending bool
+}
+
+// activeState is the state when download is started.
+func (c stateContext) activeState() State {
+	if !c.hasMetadata {
+		return FetchingMetadata
+	}
+
+	if c.completed {
+		return Uploading
+	}
+
+	return Downloading
+}
+
+func (d *Download) getState() State {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	return d.state
+}
+
+func isActive(s State) bool {
+	switch s {
+	case Downloading, Uploading, FetchingMetadata:
+		return true
+	case Stopped, Checking, Moving, Error, CheckQueued, Queued:
+	}
+
+	return false
+}
+
+// nextState return the state after event happened, or error if event is not allowed in current state.
+// Started downloads and checking wait in queue, until queue manager dequeue them.
+func nextState(from State, e stateEvent, c stateContext) (State, error) {
+	switch e {
+	case eventStart:
+		if from == Stopped {
+			if c.checkPending {
+				return CheckQueued, nil
+			}
+			return Queued, nil
+		}
+	case eventStop:
+		if isActive(from) || from == Queued || from == CheckQueued {
+			return Stopped, nil
+		}
+	case eventCheck:
+		if c.hasMetadata && (from == Stopped || from == Queued || from == Downloading || from == Uploading) {
+			return CheckQueued, nil
+		}
+	case eventChecked:
+		if from == Checking {
+			if c.stopAfterCheck {
+				return Stopped, nil
+			}
+			return Queued, nil
+		}
+	case eventMetadataFetched:
+		if from == FetchingMetadata {
+			return CheckQueued, nil
+		}
+	case eventCompleted:
+		if from == Downloading {
+			return Uploading, nil
+		}
+	case eventIncomplete:
+		if from == Uploading {
+			return Downloading, nil
+		}
+	case eventMove:
+		if c.hasMetadata && (from == Stopped || from == Queued || from == Downloading || from == Uploading) {
+			return Moving, nil
+		}
+	case eventMoved:
+		if from == Moving {
+			return c.beforeMove, nil
+		}
+	case eventFail:
+		if from != Error {
+			return Error, nil
+		}
+	case eventResume:
+		if from == Error {
+			if !c.hasMetadata {
+				return Queued, nil
+			}
+			return CheckQueued, nil
+		}
+	case eventDequeue:
+		if from == Queued {
+			return c.activeState(), nil
+		}
+		if from == CheckQueued {
+			return Checking, nil
+		}
+	case eventQueue:
+		if isActive(from) {
+			return Queued, nil
+		}
+	}
+
+	return from, fmt.Errorf("can't %s download in state %s", e, from)
+}
+
+// fire trigger a state transition and run hooks of states.
+func (d *Download) fire(e stateEvent) error {
+	d.m.Lock()
+	from := d.state
+	to, err := nextState(from, e, stateContext{
+		hasMetadata:    d.hasMetadata(),
+		completed:      d.isCompleted(),
+		stopAfterCheck: d.stopAfterCheck,
+		checkPending:   d.hasMetadata() && !d.verified.Load(),
+		beforeMove:     d.beforeMove,
+	})
+	if err != nil {
+		d.m.Unlock()
+		return err
+	}
+
+	d.state = to
+
+	switch to {
+	case CheckQueued:
+		d.stopAfterCheck = from == Stopped && e == eventCheck
+		d.verified.Store(false)
+	case Moving:
+		d.beforeMove = from
+	case Downloading, Uploading, FetchingMetadata, Stopped, Error, Checking, Queued:
+	}
+
+	if from == Error {
+		d.err = nil
+	}
+	d.m.Unlock()
+
+	d.log.Debug().Msgf("state %s -> %s on %s", from, to, e)
+	d.c.publish(ClientEvent{Type: EventStateChanged, InfoHash: d.info.Hash, From: from, To: to})
+
+	d.cond.Broadcast()
+	d.notifyPiece()
+
+	d.onExitState(from, to)
+	d.onEnterState(from, to, e)
+
+	// a slot may be freed or a download is waiting
+	d.c.notifyQueue()
+
+	return nil
+}
+
+func (d *Download) onExitState(from, to State) {
+	if isActive(from) && !isActive(to) {
+		d.closePeers()
+		d.ioDown.Reset()
+		d.ioUp.Reset()
+	}
+}
+
+func (d *Download) onEnterState(from, to State, e stateEvent) {
+	switch to {
+	case Checking:
+		tasks.Submit(d.task(d.check))
+	case Stopped, Queued:
+		if isActive(from) {
+			tasks.Submit(d.announceStopped)
+		}
+	case Uploading:
+		// idle seeding time is counted from start of seeding
+		d.lastUploadAt.Store(time.Now().Unix())
+
+		if e == eventCompleted {
+			d.CompletedAt.Store(time.Now().Unix())
+			d.c.publish(ClientEvent{Type: EventDownloadFinished, InfoHash: d.info.Hash})
+			tasks.Submit(func() {
+				d.AsyncAnnounce(EventCompleted)
+			})
+			return
+		}
+	case Downloading, FetchingMetadata, Moving, Error, CheckQueued:
+	}
+
+	if isActive(to) && !isActive(from) {
+		d.activeAt.Store(time.Now().Unix())
+		tasks.Submit(func() {
+			d.AsyncAnnounce(EventStarted)
+		})
+	}
+}
+
+// check rehash pieces, run on entering Checking state.
+// Pieces are not checked again if files are not changed since resume data is saved.
+func (d *Download) check() {
+	if d.resumeValid() {
+		d.log.Debug().Msg("files not changed, skip checking")
+	} else {
+		d.verified.Store(false)
+		d.bm.Clear()
+		if err := d.initCheck(); err != nil {
+			d.log.Err(err).Msg("failed to check torrent data")
+			d.setError(err)
+			return
+		}
+	}
+
+	d.verified.Store(true)
+
+	d.ioDown.Reset()
+
+	_, completed := d.wantedProgress()
+	d.log.Debug().Msgf("done size %s", humanize.IBytes(uint64(completed)))
+
+	d.m.Lock()
+	d.resume = nil
+	d.m.Unlock()
+
+	d.notifyPiece()
+
+	if err := d.fire(eventChecked); err != nil {
+		d.log.Warn().Err(err).Msg("failed to finish checking")
+	}
+}
+
+// setError stop downloading/uploading, download can be resumed by Resume.
+func (d *Download) setError(err error) {
+	d.m.Lock()
+	d.err = err
+	d.m.Unlock()
+
+	d.c.publish(ClientEvent{Type: EventError, InfoHash: d.info.Hash, Message: err.Error()})
+
+	_ = d.fire(eventFail)
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextState(t *testing.T) {
+	var downloading = stateContext{hasMetadata: true}
+	var completed = stateContext{hasMetadata: true, completed: true}
+	var magnet = stateContext{}
+
+	testCases := []struct {
+		name  string
+		from  State
+		event stateEvent
+		ctx   stateContext
+		to    State
+		err   bool
+	}{
+		{name: "start", from: Stopped, event: eventStart, ctx: downloading, to: Queued},
+		{
+			name:  "start check pending",
+			from:  Stopped,
+			event: eventStart,
+			ctx:   stateContext{hasMetadata: true, checkPending: true},
+			to:    CheckQueued,
+		},
+		{name: "start magnet", from: Stopped, event: eventStart, ctx: magnet, to: Queued},
+		{name: "start queued", from: Queued, event: eventStart, ctx: downloading, err: true},
+		{name: "start active", from: Downloading, event: eventStart, ctx: downloading, err: true},
+		{name: "start error", from: Error, event: eventStart, ctx: downloading, err: true},
+
+		{name: "stop downloading", from: Downloading, event: eventStop, ctx: downloading, to: Stopped},
+		{name: "stop uploading", from: Uploading, event: eventStop, ctx: completed, to: Stopped},
+		{name: "stop fetching metadata", from: FetchingMetadata, event: eventStop, ctx: magnet, to: Stopped},
+		{name: "stop stopped", from: Stopped, event: eventStop, ctx: downloading, err: true},
+		{name: "stop checking", from: Checking, event: eventStop, ctx: downloading, err: true},
+		{name: "stop moving", from: Moving, event: eventStop, ctx: downloading, err: true},
+		{name: "stop queued", from: Queued, event: eventStop, ctx: downloading, to: Stopped},
+		{name: "stop check queued", from: CheckQueued, event: eventStop, ctx: downloading, to: Stopped},
+
+		{name: "check stopped", from: Stopped, event: eventCheck, ctx: downloading, to: CheckQueued},
+		{name: "check downloading", from: Downloading, event: eventCheck, ctx: downloading, to: CheckQueued},
+		{name: "check uploading", from: Uploading, event: eventCheck, ctx: completed, to: CheckQueued},
+		{name: "check queued", from: Queued, event: eventCheck, ctx: downloading, to: CheckQueued},
+		{name: "check check queued", from: CheckQueued, event: eventCheck, ctx: downloading, err: true},
+		{name: "check checking", from: Checking, event: eventCheck, ctx: downloading, err: true},
+		{name: "check moving", from: Moving, event: eventCheck, ctx: downloading, err: true},
+		{name: "check without metadata", from: FetchingMetadata, event: eventCheck, ctx: magnet, err: true},
+
+		{name: "checked", from: Checking, event: eventChecked, ctx: downloading, to: Queued},
+		{
+			name:  "checked keep stopped",
+			from:  Checking,
+			event: eventChecked,
+			ctx:   stateContext{hasMetadata: true, stopAfterCheck: true},
+			to:    Stopped,
+		},
+		{name: "checked not checking", from: Downloading, event: eventChecked, ctx: downloading, err: true},
+
+		{name: "metadata fetched", from: FetchingMetadata, event: eventMetadataFetched, ctx: downloading, to: CheckQueued},
+		{name: "metadata fetched stopped", from: Stopped, event: eventMetadataFetched, ctx: downloading, err: true},
+
+		{name: "completed", from: Downloading, event: eventCompleted, ctx: completed, to: Uploading},
+		{name: "completed stopped", from: Stopped, event: eventCompleted, ctx: completed, err: true},
+
+		{name: "incomplete", from: Uploading, event: eventIncomplete, ctx: downloading, to: Downloading},
+		{name: "incomplete stopped", from: Stopped, event: eventIncomplete, ctx: downloading, err: true},
+
+		{name: "move stopped", from: Stopped, event: eventMove, ctx: downloading, to: Moving},
+		{name: "move uploading", from: Uploading, event: eventMove, ctx: completed, to: Moving},
+		{name: "move checking", from: Checking, event: eventMove, ctx: downloading, err: true},
+		{name: "move moving", from: Moving, event: eventMove, ctx: downloading, err: true},
+		{name: "move magnet", from: FetchingMetadata, event: eventMove, ctx: magnet, err: true},
+		{
+			name:  "moved",
+			from:  Moving,
+			event: eventMoved,
+			ctx:   stateContext{hasMetadata: true, beforeMove: Uploading},
+			to:    Uploading,
+		},
+
+		{name: "fail downloading", from: Downloading, event: eventFail, ctx: downloading, to: Error},
+		{name: "fail checking", from: Checking, event: eventFail, ctx: downloading, to: Error},
+		{name: "fail moving", from: Moving, event: eventFail, ctx: downloading, to: Error},
+		{name: "fail error", from: Error, event: eventFail, ctx: downloading, err: true},
+
+		{name: "resume", from: Error, event: eventResume, ctx: downloading, to: CheckQueued},
+		{name: "resume magnet", from: Error, event: eventResume, ctx: magnet, to: Queued},
+		{name: "resume stopped", from: Stopped, event: eventResume, ctx: downloading, err: true},
+
+		{name: "dequeue", from: Queued, event: eventDequeue, ctx: downloading, to: Downloading},
+		{name: "dequeue completed", from: Queued, event: eventDequeue, ctx: completed, to: Uploading},
+		{name: "dequeue magnet", from: Queued, event: eventDequeue, ctx: magnet, to: FetchingMetadata},
+		{name: "dequeue checking", from: CheckQueued, event: eventDequeue, ctx: downloading, to: Checking},
+		{name: "dequeue stopped", from: Stopped, event: eventDequeue, ctx: downloading, err: true},
+
+		{name: "queue downloading", from: Downloading, event: eventQueue, ctx: downloading, to: Queued},
+		{name: "queue uploading", from: Uploading, event: eventQueue, ctx: completed, to: Queued},
+		{name: "queue stopped", from: Stopped, event: eventQueue, ctx: downloading, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			to, err := nextState(tc.from, tc.event, tc.ctx)
+			if tc.err {
+				require.Error(t, err)
+				require.Equal(t, tc.from, to)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.to, to)
+		})
+	}
+}
+
+func TestIsActive(t *testing.T) {
+	testCases := []struct {
+		state  State
+		active bool
+	}{
+		{state: Stopped},
+		{state: Downloading, active: true},
+		{state: Uploading, active: true},
+		{state: Checking},
+		{state: Moving},
+		{state: Error},
+		{state: FetchingMetadata, active: true},
+		{state: CheckQueued},
+		{state: Queued},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.state.String(), func(t *testing.T) {
+			require.Equal(t, tc.active, isActive(tc.state))
+		})
+	}
+}
+
+func TestStopCheckQueued(t *testing.T) {
+	d, _ := newTestDownload(t)
+	d.state = CheckQueued
+
+	require.NoError(t, d.fire(eventStop))
+	require.Equal(t, Stopped, d.getState())
+	require.False(t, d.verified.Load())
+
+	// data is not checked yet, check it before downloading
+	require.NoError(t, d.fire(eventStart))
+	require.Equal(t, CheckQueued, d.getState())
+	require.False(t, d.stopAfterCheck)
+}
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"tyr/internal/meta"
+)
+
+// DownloadStatus is a snapshot of download, used by web api.
+// WantedLength is total size of files not skipped, Completed, Left and Progress are based on it.
+// ETA is in seconds, -1 if download will never complete at current rate.
+// Blocked is connections refused or closed by ip filter or ban list.
+// InfoHashV2 is zero for v1 torrent.
+// SeedingLimits is limits in use, GlobalSeedingLimits is true if torrent doesn't have its own limits.
+type DownloadStatus struct {
+	AddAt               time.Time
+	CompletedAt         time.Time
+	SeedingLimits       SeedingLimits
+	SeedingGoalLeft     SeedingGoalLeft
+	Name                string
+	DownloadDir         string
+	Category            string
+	Error               string
+	Tags                []string
+	TotalLength         int64
+	WantedLength        int64
+	Completed           int64
+	Left                int64
+	Downloaded          int64
+	Uploaded            int64
+	DownloadRate        int64
+	UploadRate          int64
+	DownloadLimit       int64
+	UploadLimit         int64
+	ETA                 int64
+	Blocked             int64
+	SeedingTime         time.Duration
+	Progress            float64
+	Ratio               float64
+	Peers               int
+	Seeds               int
+	TrackerSeeders      int
+	TrackerLeechers     int
+	QueuePosition       int
+	InfoHashV2          meta.HashV2
+	InfoHash            meta.Hash
+	State               State
+	Sequential          bool
+	GlobalSeedingLimits bool
+}
+
+// left return bytes of wanted files not downloaded yet.
+func (d *Download) left() int64 {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	wanted, completed := d.wantedProgress()
+
+	return wanted - completed
+}
+
+func (d *Download) Status() DownloadStatus {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	wanted, completed := d.wantedProgress()
+
+	s := DownloadStatus{
+		InfoHash:      d.info.Hash,
+		InfoHashV2:    d.info.HashV2,
+		Name:          d.info.Name,
+		State:         d.state,
+		DownloadDir:   d.basePath,
+		Tags:          slices.Clone(d.tags),
+		Category:      d.category,
+		TotalLength:   d.info.TotalLength,
+		WantedLength:  wanted,
+		Completed:     completed,
+		Left:          wanted - completed,
+		Downloaded:    d.downloaded.Load(),
+		Uploaded:      d.uploaded.Load(),
+		DownloadRate:  d.ioDown.Status().CurRate,
+		UploadRate:    d.ioUp.Status().CurRate,
+		DownloadLimit: d.downLimiter.Rate(),
+		UploadLimit:   d.upLimiter.Rate(),
+		AddAt:         time.Unix(d.AddAt, 0),
+		ETA:           -1,
+		Sequential:    d.seq.Load(),
+		QueuePosition: int(d.queuePosition.Load()),
+		Blocked:       d.blocked.Load(),
+	}
+
+	if at := d.CompletedAt.Load(); at != 0 {
+		s.CompletedAt = time.Unix(at, 0)
+	}
+
+	seeding := d.seedingProgress(time.Now())
+	s.Ratio = seeding.ratio
+	s.SeedingTime = seeding.seedingTime
+	s.SeedingLimits = d.getSeedingLimits()
+	s.GlobalSeedingLimits = d.seedingLimits == nil
+	s.SeedingGoalLeft = s.SeedingLimits.left(seeding)
+
+	if d.err != nil {
+		s.Error = d.err.Error()
+	}
+
+	if wanted != 0 {
+		s.Progress = float64(completed) / float64(wanted)
+	}
+
+	if s.Left == 0 && wanted != 0 {
+		s.ETA = 0
+	} else if s.DownloadRate > 0 {
+		s.ETA = s.Left / s.DownloadRate
+	}
+
+	d.conn.Range(func(_ netip.AddrPort, p *Peer) bool {
+		s.Peers++
+		if d.info.NumPieces != 0 && p.Bitmap.Count() == d.info.NumPieces {
+			s.Seeds++
+		}
+
+		return true
+	})
+
+	for _, tier := range d.trackers {
+		for _, t := range tier.trackers {
+			t.RLock()
+			s.TrackerSeeders = max(s.TrackerSeeders, t.seeders)
+			s.TrackerLeechers = max(s.TrackerLeechers, t.leechers)
+			t.RUnlock()
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,313 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/docker/go-units"
+
+	"tyr/internal/meta"
+	"tyr/internal/pkg/empty"
+	"tyr/internal/proto"
+)
+
+// pieces after read position are downloaded first, so player won't wait for every piece.
+const streamReadAhead = 8 * units.MiB
+
+// pieceRange is pieces [start, end] wanted by a stream reader.
+type pieceRange struct {
+	start uint32
+	end   uint32
+}
+
+// FileReader read a file of torrent, block until pieces are downloaded and verified.
+// Pieces at read position and read-ahead are downloaded before any other pieces.
+type FileReader struct {
+	ctx    context.Context
+	d      *Download
+	file   meta.File
+	index  int
+	start  int64
+	offset int64
+	closed bool
+}
+
+var _ io.ReadSeekCloser = (*FileReader)(nil)
+
+var errInvalidWhence = errors.New("invalid whence")
+
+// ErrTorrentNotActive is returned when reading pieces of torrent not downloading, they will never be available.
+var ErrTorrentNotActive = errors.New("torrent is not started")
+
+func (c *Client) OpenFile(ctx context.Context, h meta.Hash, index int) (*FileReader, error) {
+	d, err := c.getDownload(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.OpenFile(ctx, index)
+}
+
+// OpenFile open a file for streaming, skipped file become wanted until reader is closed.
+// Reading is aborted when ctx is canceled, or missing pieces can't be downloaded because torrent is not started.
+func (d *Download) OpenFile(ctx context.Context, index int) (*FileReader, error) {
+	if !d.hasMetadata() {
+		return nil, errNoMetadata
+	}
+
+	if index < 0 || index >= len(d.info.Files) {
+		return nil, fmt.Errorf("file index %d out of range", index)
+	}
+
+	if d.info.Files[index].Pad {
+		return nil, fmt.Errorf("file %d is a pad file", index)
+	}
+
+	var start int64
+	for _, f := range d.info.Files[:index] {
+		start += f.Length
+	}
+
+	r := &FileReader{ctx: ctx, d: d, index: index, file: d.info.Files[index], start: start}
+
+	if !d.streamAvailable() && !d.rangeCompleted(start, r.file.Length) {
+		return nil, ErrTorrentNotActive
+	}
+
+	if err := d.acquireStreamFile(index); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// acquireStreamFile make skipped file wanted while it's read by stream readers.
+func (d *Download) acquireStreamFile(index int) error {
+	d.priorityMutex.Lock()
+	if d.filePriority[index] != FilePrioritySkip && d.streamFiles[index] == 0 {
+		d.priorityMutex.Unlock()
+		return nil
+	}
+
+	d.streamFiles[index]++
+	raise := d.streamFiles[index] == 1
+	d.priorityMutex.Unlock()
+
+	if !raise {
+		return nil
+	}
+
+	if err := d.changeFilePriority([]int{index}, FilePriorityNormal); err != nil {
+		d.releaseStreamFile(index)
+		return err
+	}
+
+	return nil
+}
+
+// releaseStreamFile skip file again after the last stream reader of it is closed.
+func (d *Download) releaseStreamFile(index int) {
+	d.priorityMutex.Lock()
+	n, ok := d.streamFiles[index]
+	if !ok {
+		// priority is changed by user
+		d.priorityMutex.Unlock()
+		return
+	}
+
+	if n > 1 {
+		d.streamFiles[index] = n - 1
+		d.priorityMutex.Unlock()
+		return
+	}
+
+	delete(d.streamFiles, index)
+	d.priorityMutex.Unlock()
+
+	if err := d.changeFilePriority([]int{index}, FilePrioritySkip); err != nil {
+		d.log.Warn().Err(err).Msgf("failed to skip file %d after streaming", index)
+	}
+}
+
+// streamAvailable return false if missing pieces won't be downloaded in current state.
+func (d *Download) streamAvailable() bool {
+	switch d.getState() {
+	case Downloading, Uploading, FetchingMetadata, Checking, CheckQueued, Moving:
+		return true
+	case Stopped, Error, Queued:
+	}
+
+	return false
+}
+
+// rangeCompleted check if all pieces containing bytes [offset, offset+length) of torrent are downloaded.
+func (d *Download) rangeCompleted(offset, length int64) bool {
+	if length == 0 {
+		return true
+	}
+
+	for i := uint32(offset / d.info.PieceLength); i <= uint32((offset+length-1)/d.info.PieceLength); i++ {
+		if !d.bm.Get(i) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *FileReader) Name() string {
+	return r.file.Path
+}
+
+func (r *FileReader) Size() int64 {
+	return r.file.Length
+}
+
+func (r *FileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.file.Length
+	default:
+		return r.offset, errInvalidWhence
+	}
+
+	if offset < 0 {
+		return r.offset, fmt.Errorf("negative offset %d", offset)
+	}
+
+	r.offset = offset
+
+	return offset, nil
+}
+
+// Read read data in one piece at current offset.
+func (r *FileReader) Read(p []byte) (int, error) {
+	if r.offset >= r.file.Length {
+		return 0, io.EOF
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	pos := r.start + r.offset
+	index := uint32(pos / r.d.info.PieceLength)
+
+	last := uint32((min(pos+streamReadAhead, r.start+r.file.Length) - 1) / r.d.info.PieceLength)
+	r.d.setStreamRange(r, pieceRange{start: index, end: last})
+
+	if err := r.d.waitPiece(r.ctx, index); err != nil {
+		return 0, err
+	}
+
+	begin := pos - int64(index)*r.d.info.PieceLength
+	n := min(int64(len(p)), r.d.pieceLength(index)-begin, r.file.Length-r.offset)
+
+	data, err := r.d.readChunk(proto.ChunkRequest{PieceIndex: index, Begin: uint32(begin), Length: uint32(n)})
+	if err != nil {
+		return 0, err
+	}
+
+	copy(p, data)
+	r.offset += n
+
+	return int(n), nil
+}
+
+// Close stop raising priority of pieces for this reader, skipped file is skipped again.
+func (r *FileReader) Close() error {
+	if r.closed {
+		return nil
+	}
+
+	r.closed = true
+
+	r.d.streamMutex.Lock()
+	delete(r.d.streams, r)
+	r.d.streamMutex.Unlock()
+
+	r.d.releaseStreamFile(r.index)
+
+	return nil
+}
+
+func (d *Download) setStreamRange(r *FileReader, pr pieceRange) {
+	d.streamMutex.Lock()
+	d.streams[r] = pr
+	d.streamMutex.Unlock()
+}
+
+// streamPieces return missing pieces wanted by stream readers, in order.
+func (d *Download) streamPieces() []uint32 {
+	d.streamMutex.Lock()
+	defer d.streamMutex.Unlock()
+
+	var r []uint32
+	for _, pr := range d.streams {
+		for i := pr.start; i <= pr.end; i++ {
+			if !d.bm.Get(i) {
+				r = append(r, i)
+			}
+		}
+	}
+
+	slices.Sort(r)
+
+	return slices.Compact(r)
+}
+
+// waitPiece block until piece is downloaded or ctx is canceled,
+// readers are also woken up on state change, to stop waiting if torrent is stopped.
+func (d *Download) waitPiece(ctx context.Context, index uint32) error {
+	for {
+		d.streamMutex.Lock()
+		ch := d.pieceNotify
+		d.streamMutex.Unlock()
+
+		if d.bm.Get(index) {
+			return nil
+		}
+
+		if !d.streamAvailable() {
+			return ErrTorrentNotActive
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-d.ctx.Done():
+			return d.ctx.Err()
+		case <-ch:
+		}
+	}
+}
+
+// notifyPiece wake up stream readers waiting for pieces.
+func (d *Download) notifyPiece() {
+	d.streamMutex.Lock()
+	close(d.pieceNotify)
+	d.pieceNotify = make(chan empty.Empty)
+	d.streamMutex.Unlock()
+}
+
+// SetSequential enable or disable downloading pieces in order.
+func (d *Download) SetSequential(seq bool) {
+	d.seq.Store(seq)
+}
+
+func (c *Client) SetSequential(h meta.Hash, seq bool) error {
+	d, err := c.getDownload(h)
+	if err != nil {
+		return err
+	}
+
+	d.SetSequential(seq)
+
+	return nil
+}
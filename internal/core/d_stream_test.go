@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileReader(t *testing.T) {
+	d, data := newTestDownload(t)
+
+	for index := uint32(0); index < d.info.NumPieces; index++ {
+		writeTestPiece(t, d, data, index)
+	}
+
+	f, err := d.OpenFile(context.Background(), 1)
+	require.NoError(t, err)
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, data[20000:50000], b)
+
+	_, err = f.Seek(-100, io.SeekEnd)
+	require.NoError(t, err)
+
+	b, err = io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, data[49900:50000], b)
+}
+
+func TestFileReaderWaitPiece(t *testing.T) {
+	d, data := newTestDownload(t)
+	d.setFilePriority([]FilePriority{FilePriorityNormal, FilePriorityNormal, FilePrioritySkip})
+
+	f, err := d.OpenFile(context.Background(), 2)
+	require.NoError(t, err)
+	defer f.Close()
+
+	require.Equal(t, FilePriorityNormal, d.getFilePriority(2), "streamed file should be wanted")
+
+	var done = make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(f)
+		done <- b
+	}()
+
+	require.Eventually(t, func() bool {
+		return len(d.streamPieces()) != 0
+	}, time.Second, time.Millisecond*10)
+
+	require.Equal(t, []uint32{3}, d.streamPieces())
+	require.Equal(t, uint32(3), d.pieceCandidates()[0], "stream pieces should be picked first")
+
+	writeTestPiece(t, d, data, 3)
+	d.notifyPiece()
+
+	select {
+	case b := <-done:
+		require.Equal(t, data[50000:], b)
+	case <-time.After(time.Second):
+		t.Fatal("reader is not woken up after piece is downloaded")
+	}
+}
+
+func TestFileReaderCancel(t *testing.T) {
+	d, _ := newTestDownload(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	f, err := d.OpenFile(ctx, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.Read(make([]byte, 10))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestFileReaderRestorePriority(t *testing.T) {
+	d, _ := newTestDownload(t)
+	d.setFilePriority([]FilePriority{FilePriorityNormal, FilePriorityNormal, FilePrioritySkip})
+
+	a, err := d.OpenFile(context.Background(), 2)
+	require.NoError(t, err)
+
+	b, err := d.OpenFile(context.Background(), 2)
+	require.NoError(t, err)
+
+	require.Equal(t, FilePriorityNormal, d.getFilePriority(2))
+	require.Equal(t, FilePrioritySkip, d.savedFilePriorities()[2], "streamed file is not saved as wanted")
+
+	require.NoError(t, a.Close())
+	require.NoError(t, a.Close())
+	require.Equal(t, FilePriorityNormal, d.getFilePriority(2), "file is still streamed")
+
+	require.NoError(t, b.Close())
+	require.Equal(t, FilePrioritySkip, d.getFilePriority(2))
+
+	// priority set by user while streaming is kept
+	c, err := d.OpenFile(context.Background(), 2)
+	require.NoError(t, err)
+	require.NoError(t, d.SetFilePriority([]int{2}, FilePriorityHigh))
+	require.NoError(t, c.Close())
+	require.Equal(t, FilePriorityHigh, d.getFilePriority(2))
+}
+
+func TestFileReaderNotActive(t *testing.T) {
+	d, data := newTestDownload(t)
+
+	writeTestPiece(t, d, data, 0)
+	writeTestPiece(t, d, data, 1)
+	d.state = Stopped
+
+	_, err := d.OpenFile(context.Background(), 2)
+	require.ErrorIs(t, err, ErrTorrentNotActive)
+
+	f, err := d.OpenFile(context.Background(), 0)
+	require.NoError(t, err, "downloaded file can be read")
+	defer f.Close()
+
+	b := make([]byte, 100)
+	_, err = io.ReadFull(f, b)
+	require.NoError(t, err)
+	require.Equal(t, data[:100], b)
+
+	d.state = Downloading
+
+	g, err := d.OpenFile(context.Background(), 2)
+	require.NoError(t, err)
+	defer g.Close()
+
+	var done = make(chan error)
+	go func() {
+		_, err := io.ReadAll(g)
+		done <- err
+	}()
+
+	require.Eventually(t, func() bool { return len(d.streamPieces()) != 0 }, time.Second, time.Millisecond*10)
+	require.NoError(t, d.fire(eventStop))
+
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, ErrTorrentNotActive)
+	case <-time.After(time.Second):
+		t.Fatal("reader is not woken up after torrent is stopped")
+	}
+}
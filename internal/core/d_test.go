@@ -0,0 +1,66 @@
+package core
+
+import (
+	"crypto/sha1"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/config"
+	"tyr/internal/meta"
+)
+
+const testPieceLength = 16 * 1024
+
+// newTestDownload create a multi-file download, returns torrent data.
+// pieces: 0 [a], 1 [a, b], 2 [b], 3 [b, c]
+func newTestDownload(t *testing.T) (*Download, []byte) {
+	t.Helper()
+
+	var sizes = []int64{20000, 30000, 15000}
+	var data []byte
+	var info = metainfo.Info{Name: "t", PieceLength: testPieceLength}
+
+	for i, size := range sizes {
+		for j := int64(0); j < size; j++ {
+			data = append(data, byte(i*7+int(j)))
+		}
+
+		info.Files = append(info.Files, metainfo.FileInfo{Path: []string{string(rune('a' + i))}, Length: size})
+	}
+
+	for offset := 0; offset < len(data); offset += testPieceLength {
+		h := sha1.Sum(data[offset:min(offset+testPieceLength, len(data))])
+		info.Pieces = append(info.Pieces, h[:]...)
+	}
+
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+
+	m := &metainfo.MetaInfo{InfoBytes: infoBytes}
+	i, err := meta.FromTorrent(*m)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	c := New(config.Config{}, dir)
+
+	return c.NewDownload(m, i, filepath.Join(dir, "t"), nil), data
+}
+
+func writeTestPiece(t *testing.T, d *Download, data []byte, index uint32) {
+	t.Helper()
+
+	for _, chunk := range d.pieceInfo[index].fileChunks {
+		f, offset, err := d.openChunk(chunk)
+		require.NoError(t, err)
+
+		_, err = f.File.WriteAt(data[chunk.offset:chunk.offset+chunk.length], offset)
+		f.Release()
+		require.NoError(t, err)
+	}
+
+	d.bm.Set(index)
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/valyala/bytebufferpool"
 	"github.com/zeebo/bencode"
 
+	"tyr/internal/meta"
 	"tyr/internal/pkg/null"
 )
 
@@ -67,12 +68,12 @@ type TrackerTier struct {
 
 func (tier TrackerTier) Announce(d *Download, event string) (AnnounceResult, error) {
 	for _, t := range tier.trackers {
-		if event == EventStarted {
-			_ = t.announceStop(d)
-			return AnnounceResult{}, nil
-		}
+		// started/completed event should be sent immediately
+		t.RLock()
+		due := time.Now().After(t.nextAnnounce)
+		t.RUnlock()
 
-		if !time.Now().After(t.nextAnnounce) {
+		if event == "" && !due {
 			return AnnounceResult{}, nil
 		}
 
@@ -82,6 +83,7 @@ func (tier TrackerTier) Announce(d *Download, event string) (AnnounceResult, err
 			t.err = err
 			t.nextAnnounce = time.Now().Add(time.Minute * 30)
 			t.Unlock()
+			d.c.publish(ClientEvent{Type: EventTrackerError, InfoHash: d.infoHashes()[0], Tracker: t.url, Message: err.Error()})
 			continue
 		}
 
@@ -89,6 +91,7 @@ func (tier TrackerTier) Announce(d *Download, event string) (AnnounceResult, err
 			t.Lock()
 			t.err = errors.New(r.FailedReason.Value)
 			t.Unlock()
+			d.c.publish(ClientEvent{Type: EventTrackerError, InfoHash: d.infoHashes()[0], Tracker: t.url, Message: r.FailedReason.Value})
 			return AnnounceResult{}, nil
 		}
 		t.Lock()
@@ -156,29 +159,73 @@ type trackerAnnounceResponse struct {
 type Tracker struct {
 	lastAnnounceTime time.Time
 	nextAnnounce     time.Time
+	lastScrape       time.Time
 	err              error
 	url              string
 	peerCount        int
 	leechers         int
 	seeders          int
+	completed        int
 	sync.RWMutex
 }
 
-func (t *Tracker) req(d *Download) *resty.Request {
+// ScrapeUrl return scrape url of tracker, empty if tracker doesn't support scrape.
+func (t *Tracker) ScrapeUrl() string {
+	return scrapeURL(t.url)
+}
+
+func (t *Tracker) setScrape(seeders, leechers, completed int) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.seeders = seeders
+	t.leechers = leechers
+	t.completed = completed
+	t.lastScrape = time.Now()
+}
+
+func (t *Tracker) req(d *Download, h meta.Hash) *resty.Request {
 	return d.c.http.R().
-		SetQueryParam("info_hash", d.info.Hash.AsString()).
+		SetQueryParam("info_hash", h.AsString()).
 		SetQueryParam("peer_id", d.peerID.AsString()).
 		SetQueryParam("port", strconv.FormatUint(uint64(d.c.Config.App.P2PPort), 10)).
 		SetQueryParam("compat", "1").
 		SetQueryParam("uploaded", strconv.FormatInt(d.uploaded.Load()-d.uploadAtStart, 10)).
 		SetQueryParam("downloaded", strconv.FormatInt(d.downloaded.Load()-d.downloadAtStart, 10)).
-		SetQueryParam("left", strconv.FormatInt(d.info.TotalLength-d.completed.Load(), 10))
+		SetQueryParam("left", strconv.FormatInt(d.left(), 10))
 }
 
+// announce to tracker with all info hashes of torrent,
+// hybrid torrent is announced with both v1 and truncated v2 info hash so peers of v2 swarm can find us.
 func (t *Tracker) announce(d *Download, event string) (AnnounceResult, error) {
+	hashes := d.infoHashes()
+
+	r, err := t.announceHash(d, event, hashes[0])
+	if err != nil || r.FailedReason.Set {
+		return r, err
+	}
+
+	for _, h := range hashes[1:] {
+		extra, err := t.announceHash(d, event, h)
+		if err != nil {
+			d.log.Debug().Err(err).Str("url", t.url).Stringer("info_hash", h).Msg("failed to announce")
+			continue
+		}
+
+		r.Peers = lo.Uniq(append(r.Peers, extra.Peers...))
+	}
+
+	return r, nil
+}
+
+func (t *Tracker) announceHash(d *Download, event string, h meta.Hash) (AnnounceResult, error) {
 	d.log.Trace().Str("url", t.url).Msg("announce to tracker")
 
-	req := t.req(d)
+	if isUDPTracker(t.url) {
+		return t.announceUDP(d, event, h)
+	}
+
+	req := t.req(d, h)
 
 	if event != "" {
 		req = req.SetQueryParam("event", event)
@@ -214,7 +261,16 @@ func (t *Tracker) announce(d *Download, event string) (AnnounceResult, error) {
 		result.Interval = time.Second * time.Duration(r.Interval.Value)
 	}
 
+	t.Lock()
 	t.nextAnnounce = time.Now().Add(result.Interval)
+	if r.Complete.Set {
+		t.seeders = r.Complete.Value
+	}
+	if r.Incomplete.Set {
+		t.leechers = r.Incomplete.Value
+	}
+	t.Unlock()
+
 	d.log.Trace().Str("url", t.url).Time("next", t.nextAnnounce).Msg("next announce")
 
 	// BEP says we must support both format
@@ -282,16 +338,53 @@ func (t *Tracker) announce(d *Download, event string) (AnnounceResult, error) {
 func (t *Tracker) announceStop(d *Download) error {
 	d.log.Trace().Str("url", t.url).Msg("announce to tracker")
 
-	_, err := t.req(d).
-		SetQueryParam("event", EventStopped).
-		Get(t.url)
-	if err != nil {
-		return errgo.Wrap(err, "failed to parse torrent announce response")
+	for _, h := range d.infoHashes() {
+		if isUDPTracker(t.url) {
+			if err := t.announceStopUDP(d, h); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		_, err := t.req(d, h).
+			SetQueryParam("event", EventStopped).
+			Get(t.url)
+		if err != nil {
+			return errgo.Wrap(err, "failed to parse torrent announce response")
+		}
 	}
 
 	return nil
 }
 
+func (d *Download) trackerInfos() []TrackerInfo {
+	var r []TrackerInfo
+
+	for tierIndex, tier := range d.trackers {
+		for _, t := range tier.trackers {
+			t.RLock()
+			info := TrackerInfo{
+				URL:        t.url,
+				Tier:       tierIndex,
+				Peers:      t.peerCount,
+				Seeders:    t.seeders,
+				Leechers:   t.leechers,
+				Completed:  t.completed,
+				LastScrape: t.lastScrape,
+			}
+			if t.err != nil {
+				info.Error = t.err.Error()
+			}
+			t.RUnlock()
+
+			r = append(r, info)
+		}
+	}
+
+	return r
+}
+
 func (d *Download) setAnnounceList(m *metainfo.MetaInfo) {
 	for _, tier := range m.UpvertedAnnounceList() {
 		t := TrackerTier{trackers: lo.Map(lo.Shuffle(tier), func(item string, index int) *Tracker {
@@ -302,19 +395,6 @@ func (d *Download) setAnnounceList(m *metainfo.MetaInfo) {
 	}
 }
 
-// ScrapeUrl return enabled tracker url for scrape request
-func (d *Download) ScrapeUrl() string {
-	// TODO : todo
-	panic("not implemented")
-	//d.m.RLock()
-	//defer d.m.RUnlock()
-
-	//for _, tier := range d.trackers {
-	//	for _, t := range tier.trackers {
-	//}
-	//}
-}
-
 type peerWithPriority struct {
 	addrPort netip.AddrPort
 	priority uint32
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/trim21/errgo"
+
+	"tyr/internal/meta"
+	"tyr/internal/pkg/null"
+	"tyr/internal/udptracker"
+)
+
+func isUDPTracker(url string) bool {
+	return strings.HasPrefix(url, "udp://")
+}
+
+func udpTrackerEvent(event string) udptracker.Event {
+	switch event {
+	case EventStarted:
+		return udptracker.EventStarted
+	case EventCompleted:
+		return udptracker.EventCompleted
+	case EventStopped:
+		return udptracker.EventStopped
+	}
+
+	return udptracker.EventNone
+}
+
+func (t *Tracker) udpReq(d *Download, event string, h meta.Hash) udptracker.AnnounceRequest {
+	// 0 in config means tracker default, but tracker will send no peers if we ask for 0.
+	var numWant int32 = -1
+	if d.c.Config.App.NumWant != 0 {
+		numWant = int32(d.c.Config.App.NumWant)
+	}
+
+	return udptracker.AnnounceRequest{
+		InfoHash:   h,
+		PeerID:     d.peerID,
+		Downloaded: d.downloaded.Load() - d.downloadAtStart,
+		Left:       d.left(),
+		Uploaded:   d.uploaded.Load() - d.uploadAtStart,
+		Event:      udpTrackerEvent(event),
+		Key:        binary.BigEndian.Uint32(d.peerID[16:]),
+		NumWant:    numWant,
+		Port:       d.c.Config.App.P2PPort,
+	}
+}
+
+func (t *Tracker) announceUDP(d *Download, event string, h meta.Hash) (AnnounceResult, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, time.Minute*2)
+	defer cancel()
+
+	r, err := d.c.udpTracker.Announce(ctx, t.url, t.udpReq(d, event, h))
+	if err != nil {
+		var trackerErr udptracker.Error
+		if errors.As(err, &trackerErr) {
+			return AnnounceResult{FailedReason: null.NewString(string(trackerErr))}, nil
+		}
+
+		return AnnounceResult{}, errgo.Wrap(err, "failed to announce to udp tracker")
+	}
+
+	var result = AnnounceResult{
+		Interval: time.Minute * 30,
+		Peers:    lo.Uniq(r.Peers),
+	}
+
+	if r.Interval != 0 {
+		result.Interval = time.Second * time.Duration(r.Interval)
+	}
+
+	t.Lock()
+	t.nextAnnounce = time.Now().Add(result.Interval)
+	t.seeders = int(r.Seeders)
+	t.leechers = int(r.Leechers)
+	t.Unlock()
+
+	d.log.Trace().Str("url", t.url).Time("next", t.nextAnnounce).Msg("next announce")
+
+	return result, nil
+}
+
+func (t *Tracker) announceStopUDP(d *Download, h meta.Hash) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	_, err := d.c.udpTracker.Announce(ctx, t.url, t.udpReq(d, EventStopped, h))
+	if err != nil {
+		return errgo.Wrap(err, "failed to announce to udp tracker")
+	}
+
+	return nil
+}
@@ -0,0 +1,17 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUDPReqNumWant(t *testing.T) {
+	d, _ := newTestDownload(t)
+	tr := &Tracker{}
+
+	require.EqualValues(t, -1, tr.udpReq(d, "", d.info.Hash).NumWant, "tracker default")
+
+	d.c.Config.App.NumWant = 50
+	require.EqualValues(t, 50, tr.udpReq(d, "", d.info.Hash).NumWant)
+}
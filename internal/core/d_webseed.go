@@ -0,0 +1,462 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/trim21/errgo"
+	"github.com/valyala/bytebufferpool"
+
+	"tyr/internal/pkg/bandwidth"
+	"tyr/internal/pkg/empty"
+	"tyr/internal/pkg/mempool"
+)
+
+type webSeedKind uint8
+
+const (
+	// webSeedGetRight is BEP 19 url-list, files are fetched with http range requests.
+	webSeedGetRight webSeedKind = iota
+	// webSeedHoffman is BEP 17 httpseeds, pieces are fetched from a script by info hash and piece index.
+	webSeedHoffman
+)
+
+const webSeedMinBackoff = time.Second * 30
+const webSeedMaxBackoff = time.Hour
+const webSeedMaxRedirects = 5
+
+var errWebSeedCorrupted = errors.New("web seed sent corrupted data")
+var errWebSeedRange = errors.New("web seed sent unexpected range")
+
+// webSeed is a http mirror of torrent data, it's used like a peer having all pieces.
+// Mirror failed to response is not used until nextTry, backoff time doubles on each failure.
+type webSeed struct {
+	nextTry    time.Time
+	err        error
+	url        string
+	downloaded int64
+	failures   int
+	kind       webSeedKind
+	busy       bool
+	sync.Mutex
+}
+
+// acquire mark web seed busy, false if it's already fetching a piece or backing off.
+func (ws *webSeed) acquire(now time.Time) bool {
+	ws.Lock()
+	defer ws.Unlock()
+
+	if ws.busy || now.Before(ws.nextTry) {
+		return false
+	}
+
+	ws.busy = true
+	return true
+}
+
+// release mark web seed idle after fetching a piece, failed mirror back off.
+// retryAfter is the time asked by server, 0 to use exponential backoff.
+func (ws *webSeed) release(n int64, err error, retryAfter time.Duration) {
+	ws.Lock()
+	defer ws.Unlock()
+
+	ws.busy = false
+	ws.downloaded += n
+
+	if err == nil {
+		ws.err = nil
+		ws.failures = 0
+		return
+	}
+
+	ws.err = err
+	ws.failures++
+
+	if retryAfter <= 0 {
+		retryAfter = min(webSeedMinBackoff<<min(ws.failures-1, 16), webSeedMaxBackoff)
+	}
+
+	ws.nextTry = time.Now().Add(retryAfter)
+}
+
+// cancel mark web seed idle without fetching anything.
+func (ws *webSeed) cancel() {
+	ws.Lock()
+	ws.busy = false
+	ws.Unlock()
+}
+
+// setWebSeeds add BEP 19 url-list of torrent and BEP 17 http seeds,
+// web seeds are only set before download is started.
+func (d *Download) setWebSeeds(urlList []string, httpSeeds []string) {
+	d.addWebSeeds(webSeedGetRight, urlList)
+	d.addWebSeeds(webSeedHoffman, httpSeeds)
+}
+
+func (d *Download) addWebSeeds(kind webSeedKind, urls []string) {
+	for _, u := range urls {
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			continue
+		}
+
+		if slices.ContainsFunc(d.webSeeds, func(ws *webSeed) bool { return ws.kind == kind && ws.url == u }) {
+			continue
+		}
+
+		d.webSeeds = append(d.webSeeds, &webSeed{url: u, kind: kind})
+	}
+}
+
+func (d *Download) webSeedURLs(kind webSeedKind) []string {
+	var r []string
+	for _, ws := range d.webSeeds {
+		if ws.kind == kind {
+			r = append(r, ws.url)
+		}
+	}
+
+	return r
+}
+
+func (d *Download) webSeedInfos() []WebSeedInfo {
+	var r = make([]WebSeedInfo, 0, len(d.webSeeds))
+
+	for _, ws := range d.webSeeds {
+		ws.Lock()
+		info := WebSeedInfo{URL: ws.url, Downloaded: ws.downloaded}
+		if ws.err != nil {
+			info.Error = ws.err.Error()
+		}
+		ws.Unlock()
+
+		r = append(r, info)
+	}
+
+	return r
+}
+
+// backgroundWebSeeds fetch pieces from idle web seeds while downloading,
+// each web seed fetch one piece at a time.
+func (d *Download) backgroundWebSeeds() {
+	if len(d.webSeeds) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.m.RLock()
+		state := d.state
+		d.m.RUnlock()
+
+		if state != Downloading {
+			continue
+		}
+
+		now := time.Now()
+		for _, ws := range d.webSeeds {
+			if !ws.acquire(now) {
+				continue
+			}
+
+			index, ok := d.reserveWebSeedPiece()
+			if !ok {
+				ws.cancel()
+				break
+			}
+
+			go d.task(func() { d.fetchWebSeedPiece(ws, index) })()
+		}
+	}
+}
+
+// reserveWebSeedPiece pick a wanted piece which is not downloading from peers or other web seeds,
+// pieces of higher priority come first.
+func (d *Download) reserveWebSeedPiece() (uint32, bool) {
+	d.pdMutex.RLock()
+	defer d.pdMutex.RUnlock()
+
+	d.priorityMutex.RLock()
+	defer d.priorityMutex.RUnlock()
+
+	var best uint32
+	var found bool
+
+	for i := uint32(0); i < d.info.NumPieces; i++ {
+		if d.bm.Get(i) || d.piecePriority[i] == FilePrioritySkip || d.pieceInfo[i].length == 0 {
+			continue
+		}
+
+		if _, ok := d.pieceData[i]; ok {
+			continue
+		}
+
+		if d.fetchingFromWebSeed(i) || !d.canVerify(i) {
+			continue
+		}
+
+		// first chunk is requested from peer but response is not received yet
+		if _, ok := d.reqHistory.Load(d.pieceChunks(i)[0]); ok {
+			continue
+		}
+
+		if found && d.piecePriority[i] <= d.piecePriority[best] {
+			continue
+		}
+
+		best, found = i, true
+	}
+
+	if found {
+		d.webSeedPieces.Store(best, empty.Empty{})
+	}
+
+	return best, found
+}
+
+// fetchWebSeedPiece download piece from web seed and save it, mirror sending corrupted data back off.
+func (d *Download) fetchWebSeedPiece(ws *webSeed, index uint32) {
+	defer d.webSeedPieces.Delete(index)
+
+	length := d.pieceInfo[index].length
+
+	if err := bandwidth.Wait(d.ctx, int(length), d.downLimiter, d.c.downLimiter); err != nil {
+		ws.cancel()
+		return
+	}
+
+	buf := mempool.Get()
+
+	var retryAfter time.Duration
+	var err error
+	if ws.kind == webSeedHoffman {
+		retryAfter, err = d.fetchHoffmanPiece(ws.url, index, buf)
+	} else {
+		retryAfter, err = d.fetchGetRightPiece(ws.url, index, buf)
+	}
+
+	if err != nil {
+		mempool.Put(buf)
+		if d.ctx.Err() != nil {
+			ws.cancel()
+			return
+		}
+
+		d.log.Debug().Err(err).Str("url", ws.url).Msgf("failed to fetch piece %d from web seed", index)
+		ws.release(0, err, retryAfter)
+		return
+	}
+
+	d.downloaded.Add(length)
+
+	// pad files at the end of piece are not fetched, they are all zero.
+	buf.B = append(buf.B, make([]byte, d.pieceLength(index)-length)...)
+
+	if !d.verifyPiece(index, buf.B) {
+		mempool.Put(buf)
+		d.corrupted.Add(d.info.PieceLength)
+		d.log.Debug().Str("url", ws.url).Msgf("piece %d from web seed data mismatch", index)
+		ws.release(length, errWebSeedCorrupted, 0)
+		return
+	}
+
+	ws.release(length, nil, 0)
+
+	if d.bm.Get(index) {
+		mempool.Put(buf)
+		return
+	}
+
+	d.savePiece(index, buf)
+}
+
+// fetchGetRightPiece fetch file ranges of piece, pad files are skipped.
+func (d *Download) fetchGetRightPiece(base string, index uint32, buf *bytebufferpool.ByteBuffer) (time.Duration, error) {
+	for _, chunk := range d.pieceInfo[index].fileChunks {
+		f := d.info.Files[chunk.fileIndex]
+
+		req := d.c.http.R().SetHeader("Range",
+			fmt.Sprintf("bytes=%d-%d", chunk.offsetOfFile, chunk.offsetOfFile+chunk.length-1))
+
+		// server may ignore range and send whole file
+		whole := chunk.offsetOfFile == 0 && chunk.length == f.Length
+
+		retryAfter, err := d.webSeedGet(req, d.webSeedFileURL(base, f.Path), chunk.offsetOfFile, chunk.length, whole, buf)
+		if err != nil {
+			return retryAfter, err
+		}
+	}
+
+	return 0, nil
+}
+
+// fetchHoffmanPiece fetch piece from BEP 17 http seed,
+// server may ask us to retry later with status 503 and seconds in body.
+func (d *Download) fetchHoffmanPiece(base string, index uint32, buf *bytebufferpool.ByteBuffer) (time.Duration, error) {
+	length := d.pieceInfo[index].length
+
+	req := d.c.http.R().
+		SetQueryParam("info_hash", d.info.Hash.AsString()).
+		SetQueryParam("piece", strconv.FormatUint(uint64(index), 10))
+
+	if length != d.pieceLength(index) {
+		req = req.SetQueryParam("ranges", fmt.Sprintf("0-%d", length-1))
+	}
+
+	return d.webSeedGet(req, base, 0, length, true, buf)
+}
+
+// webSeedFileURL return url of file for BEP 19 web seed,
+// url of multi-file torrent is directory containing torrent name.
+func (d *Download) webSeedFileURL(base string, path string) string {
+	if len(d.info.Files) == 1 && d.info.Files[0].Path == d.info.Name {
+		if strings.HasSuffix(base, "/") {
+			return base + url.PathEscape(d.info.Name)
+		}
+
+		return base
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.TrimSuffix(base, "/"))
+	b.WriteString("/")
+	b.WriteString(url.PathEscape(d.info.Name))
+
+	for _, s := range strings.Split(filepath.ToSlash(path), "/") {
+		b.WriteString("/")
+		b.WriteString(url.PathEscape(s))
+	}
+
+	return b.String()
+}
+
+// webSeedGet send request and read exactly length bytes of body to buf,
+// redirects are followed here because http client of tracker doesn't follow them.
+// status 200 is accepted only if whole content is requested,
+// status 206 must have Content-Range starting at offset.
+func (d *Download) webSeedGet(
+	req *resty.Request,
+	u string,
+	offset int64,
+	length int64,
+	whole bool,
+	buf *bytebufferpool.ByteBuffer,
+) (time.Duration, error) {
+	req = req.SetContext(d.ctx).SetDoNotParseResponse(true)
+
+	for i := 0; ; i++ {
+		res, err := req.Get(u)
+		if res != nil && res.RawBody() != nil {
+			defer res.RawBody().Close()
+		}
+
+		if err != nil && !errors.Is(err, resty.ErrAutoRedirectDisabled) {
+			return 0, errgo.Wrap(err, "failed to connect to web seed")
+		}
+
+		switch status := res.StatusCode(); {
+		case status >= 300 && status < 400:
+			if i >= webSeedMaxRedirects {
+				return 0, errors.New("web seed redirect too many times")
+			}
+
+			location, err := res.RawResponse.Request.URL.Parse(res.Header().Get("Location"))
+			if err != nil {
+				return 0, errgo.Wrap(err, "web seed redirect to invalid url")
+			}
+
+			u = location.String()
+			// query of BEP 17 request is already in redirected url
+			req.QueryParam = url.Values{}
+			continue
+		case status == http.StatusPartialContent:
+			start, end, err := parseContentRange(res.Header().Get("Content-Range"))
+			if err != nil {
+				return 0, err
+			}
+
+			if start != offset || end != offset+length-1 {
+				return 0, fmt.Errorf("%w %d-%d, expecting %d-%d", errWebSeedRange, start, end, offset, offset+length-1)
+			}
+		case status == http.StatusOK && whole:
+		case status == http.StatusServiceUnavailable:
+			return retryAfter(res), fmt.Errorf("web seed is busy, status %d", status)
+		default:
+			return 0, fmt.Errorf("unexpected web seed response status %d", status)
+		}
+
+		n, err := io.Copy(buf, io.LimitReader(d.ioDown.WrapReader(res.RawBody()), length+1))
+		if err != nil {
+			return 0, errgo.Wrap(err, "failed to read web seed response")
+		}
+
+		if n != length {
+			return 0, fmt.Errorf("web seed response has %d bytes, expecting %d", n, length)
+		}
+
+		return 0, nil
+	}
+}
+
+// parseContentRange parse first and last byte position of Content-Range header like "bytes 0-99/200".
+func parseContentRange(s string) (int64, int64, error) {
+	r, ok := strings.CutPrefix(s, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w %q", errWebSeedRange, s)
+	}
+
+	r, _, _ = strings.Cut(r, "/")
+	first, last, _ := strings.Cut(r, "-")
+
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w %q", errWebSeedRange, s)
+	}
+
+	end, err := strconv.ParseInt(strings.TrimSpace(last), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w %q", errWebSeedRange, s)
+	}
+
+	return start, end, nil
+}
+
+// retryAfter return time to wait from Retry-After header,
+// or seconds in body of BEP 17 http seed response.
+func retryAfter(res *resty.Response) time.Duration {
+	s := res.Header().Get("Retry-After")
+	if s == "" {
+		b, _ := io.ReadAll(io.LimitReader(res.RawBody(), 32))
+		s = string(b)
+	}
+
+	seconds, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// fetchingFromWebSeed check if piece is reserved by a web seed, it's skipped by piece picker.
+func (d *Download) fetchingFromWebSeed(index uint32) bool {
+	_, ok := d.webSeedPieces.Load(index)
+	return ok
+}
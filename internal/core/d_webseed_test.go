@@ -0,0 +1,185 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestWebSeedServer serve files of test download as BEP 19 web seed, /redirect/ redirect to /files/.
+func newTestWebSeedServer(t *testing.T, d *Download, data []byte) *httptest.Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	var offset int64
+	for _, f := range d.info.Files {
+		p := filepath.Join(dir, d.info.Name, f.Path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), os.ModePerm))
+		require.NoError(t, os.WriteFile(p, data[offset:offset+f.Length], os.ModePerm))
+		offset += f.Length
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/files/", http.StripPrefix("/files/", http.FileServer(http.Dir(dir))))
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/files/"+r.URL.Path[len("/redirect/"):], http.StatusFound)
+	})
+
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// fetchAllFromWebSeed fetch pieces from web seed until no piece is wanted or it fails.
+func fetchAllFromWebSeed(d *Download, ws *webSeed) {
+	for ws.acquire(time.Now()) {
+		index, ok := d.reserveWebSeedPiece()
+		if !ok {
+			ws.cancel()
+			return
+		}
+
+		d.fetchWebSeedPiece(ws, index)
+	}
+}
+
+func TestWebSeedGetRight(t *testing.T) {
+	d, data := newTestDownload(t)
+	s := newTestWebSeedServer(t, d, data)
+
+	d.setWebSeeds([]string{s.URL + "/redirect/", s.URL + "/redirect/", "ftp://example.com/"}, nil)
+	require.Len(t, d.webSeeds, 1)
+
+	require.Equal(t, s.URL+"/files/t/a", d.webSeedFileURL(s.URL+"/files", "a"))
+
+	fetchAllFromWebSeed(d, d.webSeeds[0])
+
+	require.True(t, d.isCompleted())
+	require.EqualValues(t, len(data), d.downloaded.Load())
+	require.Zero(t, d.webSeedPieces.Size())
+	require.Equal(t, []WebSeedInfo{{URL: s.URL + "/redirect/", Downloaded: int64(len(data))}}, d.webSeedInfos())
+
+	for index := uint32(0); index < d.info.NumPieces; index++ {
+		piece, err := d.readPiece(index)
+		require.NoError(t, err)
+		require.True(t, d.verifyPiece(index, piece))
+	}
+}
+
+func TestWebSeedBackoff(t *testing.T) {
+	d, data := newTestDownload(t)
+	corrupted := append([]byte{}, data...)
+	corrupted[100]++
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	s := newTestWebSeedServer(t, d, corrupted)
+
+	d.setWebSeeds([]string{broken.URL + "/", s.URL + "/files/"}, nil)
+
+	for _, ws := range d.webSeeds {
+		fetchAllFromWebSeed(d, ws)
+
+		require.Error(t, ws.err)
+		require.Equal(t, 1, ws.failures)
+		require.WithinDuration(t, time.Now().Add(webSeedMinBackoff), ws.nextTry, time.Second)
+		require.False(t, ws.acquire(time.Now()), "mirror should back off")
+	}
+
+	require.ErrorIs(t, d.webSeeds[1].err, errWebSeedCorrupted)
+	require.EqualValues(t, d.info.PieceLength, d.corrupted.Load())
+	require.False(t, d.bm.Get(0))
+	require.Zero(t, d.webSeedPieces.Size())
+
+	ws := d.webSeeds[1]
+	ws.release(0, errWebSeedCorrupted, 0)
+	require.WithinDuration(t, time.Now().Add(webSeedMinBackoff*2), ws.nextTry, time.Second)
+
+	ws.nextTry = time.Time{}
+	require.True(t, ws.acquire(time.Now()))
+	ws.release(10, nil, 0)
+	require.Zero(t, ws.failures)
+	require.NoError(t, ws.err)
+}
+
+func TestWebSeedHoffman(t *testing.T) {
+	d, data := newTestDownload(t)
+
+	var busy = true
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("info_hash") != d.info.Hash.AsString() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if busy {
+			busy = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("120"))
+			return
+		}
+
+		index, err := strconv.Atoi(r.URL.Query().Get("piece"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_, _ = w.Write(data[index*testPieceLength : min((index+1)*testPieceLength, len(data))])
+	}))
+	defer s.Close()
+
+	d.setWebSeeds(nil, []string{s.URL + "/seed.php"})
+	ws := d.webSeeds[0]
+	require.Equal(t, []string{s.URL + "/seed.php"}, d.webSeedURLs(webSeedHoffman))
+
+	fetchAllFromWebSeed(d, ws)
+	require.Error(t, ws.err)
+	require.WithinDuration(t, time.Now().Add(time.Minute*2), ws.nextTry, time.Second)
+
+	ws.nextTry = time.Time{}
+	fetchAllFromWebSeed(d, ws)
+	require.NoError(t, ws.err)
+	require.True(t, d.isCompleted())
+}
+
+func TestWebSeedContentRange(t *testing.T) {
+	d, data := newTestDownload(t)
+
+	// server always send range from start of file
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", testPieceLength-1, len(data)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(data[:testPieceLength])
+	}))
+	defer s.Close()
+
+	d.setWebSeeds([]string{s.URL + "/"}, nil)
+	ws := d.webSeeds[0]
+
+	require.True(t, ws.acquire(time.Now()))
+	d.fetchWebSeedPiece(ws, 1)
+
+	require.ErrorIs(t, ws.err, errWebSeedRange)
+	require.Zero(t, d.corrupted.Load(), "wrong range is not corrupted data")
+	require.False(t, d.bm.Get(1))
+
+	start, end, err := parseContentRange("bytes 100-199/*")
+	require.NoError(t, err)
+	require.EqualValues(t, 100, start)
+	require.EqualValues(t, 199, end)
+
+	_, _, err = parseContentRange("bytes */200")
+	require.ErrorIs(t, err, errWebSeedRange)
+}
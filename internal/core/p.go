@@ -18,11 +18,15 @@ import (
 	"github.com/puzpuzpuz/xsync/v3"
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
+	"github.com/trim21/errgo"
 
+	"tyr/internal/meta"
+	"tyr/internal/pkg/bandwidth"
 	"tyr/internal/pkg/bm"
 	"tyr/internal/pkg/empty"
 	"tyr/internal/pkg/flowrate"
 	"tyr/internal/pkg/global"
+	"tyr/internal/pkg/global/tasks"
 	"tyr/internal/pkg/unsafe"
 	"tyr/internal/proto"
 )
@@ -49,11 +53,21 @@ func NewPeerID() (peerID PeerID) {
 }
 
 func NewOutgoingPeer(conn net.Conn, d *Download, addr netip.AddrPort) *Peer {
-	return newPeer(conn, d, addr, emptyPeerID, false, false)
+	p := newPeer(conn, d, addr, emptyPeerID, false)
+	p.spawn(func() { p.start(false) })
+	return p
 }
 
 func NewIncomingPeer(conn net.Conn, d *Download, addr netip.AddrPort, h proto.Handshake) *Peer {
-	return newPeer(conn, d, addr, h.PeerID, true, h.FastExtension)
+	p := newPeer(conn, d, addr, h.PeerID, h.FastExtension)
+	// hybrid torrent may be requested with v1 or v2 info hash, response with the same one.
+	p.infoHash = h.InfoHash
+	p.supportExtensionHandshake = h.ExchangeExtensions
+	p.supportDHT = h.DHT
+	p.supportV2 = h.V2
+	p.incoming = true
+	p.spawn(func() { p.start(true) })
+	return p
 }
 
 func newPeer(
@@ -61,7 +75,6 @@ func newPeer(
 	d *Download,
 	addr netip.AddrPort,
 	peerID PeerID,
-	skipHandshake bool,
 	fast bool,
 ) *Peer {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -72,11 +85,17 @@ func newPeer(
 		l = l.Str("peer_id", url.QueryEscape(peerID.AsString()))
 	}
 
+	// torrent and client speed limits are shared by all peers
+	limited := bandwidth.NewConn(ctx, conn,
+		[]*bandwidth.Limiter{d.downLimiter, d.c.downLimiter},
+		[]*bandwidth.Limiter{d.upLimiter, d.c.upLimiter},
+	)
+
 	p := &Peer{
 		ctx:                  ctx,
 		log:                  l.Logger(),
 		supportFastExtension: fast,
-		Conn:                 conn,
+		Conn:                 limited,
 		d:                    d,
 		cancel:               cancel,
 		bitfieldSize:         (d.info.NumPieces + 7) / 8,
@@ -84,20 +103,26 @@ func newPeer(
 		ioOut:                flowrate.New(time.Second, time.Second),
 		ioIn:                 flowrate.New(time.Second, time.Second),
 		Address:              addr,
+		infoHash:             d.info.Hash,
 		//ResChan:   make(chan req.Response, 1),
-		requests: xsync.NewMapOf[proto.ChunkRequest, empty.Empty](),
-		rejected: xsync.NewMapOf[proto.ChunkRequest, empty.Empty](),
+		requests:  xsync.NewMapOf[proto.ChunkRequest, empty.Empty](),
+		rejected:  xsync.NewMapOf[proto.ChunkRequest, empty.Empty](),
+		cancelled: xsync.NewMapOf[proto.ChunkRequest, empty.Empty](),
 
 		allowFast: bm.New(d.info.NumPieces),
+
+		uploadNotify: make(chan empty.Empty, 1),
 	}
 
 	p.QueueLimit.Store(250)
+	// all connections start out choked
+	p.imChoked.Store(true)
+	p.peerChoked.Store(true)
 
 	if ua != "" {
 		p.UserAgent.Store(&ua)
 	}
 
-	go p.start(skipHandshake)
 	return p
 }
 
@@ -111,24 +136,36 @@ type Peer struct {
 	lastSend                  atomic.Pointer[time.Time]
 	cancel                    context.CancelFunc
 	Bitmap                    *bm.Bitmap
+	uploadNotify              chan empty.Empty
 	requests                  *xsync.MapOf[proto.ChunkRequest, empty.Empty]
 	rejected                  *xsync.MapOf[proto.ChunkRequest, empty.Empty]
+	cancelled                 *xsync.MapOf[proto.ChunkRequest, empty.Empty]
 	allowFast                 *bm.Bitmap
 	ioOut                     *flowrate.Monitor
 	ioIn                      *flowrate.Monitor
+	uploadQueue               []proto.ChunkRequest
 	UserAgent                 atomic.Pointer[string]
 	Address                   netip.AddrPort
+	infoHash                  meta.Hash
 	peerChoked                atomic.Bool
 	peerInterested            atomic.Bool
 	imChoked                  atomic.Bool
 	imInterested              atomic.Bool
 	QueueLimit                atomic.Uint32
+	utMetadataID              atomic.Uint32
+	utPexID                   atomic.Uint32
+	listenPort                atomic.Uint32
 	closed                    atomic.Bool
+	wg                        sync.WaitGroup
 	m                         sync.Mutex
 	wm                        sync.Mutex
+	uploadMutex               sync.Mutex
 	bitfieldSize              uint32
 	supportFastExtension      bool
 	supportExtensionHandshake bool
+	supportDHT                bool
+	supportV2                 bool
+	incoming                  bool
 	readSizeBuf               [4]byte
 }
 
@@ -143,16 +180,17 @@ func (p *Peer) Response(res proto.ChunkResponse) {
 	return
 }
 
-func (p *Peer) Request(req proto.ChunkRequest) {
-	if p.requests.Size() > int(p.QueueLimit.Load()) {
+// Request send a chunk request to peer, return false if request is not sent.
+func (p *Peer) Request(req proto.ChunkRequest) bool {
+	if p.requests.Size() >= int(p.QueueLimit.Load()) {
 		p.log.Trace().Msg("too many pending requests")
-		return
+		return false
 	}
 
 	_, exist := p.requests.LoadOrStore(req, empty.Empty{})
 	if exist {
 		p.log.Trace().Msg("requests already sent")
-		return
+		return false
 	}
 
 	p.log.Trace().Any("req", req).Msg("send piece request")
@@ -160,10 +198,54 @@ func (p *Peer) Request(req proto.ChunkRequest) {
 		Event: proto.Request,
 		Req:   req,
 	})
+	if err != nil {
+		p.close()
+		return false
+	}
+
+	return true
+}
+
+// Cancel a sent chunk request, peer may still send the chunk.
+func (p *Peer) Cancel(req proto.ChunkRequest) {
+	if _, ok := p.requests.LoadAndDelete(req); !ok {
+		return
+	}
+
+	p.cancelled.Store(req, empty.Empty{})
+
+	err := p.sendEvent(Event{
+		Event: proto.Cancel,
+		Req:   req,
+	})
+	if err != nil {
+		p.close()
+	}
+}
+
+func (p *Peer) Choke() {
+	if !p.imChoked.CompareAndSwap(false, true) {
+		return
+	}
+
+	err := p.sendEvent(Event{Event: proto.Choke})
+	if err != nil {
+		p.close()
+		return
+	}
+
+	p.clearUploadQueue()
+}
+
+func (p *Peer) Unchoke() {
+	if !p.imChoked.CompareAndSwap(true, false) {
+		return
+	}
+
+	err := p.sendEvent(Event{Event: proto.Unchoke})
 	if err != nil {
 		p.close()
 	}
-	return
 }
 
 func (p *Peer) Have(index uint32) {
@@ -188,14 +270,79 @@ func (p *Peer) close() {
 		p.d.c.sem.Release(1)
 		p.d.c.connectionCount.Sub(1)
 		_ = p.Conn.Close()
+		p.d.releasePeerRequests(p)
 	}
 }
 
+// spawn run fn in a goroutine of peer, wait return after all of them exit.
+func (p *Peer) spawn(fn func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		fn()
+	}()
+}
+
+// wait for goroutines of peer to exit, peer should be closed first.
+func (p *Peer) wait() {
+	p.wg.Wait()
+}
+
+// onHave record piece peer has, peer connected before metadata is fetched doesn't know piece count.
+func (p *Peer) onHave(index uint32) error {
+	if p.Bitmap.Size() == 0 {
+		return nil
+	}
+
+	if index >= p.Bitmap.Size() {
+		return errgo.Wrap(ErrPeerSendInvalidData,
+			fmt.Sprintf("have piece %d, torrent only has %d pieces", index, p.Bitmap.Size()))
+	}
+
+	p.Bitmap.Set(index)
+
+	return nil
+}
+
+func (p *Peer) onChoke() {
+	p.peerChoked.Store(true)
+	// peers with fast extension will reject requests explicitly
+	if !p.supportFastExtension {
+		p.d.releasePeerRequests(p)
+	}
+}
+
+// onUnchoke forget rejected requests, peers with fast extension reject all pending requests when choking us,
+// they should be requested again after unchoke.
+func (p *Peer) onUnchoke() {
+	p.peerChoked.Store(false)
+	p.rejected.Clear()
+}
+
+func (p *Peer) onReject(req proto.ChunkRequest) {
+	p.rejected.Store(req, empty.Empty{})
+	p.cancelled.Delete(req)
+	if _, ok := p.requests.LoadAndDelete(req); ok {
+		p.d.releaseRequest(p, req)
+	}
+}
+
+// onAllowedFast allow requesting piece while choked, chunks of it rejected before can be requested again.
+func (p *Peer) onAllowedFast(index uint32) {
+	p.allowFast.Set(index)
+	p.rejected.Range(func(req proto.ChunkRequest, _ empty.Empty) bool {
+		if req.PieceIndex == index {
+			p.rejected.Delete(req)
+		}
+		return true
+	})
+}
+
 func (p *Peer) start(skipHandshake bool) {
 	p.log.Trace().Msg("start")
 	defer p.close()
 
-	if err := proto.SendHandshake(p.Conn, p.d.info.Hash, NewPeerID()); err != nil {
+	if err := proto.SendHandshake(p.Conn, p.infoHash, NewPeerID()); err != nil {
 		p.log.Trace().Err(err).Msg("failed to send handshake to addrPort")
 		return
 	}
@@ -208,11 +355,14 @@ func (p *Peer) start(skipHandshake bool) {
 			}
 			return
 		}
-		if h.InfoHash != p.d.info.Hash {
+		if h.InfoHash != p.infoHash {
 			p.log.Trace().Msgf("addrPort info hash mismatch %x", h.InfoHash)
 			return
 		}
 		p.supportFastExtension = h.FastExtension
+		p.supportExtensionHandshake = h.ExchangeExtensions
+		p.supportDHT = h.DHT
+		p.supportV2 = h.V2
 		p.log = p.log.With().Str("peer_id", url.QueryEscape(string(h.PeerID[:]))).Logger()
 		p.log.Trace().Msg("connect to addrPort")
 		ua := parsePeerID(h.PeerID)
@@ -224,11 +374,21 @@ func (p *Peer) start(skipHandshake bool) {
 	}
 
 	var err error
-	if p.supportFastExtension && p.d.bm.Count() == 0 {
+	if p.supportExtensionHandshake {
+		if err = p.sendExtHandshake(); err != nil {
+			p.log.Trace().Err(err).Msg("failed to send extension handshake")
+			return
+		}
+	}
+
+	hasMetadata := p.d.hasMetadata()
+
+	if p.supportFastExtension && (!hasMetadata || p.d.bm.Count() == 0) {
 		err = p.sendEvent(Event{Event: proto.HaveNone})
 	} else if p.supportFastExtension && p.d.bm.Count() == p.d.info.NumPieces {
 		err = p.sendEvent(Event{Event: proto.HaveAll})
-	} else {
+	} else if hasMetadata {
+		// can't send bitfield without metadata
 		err = p.sendEvent(Event{Event: proto.Bitfield, Bitmap: p.d.bm})
 	}
 
@@ -237,7 +397,20 @@ func (p *Peer) start(skipHandshake bool) {
 		return
 	}
 
-	go p.keepAlive()
+	if p.supportDHT && p.d.c.dht.Load() != nil {
+		if err = p.sendEvent(Event{Event: proto.Port, Port: p.d.c.Config.App.P2PPort}); err != nil {
+			p.log.Trace().Err(err).Msg("failed to send dht port")
+			return
+		}
+	}
+
+	if p.supportV2 && hasMetadata {
+		tasks.Submit(p.d.requestPieceLayers)
+	}
+
+	p.spawn(p.keepAlive)
+	p.spawn(p.uploadLoop)
+	p.spawn(p.pexLoop)
 
 	for {
 		if p.ctx.Err() != nil {
@@ -277,65 +450,115 @@ func (p *Peer) start(skipHandshake bool) {
 				}
 			}
 		case proto.Have:
-			p.Bitmap.Set(event.Index)
+			if err = p.onHave(event.Index); err != nil {
+				p.log.Trace().Err(err).Msg("failed to handle have")
+				return
+			}
 		case proto.Interested:
 			p.peerInterested.Store(true)
 		case proto.NotInterested:
 			p.peerInterested.Store(false)
 		case proto.Choke:
-			p.peerChoked.Store(true)
+			p.onChoke()
 		case proto.Unchoke:
-			p.peerChoked.Store(false)
+			p.onUnchoke()
 		case proto.Piece:
 			if !p.resIsValid(event.Res) {
+				if p.resIsCancelled(event.Res) {
+					continue
+				}
+
 				p.log.Trace().Msg("failed to validate response")
 				// send response without requests
 				return
 			}
 
 			p.ioIn.Update(len(event.Res.Data))
-			p.d.ResChan <- event.Res
+			p.d.ResChan <- peerChunk{ChunkResponse: event.Res, from: p.Address}
 		case proto.Request:
-			//p.reqChan <- event.Req
+			if err = p.handleRequest(event.Req); err != nil {
+				return
+			}
 
 		case proto.Extended:
+			if event.ExtID == extUtMetadata {
+				if err = p.handleMetadataMessage(event.ExtPayload); err != nil {
+					p.log.Trace().Err(err).Msg("failed to handle metadata message")
+					return
+				}
+				continue
+			}
+
+			if event.ExtID == extUtPex {
+				if err = p.handlePexMessage(event.ExtPayload); err != nil {
+					p.log.Trace().Err(err).Msg("failed to handle pex message")
+					return
+				}
+				continue
+			}
+
 			if event.ExtHandshake.V.Set {
 				p.UserAgent.Store(&event.ExtHandshake.V.Value)
 			}
 			if event.ExtHandshake.QueueLength.Set {
 				p.QueueLimit.Store(event.ExtHandshake.QueueLength.Value)
 			}
+			if id, ok := event.ExtHandshake.M[extNameUtMetadata]; ok && id > 0 && id < 256 {
+				p.utMetadataID.Store(uint32(id))
+				if event.ExtHandshake.MetadataSize.Set && !p.d.hasMetadata() {
+					tasks.Submit(func() {
+						p.d.onMetadataSize(p, event.ExtHandshake.MetadataSize.Value)
+					})
+				}
+			}
+			if id, ok := event.ExtHandshake.M[extNameUtPex]; ok && id > 0 && id < 256 {
+				p.utPexID.Store(uint32(id))
+			}
+			if event.ExtHandshake.Port.Set {
+				p.listenPort.Store(uint32(event.ExtHandshake.Port.Value))
+			}
 
-		// TODO
 		case proto.Cancel:
+			p.handleCancel(event.Req)
+
 		case proto.Port:
+			p.d.c.addDHTNode(netip.AddrPortFrom(p.Address.Addr(), event.Port))
+		// TODO
 		case proto.Suggest:
 		case proto.HaveAll:
 			p.Bitmap.Fill()
 		case proto.HaveNone:
 			p.Bitmap.Clear()
 		case proto.Reject:
-			p.rejected.Store(event.Req, empty.Empty{})
+			p.onReject(event.Req)
 		case proto.AllowedFast:
-			p.allowFast.Set(event.Index)
+			p.onAllowedFast(event.Index)
+		case proto.HashRequest:
+			if err = p.handleHashRequest(event.HashReq); err != nil {
+				return
+			}
+		case proto.Hashes:
+			if err = p.d.onHashes(event.HashRes); err != nil {
+				p.log.Trace().Err(err).Msg("failed to handle hashes")
+				return
+			}
+		case proto.HashReject:
+			p.d.hashReqHistory.Delete(event.HashReq)
 		// currently unsupported
 
 		// currently ignored
 		case proto.BitCometExtension:
 		}
 
-		go func() {
+		p.spawn(func() {
 			//nolint:exhaustive
 			switch event.Event {
 			case proto.Have, proto.HaveAll, proto.Bitfield:
 				if p.Bitmap.WithAndNot(p.d.bm).Count() != 0 {
-					err = p.sendEvent(Event{Event: proto.Interested})
-					if err != nil {
-						return
-					}
+					_ = p.sendEvent(Event{Event: proto.Interested})
 				}
 			}
-		}()
+		})
 	}
 }
 
@@ -382,7 +605,15 @@ func (p *Peer) sendEvent(e Event) error {
 		return proto.SendIndexOnly(p.Conn, e.Event, e.Index)
 	case proto.Reject:
 		return proto.SendReject(p.Conn, e.Req)
-	case proto.Extended, proto.BitCometExtension:
+	case proto.Extended:
+		return proto.SendExtended(p.Conn, e.ExtID, e.ExtPayload)
+	case proto.HashRequest:
+		return proto.SendHashRequest(p.Conn, e.HashReq)
+	case proto.Hashes:
+		return proto.SendHashes(p.Conn, e.HashRes)
+	case proto.HashReject:
+		return proto.SendHashReject(p.Conn, e.HashReq)
+	case proto.BitCometExtension:
 		panic("unexpected event")
 	}
 
@@ -403,6 +634,17 @@ func (p *Peer) resIsValid(res proto.ChunkResponse) bool {
 	return true
 }
 
+// resIsCancelled check if response is for a cancelled request, it's allowed by protocol.
+func (p *Peer) resIsCancelled(res proto.ChunkResponse) bool {
+	_, ok := p.cancelled.LoadAndDelete(proto.ChunkRequest{
+		PieceIndex: res.PieceIndex,
+		Begin:      res.Begin,
+		Length:     uint32(len(res.Data)),
+	})
+
+	return ok
+}
+
 func (p *Peer) decodePiece(size uint32) (Event, error) {
 	payload, err := proto.ReadPiecePayload(p.Conn, size)
 	if err != nil {
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/docker/go-units"
+	"github.com/trim21/errgo"
+
+	"tyr/internal/pkg/global"
+	"tyr/internal/proto"
+)
+
+// local extended message ids, sent to peers in our extended handshake
+const (
+	extUtMetadata byte = 1
+	extUtPex      byte = 2
+)
+
+const (
+	extNameUtMetadata = "ut_metadata"
+	extNameUtPex      = "ut_pex"
+)
+
+var extVersion = fmt.Sprintf("Tyr %d.%d.%d", global.MAJOR, global.MINOR, global.PATCH)
+
+type extensionHandshake struct {
+	M            map[string]int `bencode:"m"`
+	V            string         `bencode:"v,omitempty"`
+	QueueLength  int            `bencode:"reqq,omitempty"`
+	MetadataSize int            `bencode:"metadata_size,omitempty"`
+	Port         uint16         `bencode:"p,omitempty"`
+}
+
+func (p *Peer) sendExtHandshake() error {
+	h := extensionHandshake{
+		M: map[string]int{
+			extNameUtMetadata: int(extUtMetadata),
+		},
+		V:            extVersion,
+		QueueLength:  maxUploadQueue,
+		MetadataSize: len(p.d.getInfoBytes()),
+		Port:         p.d.c.Config.App.P2PPort,
+	}
+
+	// BEP 27, private torrent must not exchange peers
+	if !p.d.isPrivate() {
+		h.M[extNameUtPex] = int(extUtPex)
+	}
+
+	payload, err := bencode.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	return p.sendEvent(Event{Event: proto.Extended, ExtID: proto.ExtHandshakeID, ExtPayload: payload})
+}
+
+// BEP 9 metadata message types
+const (
+	metadataRequest = 0
+	metadataData    = 1
+	metadataReject  = 2
+)
+
+const metadataPieceSize = units.KiB * 16
+
+type metadataMessage struct {
+	MsgType   int `bencode:"msg_type"`
+	Piece     int `bencode:"piece"`
+	TotalSize int `bencode:"total_size,omitempty"`
+}
+
+func (p *Peer) sendMetadataMessage(msg metadataMessage, data []byte) error {
+	id := p.utMetadataID.Load()
+	if id == 0 {
+		return nil
+	}
+
+	payload, err := bencode.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return p.sendEvent(Event{Event: proto.Extended, ExtID: byte(id), ExtPayload: append(payload, data...)})
+}
+
+func (p *Peer) handleMetadataMessage(payload []byte) error {
+	r := bytes.NewReader(payload)
+
+	var msg metadataMessage
+	if err := bencode.NewDecoder(r).Decode(&msg); err != nil {
+		return errgo.Wrap(err, "failed to decode ut_metadata message")
+	}
+
+	switch msg.MsgType {
+	case metadataRequest:
+		infoBytes := p.d.getInfoBytes()
+		if infoBytes == nil || msg.Piece < 0 || msg.Piece*metadataPieceSize >= len(infoBytes) {
+			return p.sendMetadataMessage(metadataMessage{MsgType: metadataReject, Piece: msg.Piece}, nil)
+		}
+
+		start := msg.Piece * metadataPieceSize
+		end := min(start+metadataPieceSize, len(infoBytes))
+
+		return p.sendMetadataMessage(metadataMessage{
+			MsgType:   metadataData,
+			Piece:     msg.Piece,
+			TotalSize: len(infoBytes),
+		}, infoBytes[start:end])
+	case metadataData:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		p.d.metadataPieceReceived(msg.Piece, msg.TotalSize, data)
+	case metadataReject:
+		p.log.Trace().Msgf("metadata piece %d rejected", msg.Piece)
+	}
+
+	return nil
+}
+
+// requestMetadata request all missing metadata pieces from peer.
+func (p *Peer) requestMetadata() {
+	for _, piece := range p.d.missingMetadataPieces() {
+		err := p.sendMetadataMessage(metadataMessage{MsgType: metadataRequest, Piece: piece}, nil)
+		if err != nil {
+			p.close()
+			return
+		}
+	}
+}
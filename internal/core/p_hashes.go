@@ -0,0 +1,48 @@
+package core
+
+import (
+	"tyr/internal/proto"
+)
+
+// RequestHashes send BEP 52 hash request to peer, return false if request is not sent.
+func (p *Peer) RequestHashes(req proto.HashesRequest) bool {
+	err := p.sendEvent(Event{Event: proto.HashRequest, HashReq: req})
+	if err != nil {
+		p.close()
+		return false
+	}
+
+	return true
+}
+
+// handleHashRequest response hashes of piece layer, or reject if we don't have them.
+func (p *Peer) handleHashRequest(req proto.HashesRequest) error {
+	hashes, ok := p.d.hashesForRequest(req)
+	if !ok {
+		return p.sendEvent(Event{Event: proto.HashReject, HashReq: req})
+	}
+
+	return p.sendEvent(Event{Event: proto.Hashes, HashRes: proto.HashesResponse{HashesRequest: req, Hashes: hashes}})
+}
+
+func (p *Peer) decodeHashRequest(e proto.Message, size uint32) (Event, error) {
+	if size != proto.SizeHashesRequest {
+		return Event{}, ErrPeerSendInvalidData
+	}
+
+	payload, err := proto.ReadHashRequestPayload(p.Conn)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{Event: e, HashReq: payload}, nil
+}
+
+func (p *Peer) decodeHashes(size uint32) (Event, error) {
+	payload, err := proto.ReadHashesPayload(p.Conn, size)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{Event: proto.Hashes, HashRes: payload}, nil
+}
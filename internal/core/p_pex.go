@@ -0,0 +1,194 @@
+package core
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/trim21/errgo"
+
+	"tyr/internal/pkg/empty"
+	"tyr/internal/proto"
+)
+
+// BEP 11, peer exchange message should not be sent more frequently than once a minute,
+// with at most 50 added and 50 dropped peers.
+const (
+	pexInterval = time.Minute
+	maxPexPeers = 50
+)
+
+type pexMessage struct {
+	Added       []byte `bencode:"added"`
+	AddedFlags  []byte `bencode:"added.f"`
+	Added6      []byte `bencode:"added6,omitempty"`
+	Added6Flags []byte `bencode:"added6.f,omitempty"`
+	Dropped     []byte `bencode:"dropped"`
+	Dropped6    []byte `bencode:"dropped6,omitempty"`
+}
+
+// pexAddr return address peer is listening on, or invalid address if we don't know.
+func (p *Peer) pexAddr() netip.AddrPort {
+	addr := p.Address.Addr().Unmap()
+
+	if !p.incoming {
+		return netip.AddrPortFrom(addr, p.Address.Port())
+	}
+
+	port := p.listenPort.Load()
+	if port == 0 {
+		return netip.AddrPort{}
+	}
+
+	return netip.AddrPortFrom(addr, uint16(port))
+}
+
+// pexLoop send connected peers of download to peer periodically.
+func (p *Peer) pexLoop() {
+	ticker := time.NewTicker(pexInterval)
+	defer ticker.Stop()
+
+	// peers already sent to this peer
+	var sent = make(map[netip.AddrPort]empty.Empty)
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			if p.utPexID.Load() == 0 || p.d.isPrivate() {
+				continue
+			}
+
+			if err := p.sendPex(sent); err != nil {
+				p.log.Trace().Err(err).Msg("failed to send pex message")
+				p.close()
+				return
+			}
+		}
+	}
+}
+
+func (p *Peer) sendPex(sent map[netip.AddrPort]empty.Empty) error {
+	var current = make(map[netip.AddrPort]empty.Empty)
+
+	p.d.conn.Range(func(_ netip.AddrPort, peer *Peer) bool {
+		if peer == p {
+			return true
+		}
+
+		if addr := peer.pexAddr(); addr.IsValid() {
+			current[addr] = empty.Empty{}
+		}
+
+		return true
+	})
+
+	var msg pexMessage
+	var added, dropped int
+
+	for addr := range current {
+		if added >= maxPexPeers {
+			break
+		}
+
+		if _, ok := sent[addr]; ok {
+			continue
+		}
+
+		if addr.Addr().Is4() {
+			msg.Added = appendCompactAddr(msg.Added, addr)
+			msg.AddedFlags = append(msg.AddedFlags, 0)
+		} else {
+			msg.Added6 = appendCompactAddr(msg.Added6, addr)
+			msg.Added6Flags = append(msg.Added6Flags, 0)
+		}
+
+		sent[addr] = empty.Empty{}
+		added++
+	}
+
+	for addr := range sent {
+		if dropped >= maxPexPeers {
+			break
+		}
+
+		if _, ok := current[addr]; ok {
+			continue
+		}
+
+		if addr.Addr().Is4() {
+			msg.Dropped = appendCompactAddr(msg.Dropped, addr)
+		} else {
+			msg.Dropped6 = appendCompactAddr(msg.Dropped6, addr)
+		}
+
+		delete(sent, addr)
+		dropped++
+	}
+
+	if added == 0 && dropped == 0 {
+		return nil
+	}
+
+	payload, err := bencode.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return p.sendEvent(Event{Event: proto.Extended, ExtID: byte(p.utPexID.Load()), ExtPayload: payload})
+}
+
+func (p *Peer) handlePexMessage(payload []byte) error {
+	if p.d.isPrivate() {
+		return nil
+	}
+
+	var msg pexMessage
+	if err := bencode.Unmarshal(payload, &msg); err != nil {
+		return errgo.Wrap(err, "failed to decode ut_pex message")
+	}
+
+	peers := append(parseCompactAddrs(msg.Added, 4), parseCompactAddrs(msg.Added6, 16)...)
+	if len(peers) > maxPexPeers {
+		peers = peers[:maxPexPeers]
+	}
+
+	p.log.Trace().Msgf("receive %d peers from pex", len(peers))
+
+	p.d.peersMutex.Lock()
+	defer p.d.peersMutex.Unlock()
+
+	for _, addr := range peers {
+		if _, ok := p.d.conn.Load(addr); ok {
+			continue
+		}
+
+		p.d.peers.Push(peerWithPriority{addrPort: addr, priority: p.d.c.PeerPriority(addr)})
+	}
+
+	return nil
+}
+
+func appendCompactAddr(b []byte, addr netip.AddrPort) []byte {
+	b = append(b, addr.Addr().AsSlice()...)
+	return binary.BigEndian.AppendUint16(b, addr.Port())
+}
+
+func parseCompactAddrs(b []byte, ipLen int) []netip.AddrPort {
+	size := ipLen + 2
+	var result = make([]netip.AddrPort, 0, len(b)/size)
+
+	for i := 0; i+size <= len(b); i += size {
+		addr, _ := netip.AddrFromSlice(b[i : i+ipLen])
+		port := binary.BigEndian.Uint16(b[i+ipLen:])
+		if port == 0 {
+			continue
+		}
+
+		result = append(result, netip.AddrPortFrom(addr, port))
+	}
+
+	return result
+}
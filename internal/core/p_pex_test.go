@@ -0,0 +1,117 @@
+package core
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/pkg/empty"
+	"tyr/internal/proto"
+)
+
+// readPexMessage read one ut_pex message sent by sendPex.
+func readPexMessage(t *testing.T, conn net.Conn, extID byte) pexMessage {
+	t.Helper()
+
+	var size uint32
+	require.NoError(t, binary.Read(conn, binary.BigEndian, &size))
+
+	b := make([]byte, size)
+	_, err := io.ReadFull(conn, b)
+	require.NoError(t, err)
+
+	require.EqualValues(t, proto.Extended, b[0])
+	require.Equal(t, extID, b[1])
+
+	var msg pexMessage
+	require.NoError(t, bencode.Unmarshal(b[2:], &msg))
+
+	return msg
+}
+
+func sendTestPex(t *testing.T, p *Peer, remote net.Conn, sent map[netip.AddrPort]empty.Empty) pexMessage {
+	t.Helper()
+
+	done := make(chan error, 1)
+	go func() { done <- p.sendPex(sent) }()
+
+	msg := readPexMessage(t, remote, 3)
+	require.NoError(t, <-done)
+
+	return msg
+}
+
+func TestSendPex(t *testing.T) {
+	d, _ := newTestDownload(t)
+	p, remote := newTestPeer(t, d, netip.MustParseAddrPort("10.0.0.1:6881"))
+	p.utPexID.Store(3)
+
+	v4 := netip.MustParseAddrPort("10.0.0.2:6881")
+	v6 := netip.MustParseAddrPort("[2001:db8::1]:6882")
+	newTestPeer(t, d, v4)
+	newTestPeer(t, d, v6)
+
+	// incoming peer without listen port is not shared
+	incoming, _ := newTestPeer(t, d, netip.MustParseAddrPort("10.0.0.9:50000"))
+	incoming.incoming = true
+
+	sent := make(map[netip.AddrPort]empty.Empty)
+
+	msg := sendTestPex(t, p, remote, sent)
+	require.Equal(t, []netip.AddrPort{v4}, parseCompactAddrs(msg.Added, 4))
+	require.Equal(t, []netip.AddrPort{v6}, parseCompactAddrs(msg.Added6, 16))
+	require.Len(t, msg.AddedFlags, 1)
+	require.Len(t, msg.Added6Flags, 1)
+	require.Empty(t, msg.Dropped)
+	require.Empty(t, msg.Dropped6)
+	require.Len(t, sent, 2)
+
+	// nothing changed, no message is sent
+	require.NoError(t, p.sendPex(sent))
+
+	added := netip.MustParseAddrPort("10.0.0.3:6881")
+	d.conn.Delete(v4)
+	d.conn.Delete(v6)
+	newTestPeer(t, d, added)
+
+	msg = sendTestPex(t, p, remote, sent)
+	require.Equal(t, []netip.AddrPort{added}, parseCompactAddrs(msg.Added, 4))
+	require.Empty(t, msg.Added6)
+	require.Equal(t, []netip.AddrPort{v4}, parseCompactAddrs(msg.Dropped, 4))
+	require.Equal(t, []netip.AddrPort{v6}, parseCompactAddrs(msg.Dropped6, 16))
+	require.Equal(t, map[netip.AddrPort]empty.Empty{added: {}}, sent)
+}
+
+func TestParseCompactAddrs(t *testing.T) {
+	v4 := netip.MustParseAddrPort("1.2.3.4:6881")
+	v6 := netip.MustParseAddrPort("[2001:db8::1]:51413")
+
+	testCases := []struct {
+		name     string
+		b        []byte
+		ipLen    int
+		expected []netip.AddrPort
+	}{
+		{name: "empty", b: nil, ipLen: 4, expected: []netip.AddrPort{}},
+		{name: "ipv4", b: []byte{1, 2, 3, 4, 0x1a, 0xe1}, ipLen: 4, expected: []netip.AddrPort{v4}},
+		{name: "ipv6", b: appendCompactAddr(nil, v6), ipLen: 16, expected: []netip.AddrPort{v6}},
+		{
+			name:     "zero port",
+			b:        append(appendCompactAddr(nil, netip.MustParseAddrPort("5.6.7.8:0")), appendCompactAddr(nil, v4)...),
+			ipLen:    4,
+			expected: []netip.AddrPort{v4},
+		},
+		{name: "trailing bytes", b: append(appendCompactAddr(nil, v4), 9, 9, 9), ipLen: 4, expected: []netip.AddrPort{v4}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, parseCompactAddrs(tc.b, tc.ipLen))
+		})
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"io"
 	"time"
 
-	"github.com/RoaringBitmap/roaring/v2"
 	"github.com/anacrolix/torrent/bencode"
 	"github.com/docker/go-units"
 	"github.com/fatih/color"
@@ -47,19 +46,26 @@ func (p *Peer) keepAlive() {
 
 type Event struct {
 	Bitmap       *bm.Bitmap
-	Res          proto.ChunkResponse
 	ExtHandshake extension
+	ExtPayload   []byte
+	Res          proto.ChunkResponse
 	Req          proto.ChunkRequest
+	HashReq      proto.HashesRequest
+	HashRes      proto.HashesResponse
 	Index        uint32
 	Port         uint16
 	Event        proto.Message
+	ExtID        byte
 	keepAlive    bool
 	Ignored      bool
 }
 
 type extension struct {
-	V           null.String `bencode:"v"`
-	QueueLength null.Uint32 `bencode:"reqq"`
+	M            map[string]int `bencode:"m"`
+	V            null.String    `bencode:"v"`
+	MetadataSize null.Int       `bencode:"metadata_size"`
+	QueueLength  null.Uint32    `bencode:"reqq"`
+	Port         null.Uint16    `bencode:"p"`
 }
 
 func (p *Peer) DecodeEvents() (Event, error) {
@@ -115,16 +121,28 @@ func (p *Peer) DecodeEvents() (Event, error) {
 		return event, err
 	case proto.Reject:
 		return p.decodeReject()
+	case proto.HashRequest, proto.HashReject:
+		return p.decodeHashRequest(event.Event, size-1)
+	case proto.Hashes:
+		return p.decodeHashes(size - 1)
 	case proto.Extended:
 		if _, err = io.ReadFull(p.Conn, p.readSizeBuf[:1]); err != nil {
 			return event, err
 		}
 
-		if p.readSizeBuf[0] == 0 {
+		event.ExtID = p.readSizeBuf[0]
+
+		if event.ExtID == proto.ExtHandshakeID {
 			err = bencode.NewDecoder(io.LimitReader(p.Conn, int64(size-2))).Decode(&event.ExtHandshake)
 			return event, err
 		}
 
+		if event.ExtID == extUtMetadata || event.ExtID == extUtPex {
+			event.ExtPayload = make([]byte, size-2)
+			_, err = io.ReadFull(p.Conn, event.ExtPayload)
+			return event, err
+		}
+
 		event.Ignored = true
 		// unknown events
 		_, err = io.CopyN(io.Discard, p.Conn, int64(size-2))
@@ -140,28 +158,24 @@ func (p *Peer) DecodeEvents() (Event, error) {
 func (p *Peer) decodeBitfield(l uint32) (Event, error) {
 	l = l - 1
 
+	// we don't know piece count before metadata is fetched
+	if !p.d.hasMetadata() {
+		_, err := io.CopyN(io.Discard, p.Conn, int64(l))
+		return Event{Event: proto.Bitfield, Ignored: true}, err
+	}
+
 	if l != p.bitfieldSize {
 		return Event{}, errgo.Wrap(ErrPeerSendInvalidData,
 			fmt.Sprintf("expecting bitfield length %d, receive %d", p.bitfieldSize, l))
 	}
 
-	var b = make([]byte, l+8)
-	n, err := io.ReadFull(p.Conn, b[:l])
-	if err != nil {
+	var b = make([]byte, l)
+	if _, err := io.ReadFull(p.Conn, b); err != nil {
 		return Event{}, err
 	}
-	assert.Equal(n, int(l))
-
-	bmLen := l/8 + 8
-
-	var bb = make([]uint64, bmLen)
-	for i := uint32(0); i < bmLen; i += 1 {
-		bb[i] = binary.BigEndian.Uint64(b[i : i+8])
-	}
-
-	bitmap := roaring.FromDense(bb, false)
 
-	return Event{Event: proto.Bitfield, Bitmap: bm.FromBitmap(bitmap, p.d.info.NumPieces)}, nil
+	// spare bits at the end are ignored, peer can't have pieces out of torrent.
+	return Event{Event: proto.Bitfield, Bitmap: bm.FromBitfield(b, p.d.info.NumPieces)}, nil
 }
 
 func (p *Peer) decodeCancel() (Event, error) {
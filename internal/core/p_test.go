@@ -0,0 +1,117 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/puzpuzpuz/xsync/v3"
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/pkg/bm"
+	"tyr/internal/pkg/empty"
+	"tyr/internal/proto"
+)
+
+// newTestPeer create a connected peer without running its event loop, messages sent to peer are discarded.
+func newTestPeer(t *testing.T, d *Download, addr netip.AddrPort) (*Peer, net.Conn) {
+	t.Helper()
+
+	conn, remote := net.Pipe()
+	t.Cleanup(func() { _ = conn.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	p := &Peer{
+		ctx:          ctx,
+		cancel:       cancel,
+		log:          d.log,
+		d:            d,
+		Conn:         conn,
+		Address:      addr,
+		bitfieldSize: (d.info.NumPieces + 7) / 8,
+		Bitmap:       bm.New(d.info.NumPieces),
+		allowFast:    bm.New(d.info.NumPieces),
+		requests:     xsync.NewMapOf[proto.ChunkRequest, empty.Empty](),
+		rejected:     xsync.NewMapOf[proto.ChunkRequest, empty.Empty](),
+		cancelled:    xsync.NewMapOf[proto.ChunkRequest, empty.Empty](),
+	}
+
+	p.QueueLimit.Store(250)
+	p.imChoked.Store(true)
+	p.peerChoked.Store(true)
+
+	d.conn.Store(addr, p)
+
+	return p, remote
+}
+
+func TestPeerHaveOutOfRange(t *testing.T) {
+	d, _ := newTestDownload(t)
+	p, _ := newTestPeer(t, d, netip.MustParseAddrPort("10.0.0.1:6881"))
+
+	require.NoError(t, p.onHave(d.info.NumPieces-1))
+	require.ErrorIs(t, p.onHave(d.info.NumPieces), ErrPeerSendInvalidData)
+	require.ErrorIs(t, p.onHave(math.MaxUint32), ErrPeerSendInvalidData)
+	require.EqualValues(t, 1, p.Bitmap.Count())
+
+	// peer connected before metadata is fetched
+	p.Bitmap = bm.New(0)
+	require.NoError(t, p.onHave(1))
+	require.Zero(t, p.Bitmap.Count())
+}
+
+func TestPeerBitfieldSpareBits(t *testing.T) {
+	d, _ := newTestDownload(t)
+	p, remote := newTestPeer(t, d, netip.MustParseAddrPort("10.0.0.1:6881"))
+
+	go func() {
+		_, _ = io.Copy(remote, bytes.NewReader(bytes.Repeat([]byte{0xff}, int(p.bitfieldSize))))
+	}()
+
+	event, err := p.decodeBitfield(p.bitfieldSize + 1)
+	require.NoError(t, err)
+	require.Equal(t, d.info.NumPieces, event.Bitmap.Count())
+
+	p.Bitmap.OR(event.Bitmap)
+	require.NotPanics(t, func() { d.pieceCandidates() })
+}
+
+func TestPeerRejectedAfterUnchoke(t *testing.T) {
+	d, _ := newTestDownload(t)
+	p, remote := newTestPeer(t, d, netip.MustParseAddrPort("10.0.0.1:6881"))
+	p.supportFastExtension = true
+	p.Bitmap.Fill()
+
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+
+	peers := []*pickerPeer{{p: p, free: 10}}
+	req := d.pieceChunks(0)[0]
+
+	p.onUnchoke()
+	require.Same(t, peers[0], pickPeer(peers, req))
+	require.True(t, p.Request(req))
+	d.reqHistory.Store(req, downloadReq{conn: p})
+
+	// peer with fast extension reject pending requests when choking
+	p.onChoke()
+	p.onReject(req)
+	require.Zero(t, p.requests.Size())
+	_, ok := d.reqHistory.Load(req)
+	require.False(t, ok, "rejected request should be released")
+	require.Nil(t, pickPeer(peers, req))
+
+	p.onUnchoke()
+	require.Same(t, peers[0], pickPeer(peers, req), "request should be sent again after unchoke")
+
+	// allowed fast piece can be requested again while choked
+	p.onChoke()
+	p.onReject(req)
+	p.onAllowedFast(req.PieceIndex)
+	require.Same(t, peers[0], pickPeer(peers, req))
+}
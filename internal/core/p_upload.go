@@ -0,0 +1,173 @@
+package core
+
+import (
+	"slices"
+	"time"
+
+	"github.com/docker/go-units"
+
+	"tyr/internal/pkg/empty"
+	"tyr/internal/pkg/gslice"
+	"tyr/internal/proto"
+)
+
+// most clients never request more than 16 KiB, 128 KiB is the hard limit of libtorrent
+const maxRequestLength = units.KiB * 128
+
+// how many pending requests we accept from a peer
+const maxUploadQueue = 250
+
+// handleRequest validate a request from peer and queue it for uploading
+func (p *Peer) handleRequest(req proto.ChunkRequest) error {
+	if !p.requestIsValid(req) {
+		return p.reject(req)
+	}
+
+	p.uploadMutex.Lock()
+	if len(p.uploadQueue) >= maxUploadQueue {
+		p.uploadMutex.Unlock()
+		return p.reject(req)
+	}
+
+	if !slices.Contains(p.uploadQueue, req) {
+		p.uploadQueue = append(p.uploadQueue, req)
+	}
+	p.uploadMutex.Unlock()
+
+	select {
+	case p.uploadNotify <- empty.Empty{}:
+	default:
+	}
+
+	return nil
+}
+
+func (p *Peer) handleCancel(req proto.ChunkRequest) {
+	p.uploadMutex.Lock()
+	p.uploadQueue = gslice.Remove(p.uploadQueue, req)
+	p.uploadMutex.Unlock()
+}
+
+func (p *Peer) requestIsValid(req proto.ChunkRequest) bool {
+	if p.imChoked.Load() {
+		return false
+	}
+
+	if req.PieceIndex >= p.d.info.NumPieces {
+		return false
+	}
+
+	if req.Length == 0 || req.Length > maxRequestLength {
+		return false
+	}
+
+	if int64(req.Begin)+int64(req.Length) > p.d.pieceLength(req.PieceIndex) {
+		return false
+	}
+
+	p.d.m.RLock()
+	state := p.d.state
+	p.d.m.RUnlock()
+
+	if !(state == Downloading || state == Uploading) {
+		return false
+	}
+
+	return p.d.bm.Get(req.PieceIndex)
+}
+
+// reject tell peer we are not going to response this request.
+// peers without fast extension will just not get response.
+func (p *Peer) reject(req proto.ChunkRequest) error {
+	if !p.supportFastExtension {
+		return nil
+	}
+
+	return p.sendEvent(Event{Event: proto.Reject, Req: req})
+}
+
+// clearUploadQueue drop all pending requests, should be called after peer get choked.
+func (p *Peer) clearUploadQueue() {
+	p.uploadMutex.Lock()
+	queue := p.uploadQueue
+	p.uploadQueue = nil
+	p.uploadMutex.Unlock()
+
+	for _, req := range queue {
+		if err := p.reject(req); err != nil {
+			p.close()
+			return
+		}
+	}
+}
+
+func (p *Peer) popUploadQueue() (proto.ChunkRequest, bool) {
+	p.uploadMutex.Lock()
+	defer p.uploadMutex.Unlock()
+
+	if len(p.uploadQueue) == 0 {
+		return proto.ChunkRequest{}, false
+	}
+
+	req := p.uploadQueue[0]
+	p.uploadQueue = p.uploadQueue[1:]
+
+	return req, true
+}
+
+func (p *Peer) uploadLoop() {
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-p.uploadNotify:
+		}
+
+		for {
+			if p.ctx.Err() != nil {
+				return
+			}
+
+			req, ok := p.popUploadQueue()
+			if !ok {
+				break
+			}
+
+			// peer may get choked after request is queued
+			if !p.requestIsValid(req) {
+				if err := p.reject(req); err != nil {
+					p.close()
+					return
+				}
+				continue
+			}
+
+			data, err := p.d.readChunk(req)
+			if err != nil {
+				p.log.Debug().Err(err).Msg("failed to read chunk from disk")
+				if err = p.reject(req); err != nil {
+					p.close()
+					return
+				}
+				continue
+			}
+
+			err = p.sendEvent(Event{
+				Event: proto.Piece,
+				Res: proto.ChunkResponse{
+					Data:       data,
+					Begin:      req.Begin,
+					PieceIndex: req.PieceIndex,
+				},
+			})
+			if err != nil {
+				p.close()
+				return
+			}
+
+			p.d.uploaded.Add(int64(len(data)))
+			p.d.ioUp.Update(len(data))
+			p.d.lastUploadAt.Store(time.Now().Unix())
+		}
+	}
+}
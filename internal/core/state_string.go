@@ -14,11 +14,14 @@ func _() {
 	_ = x[Checking-3]
 	_ = x[Moving-4]
 	_ = x[Error-5]
+	_ = x[FetchingMetadata-6]
+	_ = x[CheckQueued-7]
+	_ = x[Queued-8]
 }
 
-const _State_name = "StoppedDownloadingUploadingCheckingMovingError"
+const _State_name = "StoppedDownloadingUploadingCheckingMovingErrorFetchingMetadataCheckQueuedQueued"
 
-var _State_index = [...]uint8{0, 7, 18, 27, 35, 41, 46}
+var _State_index = [...]uint8{0, 7, 18, 27, 35, 41, 46, 62, 73, 79}
 
 func (i State) String() string {
 	if i >= State(len(_State_index)-1) {
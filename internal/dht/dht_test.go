@@ -0,0 +1,67 @@
+package dht_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/dht"
+)
+
+func newServer(t *testing.T, cfg dht.Config) (*dht.Server, netip.AddrPort) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := dht.New(conn, cfg)
+	s.Start()
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+
+	return s, conn.LocalAddr().(*net.UDPAddr).AddrPort()
+}
+
+func TestAnnounceAndGetPeers(t *testing.T) {
+	ctx := context.Background()
+
+	_, addr1 := newServer(t, dht.Config{})
+	s2, _ := newServer(t, dht.Config{})
+	s3, _ := newServer(t, dht.Config{})
+
+	require.NoError(t, s2.Ping(ctx, addr1))
+	require.NoError(t, s3.Ping(ctx, addr1))
+
+	var infoHash = [20]byte{1, 2, 3}
+
+	peers := s2.Announce(ctx, infoHash, 6881)
+	require.Empty(t, peers)
+
+	peers = s3.GetPeers(ctx, infoHash)
+	require.Equal(t, []netip.AddrPort{netip.MustParseAddrPort("127.0.0.1:6881")}, peers)
+}
+
+func TestPersistState(t *testing.T) {
+	ctx := context.Background()
+	statePath := filepath.Join(t.TempDir(), "dht.dat")
+
+	_, addr1 := newServer(t, dht.Config{})
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := dht.New(conn, dht.Config{StatePath: statePath})
+	s.Start()
+	require.NoError(t, s.Ping(ctx, addr1))
+	require.NoError(t, s.Close())
+
+	restored, _ := newServer(t, dht.Config{StatePath: statePath})
+
+	require.Equal(t, s.ID(), restored.ID())
+	require.Equal(t, 1, restored.NodeCount())
+}
@@ -0,0 +1,42 @@
+package dht
+
+import (
+	"encoding/hex"
+	"math/bits"
+
+	"tyr/internal/pkg/random"
+)
+
+type ID [20]byte
+
+func RandomID() ID {
+	return ID(random.Bytes(20))
+}
+
+func (id ID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// commonPrefixLen return number of leading bits shared by 2 ids, 160 for same id.
+func (id ID) commonPrefixLen(o ID) int {
+	for i := range id {
+		if x := id[i] ^ o[i]; x != 0 {
+			return i*8 + bits.LeadingZeros8(x)
+		}
+	}
+
+	return 160
+}
+
+// closer check if a is closer to id than b
+func (id ID) closer(a, b ID) bool {
+	for i := range id {
+		da := a[i] ^ id[i]
+		db := b[i] ^ id[i]
+		if da != db {
+			return da < db
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,144 @@
+package dht
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+const (
+	queryPing         = "ping"
+	queryFindNode     = "find_node"
+	queryGetPeers     = "get_peers"
+	queryAnnouncePeer = "announce_peer"
+)
+
+const (
+	typeQuery    = "q"
+	typeResponse = "r"
+	typeError    = "e"
+)
+
+// KRPC error codes
+const (
+	errorGeneric       = 201
+	errorProtocol      = 203
+	errorMethodUnknown = 204
+)
+
+type msg struct {
+	A *msgArgs   `bencode:"a,omitempty"`
+	R *msgReturn `bencode:"r,omitempty"`
+	T string     `bencode:"t"`
+	Y string     `bencode:"y"`
+	Q string     `bencode:"q,omitempty"`
+	E []any      `bencode:"e,omitempty"`
+}
+
+type msgArgs struct {
+	ID          string `bencode:"id"`
+	Target      string `bencode:"target,omitempty"`
+	InfoHash    string `bencode:"info_hash,omitempty"`
+	Token       string `bencode:"token,omitempty"`
+	Port        int    `bencode:"port,omitempty"`
+	ImpliedPort int    `bencode:"implied_port,omitempty"`
+}
+
+type msgReturn struct {
+	ID     string   `bencode:"id"`
+	Nodes  string   `bencode:"nodes,omitempty"`
+	Token  string   `bencode:"token,omitempty"`
+	Values []string `bencode:"values,omitempty"`
+}
+
+// Error is a KRPC error response from remote node
+type Error struct {
+	Message string
+	Code    int
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("krpc error %d: %s", e.Code, e.Message)
+}
+
+func parseError(e []any) Error {
+	var r = Error{Code: errorGeneric}
+
+	if len(e) >= 1 {
+		if code, ok := e[0].(int64); ok {
+			r.Code = int(code)
+		}
+	}
+
+	if len(e) >= 2 {
+		if message, ok := e[1].(string); ok {
+			r.Message = message
+		}
+	}
+
+	return r
+}
+
+var errInvalidCompact = errors.New("invalid compact format")
+
+const compactNodeLen = 20 + 6
+
+func encodeNodes(nodes []*node) string {
+	var b = make([]byte, 0, len(nodes)*compactNodeLen)
+	for _, n := range nodes {
+		b = append(b, n.id[:]...)
+		b = appendCompactAddr(b, n.addr)
+	}
+
+	return string(b)
+}
+
+func decodeNodes(s string) ([]*node, error) {
+	if len(s)%compactNodeLen != 0 {
+		return nil, errInvalidCompact
+	}
+
+	var nodes = make([]*node, 0, len(s)/compactNodeLen)
+	for i := 0; i < len(s); i += compactNodeLen {
+		var id ID
+		copy(id[:], s[i:i+20])
+		addr := parseCompactAddr([]byte(s[i+20 : i+compactNodeLen]))
+		if addr.Port() == 0 {
+			continue
+		}
+
+		nodes = append(nodes, &node{id: id, addr: addr})
+	}
+
+	return nodes, nil
+}
+
+func appendCompactAddr(b []byte, addr netip.AddrPort) []byte {
+	ip := addr.Addr().As4()
+	b = append(b, ip[:]...)
+	return binary.BigEndian.AppendUint16(b, addr.Port())
+}
+
+func parseCompactAddr(b []byte) netip.AddrPort {
+	return netip.AddrPortFrom(netip.AddrFrom4([4]byte(b[:4])), binary.BigEndian.Uint16(b[4:6]))
+}
+
+func decodeValues(values []string) []netip.AddrPort {
+	var r = make([]netip.AddrPort, 0, len(values))
+
+	for _, v := range values {
+		if len(v) != 6 {
+			continue
+		}
+
+		addr := parseCompactAddr([]byte(v))
+		if addr.Port() == 0 {
+			continue
+		}
+
+		r = append(r, addr)
+	}
+
+	return r
+}
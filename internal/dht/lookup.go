@@ -0,0 +1,171 @@
+package dht
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"sync"
+
+	"github.com/samber/lo"
+)
+
+// number of concurrent queries in a lookup
+const alpha = 3
+
+type lookupNode struct {
+	*node
+	token   string
+	queried bool
+	ok      bool
+}
+
+type lookupResult struct {
+	// closest nodes responded, with token if it's a get_peers lookup
+	closest []*lookupNode
+	peers   []netip.AddrPort
+}
+
+// lookup find closest nodes to target iteratively, and peers if getPeers is true.
+func (s *Server) lookup(ctx context.Context, target ID, getPeers bool) lookupResult {
+	var m sync.Mutex
+	var peers []netip.AddrPort
+
+	var seen = make(map[netip.AddrPort]bool)
+	var shortlist []*lookupNode
+
+	add := func(nodes []*node) {
+		for _, n := range nodes {
+			if n.id == s.id || seen[n.addr] {
+				continue
+			}
+
+			seen[n.addr] = true
+			shortlist = append(shortlist, &lookupNode{node: n})
+		}
+
+		sortLookupNodes(shortlist, target)
+	}
+
+	add(s.table.closest(target, K))
+
+	for ctx.Err() == nil {
+		var round []*lookupNode
+
+		var responded int
+		for _, n := range shortlist {
+			if responded >= K || len(round) >= alpha {
+				break
+			}
+
+			if !n.queried {
+				round = append(round, n)
+			} else if n.ok {
+				responded++
+			}
+		}
+
+		if len(round) == 0 {
+			break
+		}
+
+		var wg sync.WaitGroup
+		var found []*node
+
+		for _, n := range round {
+			n.queried = true
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				var res *msgReturn
+				var err error
+				if getPeers {
+					res, err = s.query(ctx, n.addr, queryGetPeers, msgArgs{InfoHash: string(target[:])})
+				} else {
+					res, err = s.query(ctx, n.addr, queryFindNode, msgArgs{Target: string(target[:])})
+				}
+
+				if err != nil {
+					return
+				}
+
+				nodes, _ := decodeNodes(res.Nodes)
+
+				m.Lock()
+				defer m.Unlock()
+
+				n.ok = true
+				n.id = ID([]byte(res.ID))
+				n.token = res.Token
+				peers = append(peers, decodeValues(res.Values)...)
+				found = append(found, nodes...)
+			}()
+		}
+
+		wg.Wait()
+
+		add(found)
+	}
+
+	var closest = make([]*lookupNode, 0, K)
+	for _, n := range shortlist {
+		if n.ok {
+			closest = append(closest, n)
+		}
+
+		if len(closest) >= K {
+			break
+		}
+	}
+
+	return lookupResult{closest: closest, peers: lo.Uniq(peers)}
+}
+
+func sortLookupNodes(nodes []*lookupNode, target ID) {
+	slices.SortFunc(nodes, func(a, b *lookupNode) int {
+		if a.id == b.id {
+			return 0
+		}
+
+		if target.closer(a.id, b.id) {
+			return -1
+		}
+
+		return 1
+	})
+}
+
+// GetPeers find peers of info hash from DHT network.
+func (s *Server) GetPeers(ctx context.Context, infoHash [20]byte) []netip.AddrPort {
+	return s.lookup(ctx, infoHash, true).peers
+}
+
+// Announce find peers of info hash, and announce we are downloading it on port.
+func (s *Server) Announce(ctx context.Context, infoHash [20]byte, port uint16) []netip.AddrPort {
+	r := s.lookup(ctx, infoHash, true)
+
+	var wg sync.WaitGroup
+	for _, n := range r.closest {
+		if n.token == "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.query(ctx, n.addr, queryAnnouncePeer, msgArgs{
+				InfoHash: string(infoHash[:]),
+				Port:     int(port),
+				Token:    n.token,
+			})
+			if err != nil {
+				s.log.Trace().Err(err).Stringer("addr", n.addr).Msg("failed to announce peer")
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return r.peers
+}
@@ -0,0 +1,73 @@
+package dht
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// announced peers expire after 30 minutes
+const peerTTL = time.Minute * 30
+
+// max peers returned in a get_peers response
+const maxPeerValues = 50
+
+// peerStore keep peers announced by other nodes
+type peerStore struct {
+	peers map[ID]map[netip.AddrPort]time.Time
+	m     sync.Mutex
+}
+
+func newPeerStore() *peerStore {
+	return &peerStore{peers: make(map[ID]map[netip.AddrPort]time.Time)}
+}
+
+func (s *peerStore) add(infoHash ID, addr netip.AddrPort) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	peers, ok := s.peers[infoHash]
+	if !ok {
+		peers = make(map[netip.AddrPort]time.Time)
+		s.peers[infoHash] = peers
+	}
+
+	peers[addr] = time.Now()
+}
+
+func (s *peerStore) get(infoHash ID) []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var values []string
+	for addr, t := range s.peers[infoHash] {
+		if time.Since(t) > peerTTL {
+			delete(s.peers[infoHash], addr)
+			continue
+		}
+
+		values = append(values, string(appendCompactAddr(nil, addr)))
+		if len(values) >= maxPeerValues {
+			break
+		}
+	}
+
+	return values
+}
+
+func (s *peerStore) expire() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for infoHash, peers := range s.peers {
+		for addr, t := range peers {
+			if time.Since(t) > peerTTL {
+				delete(peers, addr)
+			}
+		}
+
+		if len(peers) == 0 {
+			delete(s.peers, infoHash)
+		}
+	}
+}
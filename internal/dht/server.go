@@ -0,0 +1,365 @@
+// Package dht implement a mainline DHT node, BEP 5.
+//
+// https://www.bittorrent.org/beps/bep_0005.html
+package dht
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.uber.org/atomic"
+)
+
+var DefaultBootstrap = []string{
+	"router.bittorrent.com:6881",
+	"router.utorrent.com:6881",
+	"dht.transmissionbt.com:6881",
+	"dht.libtorrent.org:25401",
+}
+
+const queryTimeout = time.Second * 5
+
+var ErrTimeout = errors.New("dht query timeout")
+var ErrClosed = errors.New("dht server closed")
+
+type Config struct {
+	// file to persist node id and routing table, empty to disable
+	StatePath string
+	Bootstrap []string
+}
+
+type transaction struct {
+	res  chan *msg
+	addr netip.AddrPort
+}
+
+// Server is a DHT node
+type Server struct {
+	ctx     context.Context
+	conn    net.PacketConn
+	log     zerolog.Logger
+	table   *table
+	peers   *peerStore
+	tokens  *tokenManager
+	pending map[string]*transaction
+	cancel  context.CancelFunc
+	cfg     Config
+	tid     atomic.Uint32
+	m       sync.Mutex
+	id      ID
+}
+
+// New create a DHT node on a udp connection.
+// State will be loaded from Config.StatePath if exists.
+func New(conn net.PacketConn, cfg Config) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	st, err := loadState(cfg.StatePath)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to load dht state")
+	}
+
+	id := st.id
+	if id == (ID{}) {
+		id = RandomID()
+	}
+
+	s := &Server{
+		ctx:     ctx,
+		cancel:  cancel,
+		conn:    conn,
+		cfg:     cfg,
+		id:      id,
+		log:     log.With().Str("module", "dht").Logger(),
+		table:   newTable(id),
+		peers:   newPeerStore(),
+		tokens:  newTokenManager(),
+		pending: make(map[string]*transaction),
+	}
+
+	for _, n := range st.nodes {
+		s.table.seen(n.id, n.addr)
+	}
+
+	return s
+}
+
+func (s *Server) ID() ID {
+	return s.id
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// NodeCount return number of nodes in routing table
+func (s *Server) NodeCount() int {
+	return s.table.size()
+}
+
+// Start reading packets from connection, and bootstrap routing table.
+func (s *Server) Start() {
+	go s.readLoop()
+	go s.maintain()
+}
+
+// Close save state and close connection
+func (s *Server) Close() error {
+	s.cancel()
+
+	if err := s.saveState(); err != nil {
+		s.log.Err(err).Msg("failed to save dht state")
+	}
+
+	return s.conn.Close()
+}
+
+func (s *Server) readLoop() {
+	var buf = make([]byte, 65536)
+
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+
+			s.log.Debug().Err(err).Msg("failed to read from udp")
+			return
+		}
+
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		s.HandlePacket(buf[:n], udpAddr.AddrPort())
+	}
+}
+
+// HandlePacket handle a KRPC packet from addr.
+func (s *Server) HandlePacket(b []byte, addr netip.AddrPort) {
+	addr = netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port())
+
+	var m msg
+	if err := bencode.Unmarshal(b, &m); err != nil {
+		return
+	}
+
+	switch m.Y {
+	case typeQuery:
+		s.handleQuery(m, addr)
+	case typeResponse, typeError:
+		s.m.Lock()
+		t, ok := s.pending[m.T]
+		if ok && t.addr == addr {
+			delete(s.pending, m.T)
+		}
+		s.m.Unlock()
+
+		if ok && t.addr == addr {
+			t.res <- &m
+		}
+	}
+}
+
+func (s *Server) send(m msg, addr netip.AddrPort) error {
+	b, err := bencode.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn.WriteTo(b, net.UDPAddrFromAddrPort(addr))
+	return err
+}
+
+// query send a query and wait for response
+func (s *Server) query(ctx context.Context, addr netip.AddrPort, q string, args msgArgs) (*msgReturn, error) {
+	args.ID = string(s.id[:])
+
+	tid := string(binary.BigEndian.AppendUint16(nil, uint16(s.tid.Inc())))
+	t := &transaction{res: make(chan *msg, 1), addr: addr}
+
+	s.m.Lock()
+	s.pending[tid] = t
+	s.m.Unlock()
+
+	defer func() {
+		s.m.Lock()
+		delete(s.pending, tid)
+		s.m.Unlock()
+	}()
+
+	if err := s.send(msg{T: tid, Y: typeQuery, Q: q, A: &args}, addr); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	select {
+	case <-s.ctx.Done():
+		return nil, ErrClosed
+	case <-ctx.Done():
+		s.table.failed(addr)
+		return nil, ErrTimeout
+	case res := <-t.res:
+		if res.Y == typeError {
+			return nil, parseError(res.E)
+		}
+
+		if res.R == nil || len(res.R.ID) != 20 {
+			s.table.failed(addr)
+			return nil, Error{Code: errorProtocol, Message: "invalid response"}
+		}
+
+		s.table.seen(ID([]byte(res.R.ID)), addr)
+
+		return res.R, nil
+	}
+}
+
+func (s *Server) handleQuery(m msg, addr netip.AddrPort) {
+	if m.A == nil || len(m.A.ID) != 20 {
+		s.sendError(m.T, addr, errorProtocol, "invalid arguments")
+		return
+	}
+
+	r := &msgReturn{ID: string(s.id[:])}
+
+	switch m.Q {
+	case queryPing:
+	case queryFindNode:
+		if len(m.A.Target) != 20 {
+			s.sendError(m.T, addr, errorProtocol, "invalid target")
+			return
+		}
+
+		r.Nodes = encodeNodes(s.table.closest(ID([]byte(m.A.Target)), K))
+	case queryGetPeers:
+		if len(m.A.InfoHash) != 20 {
+			s.sendError(m.T, addr, errorProtocol, "invalid info_hash")
+			return
+		}
+
+		infoHash := ID([]byte(m.A.InfoHash))
+		r.Token = s.tokens.create(addr.Addr())
+		r.Values = s.peers.get(infoHash)
+		if len(r.Values) == 0 {
+			r.Nodes = encodeNodes(s.table.closest(infoHash, K))
+		}
+	case queryAnnouncePeer:
+		if len(m.A.InfoHash) != 20 {
+			s.sendError(m.T, addr, errorProtocol, "invalid info_hash")
+			return
+		}
+
+		if !s.tokens.validate(m.A.Token, addr.Addr()) {
+			s.sendError(m.T, addr, errorProtocol, "invalid token")
+			return
+		}
+
+		port := uint16(m.A.Port)
+		if m.A.ImpliedPort != 0 {
+			port = addr.Port()
+		}
+
+		if port == 0 {
+			s.sendError(m.T, addr, errorProtocol, "invalid port")
+			return
+		}
+
+		s.peers.add(ID([]byte(m.A.InfoHash)), netip.AddrPortFrom(addr.Addr(), port))
+	default:
+		s.sendError(m.T, addr, errorMethodUnknown, "method unknown")
+		return
+	}
+
+	s.table.seen(ID([]byte(m.A.ID)), addr)
+
+	if err := s.send(msg{T: m.T, Y: typeResponse, R: r}, addr); err != nil {
+		s.log.Trace().Err(err).Msg("failed to send response")
+	}
+}
+
+func (s *Server) sendError(tid string, addr netip.AddrPort, code int, message string) {
+	_ = s.send(msg{T: tid, Y: typeError, E: []any{code, message}}, addr)
+}
+
+// Ping a node and add it to routing table if it responses.
+func (s *Server) Ping(ctx context.Context, addr netip.AddrPort) error {
+	_, err := s.query(ctx, addr, queryPing, msgArgs{})
+	return err
+}
+
+// AddNode ping a node in background, used for nodes from PORT message.
+func (s *Server) AddNode(addr netip.AddrPort) {
+	go func() {
+		_ = s.Ping(s.ctx, addr)
+	}()
+}
+
+func (s *Server) maintain() {
+	s.bootstrap()
+
+	ticker := time.NewTicker(time.Minute * 5)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.peers.expire()
+
+			if s.table.size() < K {
+				s.bootstrap()
+			} else {
+				s.lookup(s.ctx, s.id, false)
+			}
+
+			if err := s.saveState(); err != nil {
+				s.log.Err(err).Msg("failed to save dht state")
+			}
+		}
+	}
+}
+
+func (s *Server) bootstrap() {
+	var wg sync.WaitGroup
+
+	for _, host := range s.cfg.Bootstrap {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			addr, err := net.ResolveUDPAddr("udp4", host)
+			if err != nil {
+				s.log.Debug().Err(err).Str("host", host).Msg("failed to resolve bootstrap node")
+				return
+			}
+
+			// node will be added to routing table if it responses
+			_, _ = s.query(s.ctx, addr.AddrPort(), queryFindNode, msgArgs{Target: string(s.id[:])})
+		}()
+	}
+
+	wg.Wait()
+
+	s.lookup(s.ctx, s.id, false)
+
+	s.log.Debug().Msgf("bootstrap done, %d nodes in routing table", s.table.size())
+}
@@ -0,0 +1,69 @@
+package dht
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+type stateFile struct {
+	ID    string `bencode:"id"`
+	Nodes string `bencode:"nodes"`
+}
+
+type state struct {
+	nodes []*node
+	id    ID
+}
+
+func loadState(path string) (state, error) {
+	if path == "" {
+		return state{}, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state{}, nil
+		}
+
+		return state{}, err
+	}
+
+	var f stateFile
+	if err = bencode.Unmarshal(b, &f); err != nil {
+		return state{}, err
+	}
+
+	if len(f.ID) != 20 {
+		return state{}, nil
+	}
+
+	nodes, err := decodeNodes(f.Nodes)
+	if err != nil {
+		return state{}, err
+	}
+
+	return state{id: ID([]byte(f.ID)), nodes: nodes}, nil
+}
+
+func (s *Server) saveState() error {
+	if s.cfg.StatePath == "" {
+		return nil
+	}
+
+	b, err := bencode.Marshal(stateFile{
+		ID:    string(s.id[:]),
+		Nodes: encodeNodes(s.table.closest(s.id, 160*K)),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.cfg.StatePath), os.ModePerm); err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.cfg.StatePath, b, os.ModePerm)
+}
@@ -0,0 +1,135 @@
+package dht
+
+import (
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+)
+
+// K is the max size of a bucket
+const K = 8
+
+// node is questionable after it's not seen in 15 minutes
+const nodeQuestionableTimeout = time.Minute * 15
+
+// node is bad after failed to response continuous queries
+const nodeMaxFailures = 2
+
+type node struct {
+	lastSeen time.Time
+	addr     netip.AddrPort
+	failures int
+	id       ID
+}
+
+func (n *node) bad() bool {
+	return n.failures >= nodeMaxFailures || time.Since(n.lastSeen) > nodeQuestionableTimeout
+}
+
+// table is a simplified kademlia routing table,
+// nodes are bucketed by common prefix length with our own id.
+type table struct {
+	buckets [161][]*node
+	m       sync.RWMutex
+	self    ID
+}
+
+func newTable(self ID) *table {
+	return &table{self: self}
+}
+
+// seen add node to table or update its last seen time.
+func (t *table) seen(id ID, addr netip.AddrPort) {
+	if id == t.self || !addr.Addr().Is4() {
+		return
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	i := t.self.commonPrefixLen(id)
+	bucket := t.buckets[i]
+
+	for _, n := range bucket {
+		if n.id == id {
+			n.addr = addr
+			n.lastSeen = time.Now()
+			n.failures = 0
+			return
+		}
+	}
+
+	n := &node{id: id, addr: addr, lastSeen: time.Now()}
+
+	if len(bucket) < K {
+		t.buckets[i] = append(bucket, n)
+		return
+	}
+
+	for j, old := range bucket {
+		if old.bad() {
+			bucket[j] = n
+			return
+		}
+	}
+}
+
+// failed increase node failures count, bad nodes will be replaced.
+func (t *table) failed(addr netip.AddrPort) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for _, bucket := range t.buckets {
+		for _, n := range bucket {
+			if n.addr == addr {
+				n.failures++
+				return
+			}
+		}
+	}
+}
+
+// closest return at most count good nodes closest to target.
+func (t *table) closest(target ID, count int) []*node {
+	t.m.RLock()
+	var nodes = make([]*node, 0, count*2)
+	for _, bucket := range t.buckets {
+		for _, n := range bucket {
+			if n.failures < nodeMaxFailures {
+				nodes = append(nodes, &node{id: n.id, addr: n.addr, lastSeen: n.lastSeen})
+			}
+		}
+	}
+	t.m.RUnlock()
+
+	sortByDistance(nodes, target)
+
+	return nodes[:min(count, len(nodes))]
+}
+
+func (t *table) size() int {
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	var s int
+	for _, bucket := range t.buckets {
+		s += len(bucket)
+	}
+
+	return s
+}
+
+func sortByDistance(nodes []*node, target ID) {
+	slices.SortFunc(nodes, func(a, b *node) int {
+		if a.id == b.id {
+			return 0
+		}
+
+		if target.closer(a.id, b.id) {
+			return -1
+		}
+
+		return 1
+	})
+}
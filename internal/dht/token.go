@@ -0,0 +1,65 @@
+package dht
+
+import (
+	"crypto/sha1"
+	"net/netip"
+	"sync"
+	"time"
+
+	"tyr/internal/pkg/random"
+)
+
+const tokenRotateInterval = time.Minute * 5
+
+// tokenManager generate tokens for get_peers response,
+// tokens from last rotation are still accepted.
+type tokenManager struct {
+	lastRotate time.Time
+	secret     []byte
+	previous   []byte
+	m          sync.Mutex
+}
+
+func newTokenManager() *tokenManager {
+	return &tokenManager{
+		secret:     random.Bytes(20),
+		previous:   random.Bytes(20),
+		lastRotate: time.Now(),
+	}
+}
+
+func (t *tokenManager) rotate() {
+	if time.Since(t.lastRotate) < tokenRotateInterval {
+		return
+	}
+
+	t.previous = t.secret
+	t.secret = random.Bytes(20)
+	t.lastRotate = time.Now()
+}
+
+func (t *tokenManager) create(addr netip.Addr) string {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.rotate()
+
+	return tokenFor(t.secret, addr)
+}
+
+func (t *tokenManager) validate(token string, addr netip.Addr) bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.rotate()
+
+	return token == tokenFor(t.secret, addr) || token == tokenFor(t.previous, addr)
+}
+
+func tokenFor(secret []byte, addr netip.Addr) string {
+	h := sha1.New()
+	h.Write(secret)
+	h.Write(addr.AsSlice())
+
+	return string(h.Sum(nil))
+}
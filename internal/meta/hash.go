@@ -21,3 +21,25 @@ func (h Hash) String() string {
 func (h Hash) Hex() string {
 	return hex.EncodeToString(h[:])
 }
+
+// HashV2 is SHA-256 hash used by BitTorrent v2, for info hash and merkle tree.
+type HashV2 [32]byte
+
+func (h HashV2) Bytes() []byte { return h[:] }
+
+func (h HashV2) String() string {
+	return h.Hex()
+}
+
+func (h HashV2) Hex() string {
+	return hex.EncodeToString(h[:])
+}
+
+func (h HashV2) Zero() bool {
+	return h == HashV2{}
+}
+
+// Truncate return first 20 bytes of v2 info hash, which is used in handshake, tracker and DHT.
+func (h HashV2) Truncate() Hash {
+	return Hash(h[:20])
+}
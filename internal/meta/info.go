@@ -1,8 +1,14 @@
 package meta
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
 	"errors"
+	"fmt"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/metainfo"
@@ -14,80 +20,281 @@ import (
 type File struct {
 	Path   string
 	Length int64
+	// PiecesRoot is root hash of file merkle tree, only set for non-empty files of v2 torrent.
+	PiecesRoot HashV2
+	// Pad is a padding file to align next file to piece boundary, it's all zero and not stored on disk.
+	Pad bool
 }
 
 type Info struct {
-	Name          string
-	Pieces        []Hash
-	Files         []File
+	Name string
+	// Pieces is SHA-1 piece hashes, nil for v2 only torrent.
+	Pieces []Hash
+	// PiecesV2 is SHA-256 piece hashes from piece layers, or pieces root for file not larger than a piece.
+	// hash is zero for pieces of v1 torrent or pieces which layer is missing.
+	PiecesV2 []HashV2
+	Files    []File
+	// HTTPSeeds is BEP 17 http seeds, it's not a field of metainfo.MetaInfo so only Parse set it.
+	HTTPSeeds     []string
 	TotalLength   int64
 	PieceLength   int64
 	LastPieceSize int64
-	Hash          Hash
-	NumPieces     uint32
-	Private       bool
+	// Hash is info hash used in handshake and tracker, it's truncated v2 info hash for v2 only torrent.
+	Hash      Hash
+	HashV2    HashV2
+	NumPieces uint32
+	Private   bool
 }
 
-var ErrNotV1Torrent = errors.New("meta info has no v1 info")
-var ErrInvalidLength = errors.New("meta info has no v1 info")
+func (i Info) HasV1() bool {
+	return i.Pieces != nil
+}
+
+func (i Info) HasV2() bool {
+	return !i.HashV2.Zero()
+}
+
+// InfoHashes return info hashes peers may use for this torrent,
+// hybrid torrent can be found by both v1 and truncated v2 info hash.
+func (i Info) InfoHashes() []Hash {
+	if i.HasV1() && i.HasV2() {
+		return []Hash{i.Hash, i.HashV2.Truncate()}
+	}
+
+	return []Hash{i.Hash}
+}
 
-func ParseV1(b []byte) (Info, error) {
+var ErrInvalidLength = errors.New("meta info has invalid piece count")
+var ErrInvalidPieceLayers = errors.New("piece layers don't match pieces root")
+
+func Parse(b []byte) (Info, error) {
 	var m metainfo.MetaInfo
 	err := bencode.Unmarshal(b, &m)
 	if err != nil {
 		return Info{}, err
 	}
 
-	return FromTorrent(m)
+	i, err := FromTorrent(m)
+	if err != nil {
+		return Info{}, err
+	}
+
+	i.HTTPSeeds = HTTPSeeds(b)
+
+	return i, nil
+}
+
+// HTTPSeeds return BEP 17 `httpseeds` of torrent file, invalid torrent file has no http seeds.
+func HTTPSeeds(b []byte) []string {
+	var t struct {
+		HTTPSeeds []string `bencode:"httpseeds"`
+	}
+
+	if bencode.Unmarshal(b, &t) != nil {
+		return nil
+	}
+
+	return t.HTTPSeeds
 }
 
+// FromTorrent parse v1, v2 or hybrid torrent.
+// Piece layers of v2 torrent may be missing if info is fetched from peers.
 func FromTorrent(m metainfo.MetaInfo) (Info, error) {
 	info, err := m.UnmarshalInfo()
 	if err != nil {
 		return Info{}, err
 	}
 
-	if !info.HasV1() {
-		return Info{}, ErrNotV1Torrent
+	i := Info{
+		Private:     null.NewFromPtr(info.Private).Value,
+		Name:        info.BestName(),
+		PieceLength: info.PieceLength,
 	}
 
-	var pieces = make([]Hash, info.NumPieces())
-	for i := 0; i < info.NumPieces(); i++ {
-		pieces[i] = Hash(info.Piece(i).V1Hash().Unwrap())
+	if info.PieceLength <= 0 {
+		return Info{}, ErrInvalidLength
 	}
 
-	var files []File
-	if len(info.Files) != 0 {
-		files = lo.Map(info.Files, func(item metainfo.FileInfo, index int) File {
-			return File{
-				Path:   filepath.Join(item.BestPath()...),
-				Length: item.Length,
-			}
-		})
-	} else {
-		files = []File{
-			{
-				Path:   info.BestName(),
-				Length: info.TotalLength(),
-			},
+	if info.HasV2() {
+		i.HashV2 = sha256.Sum256(m.InfoBytes)
+		i.Hash = i.HashV2.Truncate()
+	}
+
+	if info.HasV1() {
+		i.Hash = sha1.Sum(m.InfoBytes)
+		i.Pieces = make([]Hash, len(info.Pieces)/sha1.Size)
+		for p := range i.Pieces {
+			i.Pieces[p] = Hash(info.Piece(p).V1Hash().Unwrap())
 		}
+
+		i.Files = v1Files(info)
+	} else {
+		i.Files = v2Files(info)
 	}
 
-	i := Info{
-		Hash:          Hash(m.HashInfoBytes()),
-		Private:       null.NewFromPtr(info.Private).Value,
-		Name:          info.BestName(),
-		TotalLength:   info.TotalLength(),
-		Pieces:        pieces,
-		NumPieces:     uint32(info.NumPieces()),
-		PieceLength:   info.PieceLength,
-		LastPieceSize: info.TotalLength() - info.PieceLength*int64(info.NumPieces()-1),
-		Files:         files,
-	}
-
-	if int64(i.NumPieces) != (i.TotalLength+i.PieceLength-1)/i.PieceLength {
+	for _, f := range i.Files {
+		i.TotalLength += f.Length
+	}
+
+	i.NumPieces = uint32((i.TotalLength + i.PieceLength - 1) / i.PieceLength)
+	i.LastPieceSize = i.TotalLength - i.PieceLength*int64(i.NumPieces-1)
+
+	if i.HasV1() && len(i.Pieces) != int(i.NumPieces) {
 		return Info{}, ErrInvalidLength
 	}
 
+	if i.HasV2() {
+		i.PiecesV2, err = piecesV2(i.Files, m.PieceLayers, i.PieceLength, i.NumPieces)
+		if err != nil {
+			return Info{}, err
+		}
+	}
+
 	return i, nil
 }
+
+func isPadFile(f metainfo.FileInfo) bool {
+	return strings.Contains(f.Attr, "p") || (len(f.Path) != 0 && f.Path[0] == ".pad")
+}
+
+// v1Files return files of v1 or hybrid torrent, pieces root of hybrid torrent is filled from file tree.
+func v1Files(info metainfo.Info) []File {
+	if len(info.Files) == 0 {
+		f := File{Path: info.BestName(), Length: info.TotalLength()}
+		if info.HasV2() {
+			for _, v2 := range info.UpvertedFiles() {
+				f.PiecesRoot = v2.PiecesRoot.Value
+			}
+		}
+
+		return []File{f}
+	}
+
+	var roots = make(map[string]HashV2)
+	if info.HasV2() {
+		for _, f := range info.UpvertedFiles() {
+			roots[filepath.Join(f.BestPath()...)] = f.PiecesRoot.Value
+		}
+	}
+
+	return lo.Map(info.Files, func(item metainfo.FileInfo, index int) File {
+		p := filepath.Join(item.BestPath()...)
+
+		return File{
+			Path:       p,
+			Length:     item.Length,
+			PiecesRoot: roots[p],
+			Pad:        isPadFile(item),
+		}
+	})
+}
+
+// v2Files return files of v2 only torrent, pad files are added so every file start at piece boundary,
+// then pieces can be mapped to files in the same way of v1 torrent.
+func v2Files(info metainfo.Info) []File {
+	var files []File
+	var offset int64
+
+	for _, f := range info.UpvertedFiles() {
+		if f.TorrentOffset > offset {
+			files = append(files, padFile(f.TorrentOffset-offset))
+		}
+
+		files = append(files, File{
+			Path:       filepath.Join(f.BestPath()...),
+			Length:     f.Length,
+			PiecesRoot: f.PiecesRoot.Value,
+		})
+
+		offset = f.TorrentOffset + f.Length
+	}
+
+	return files
+}
+
+func padFile(size int64) File {
+	return File{Path: filepath.Join(".pad", strconv.FormatInt(size, 10)), Length: size, Pad: true}
+}
+
+// piecesV2 map piece layers to pieces, file of v2 torrent always start at piece boundary.
+func piecesV2(files []File, layers map[string]string, pieceLength int64, numPieces uint32) ([]HashV2, error) {
+	var r = make([]HashV2, numPieces)
+	var offset int64
+
+	for _, f := range files {
+		start := offset
+		offset += f.Length
+
+		if f.Pad || f.PiecesRoot.Zero() {
+			continue
+		}
+
+		if start%pieceLength != 0 {
+			return nil, fmt.Errorf("file %q is not aligned to piece", f.Path)
+		}
+
+		first := start / pieceLength
+		if f.Length <= pieceLength {
+			r[first] = f.PiecesRoot
+			continue
+		}
+
+		layer, ok := layers[string(f.PiecesRoot[:])]
+		if !ok {
+			continue
+		}
+
+		hashes, err := ParsePieceLayer(layer)
+		if err != nil {
+			return nil, err
+		}
+
+		if int64(len(hashes)) != (f.Length+pieceLength-1)/pieceLength {
+			return nil, fmt.Errorf("file %q has %d hashes in piece layer", f.Path, len(hashes))
+		}
+
+		if PieceLayerRoot(hashes, pieceLength) != f.PiecesRoot {
+			return nil, errors.Join(ErrInvalidPieceLayers, fmt.Errorf("file %q", f.Path))
+		}
+
+		copy(r[first:], hashes)
+	}
+
+	return r, nil
+}
+
+func ParsePieceLayer(layer string) ([]HashV2, error) {
+	if len(layer)%sha256.Size != 0 {
+		return nil, fmt.Errorf("invalid piece layer length %d", len(layer))
+	}
+
+	var hashes = make([]HashV2, len(layer)/sha256.Size)
+	for i := range hashes {
+		copy(hashes[i][:], layer[i*sha256.Size:])
+	}
+
+	return hashes, nil
+}
+
+// FilePieces return first piece and piece count of file, v2 file always start at piece boundary.
+func (i Info) FilePieces(index int) (first uint32, count uint32) {
+	var offset int64
+	for _, f := range i.Files[:index] {
+		offset += f.Length
+	}
+
+	if i.Files[index].Length == 0 {
+		return uint32(offset / i.PieceLength), 0
+	}
+
+	end := offset + i.Files[index].Length
+
+	return uint32(offset / i.PieceLength), uint32((end-1)/i.PieceLength - offset/i.PieceLength + 1)
+}
+
+// FileByPiecesRoot return index of file with pieces root, -1 if not found.
+func (i Info) FileByPiecesRoot(root HashV2) int {
+	return slices.IndexFunc(i.Files, func(f File) bool {
+		return !f.Pad && f.PiecesRoot == root
+	})
+}
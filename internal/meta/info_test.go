@@ -0,0 +1,203 @@
+package meta_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/merkle"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/meta"
+)
+
+const testPieceLength = 32 * 1024
+
+type testFile struct {
+	name string
+	data []byte
+}
+
+func randomFile(name string, size int) testFile {
+	b := make([]byte, size)
+	_, _ = rand.Read(b)
+
+	return testFile{name: name, data: b}
+}
+
+func piecesRoot(data []byte) meta.HashV2 {
+	h := merkle.NewHash()
+	_, _ = h.Write(data)
+
+	return meta.HashV2(h.Sum(nil))
+}
+
+func pieceLayer(data []byte) []byte {
+	var layer []byte
+	for start := 0; start < len(data); start += testPieceLength {
+		h := merkle.NewHash()
+		_, _ = h.Write(data[start:min(start+testPieceLength, len(data))])
+		layer = h.SumMinLength(layer, testPieceLength)
+	}
+
+	return layer
+}
+
+// buildTorrent create a v2 torrent, or hybrid torrent with pad files in v1 file list.
+func buildTorrent(t *testing.T, hybrid bool, files ...testFile) metainfo.MetaInfo {
+	t.Helper()
+
+	tree := map[string]any{}
+	layers := map[string]string{}
+
+	var v1Files []map[string]any
+	var v1Data []byte
+
+	for i, f := range files {
+		root := piecesRoot(f.data)
+		tree[f.name] = map[string]any{"": map[string]any{"length": len(f.data), "pieces root": root[:]}}
+		if len(f.data) > testPieceLength {
+			layers[string(root[:])] = string(pieceLayer(f.data))
+		}
+
+		v1Files = append(v1Files, map[string]any{"length": len(f.data), "path": []string{f.name}})
+		v1Data = append(v1Data, f.data...)
+
+		if pad := (testPieceLength - len(f.data)%testPieceLength) % testPieceLength; pad != 0 && i != len(files)-1 {
+			v1Files = append(v1Files, map[string]any{"length": pad, "path": []string{".pad", "x"}, "attr": "p"})
+			v1Data = append(v1Data, make([]byte, pad)...)
+		}
+	}
+
+	info := map[string]any{
+		"name":         "test",
+		"piece length": testPieceLength,
+		"meta version": 2,
+		"file tree":    tree,
+	}
+
+	if hybrid {
+		var pieces []byte
+		for start := 0; start < len(v1Data); start += testPieceLength {
+			h := sha1.Sum(v1Data[start:min(start+testPieceLength, len(v1Data))])
+			pieces = append(pieces, h[:]...)
+		}
+
+		info["files"] = v1Files
+		info["pieces"] = pieces
+	}
+
+	b, err := bencode.Marshal(info)
+	require.NoError(t, err)
+
+	return metainfo.MetaInfo{InfoBytes: b, PieceLayers: layers}
+}
+
+func TestParseV2(t *testing.T) {
+	a := randomFile("a", 40*1024)
+	b := randomFile("b", 10*1024)
+
+	m := buildTorrent(t, false, a, b)
+
+	info, err := meta.FromTorrent(m)
+	require.NoError(t, err)
+
+	require.False(t, info.HasV1())
+	require.True(t, info.HasV2())
+	require.Equal(t, meta.HashV2(sha256.Sum256(m.InfoBytes)), info.HashV2)
+	require.Equal(t, info.HashV2.Truncate(), info.Hash)
+	require.Len(t, info.InfoHashes(), 1)
+
+	require.Equal(t, []meta.File{
+		{Path: "a", Length: 40 * 1024, PiecesRoot: piecesRoot(a.data)},
+		{Path: ".pad/24576", Length: 24 * 1024, Pad: true},
+		{Path: "b", Length: 10 * 1024, PiecesRoot: piecesRoot(b.data)},
+	}, info.Files)
+
+	require.EqualValues(t, 3, info.NumPieces)
+	require.EqualValues(t, 10*1024, info.LastPieceSize)
+
+	layer, err := meta.ParsePieceLayer(string(pieceLayer(a.data)))
+	require.NoError(t, err)
+	require.Equal(t, []meta.HashV2{layer[0], layer[1], piecesRoot(b.data)}, info.PiecesV2)
+
+	first, count := info.FilePieces(2)
+	require.EqualValues(t, 2, first)
+	require.EqualValues(t, 1, count)
+	require.Equal(t, 2, info.FileByPiecesRoot(piecesRoot(b.data)))
+}
+
+func TestParseV2MissingPieceLayers(t *testing.T) {
+	a := randomFile("a", 40*1024)
+
+	m := buildTorrent(t, false, a)
+	m.PieceLayers = nil
+
+	info, err := meta.FromTorrent(m)
+	require.NoError(t, err)
+	require.Equal(t, []meta.HashV2{{}, {}}, info.PiecesV2)
+
+	m.PieceLayers = map[string]string{string(info.Files[0].PiecesRoot[:]): string(bytes.Repeat([]byte{1}, 64))}
+	_, err = meta.FromTorrent(m)
+	require.ErrorIs(t, err, meta.ErrInvalidPieceLayers)
+}
+
+func TestParseHybrid(t *testing.T) {
+	a := randomFile("a", 40*1024)
+	b := randomFile("b", 10*1024)
+
+	m := buildTorrent(t, true, a, b)
+
+	info, err := meta.FromTorrent(m)
+	require.NoError(t, err)
+
+	require.True(t, info.HasV1())
+	require.True(t, info.HasV2())
+	require.Equal(t, meta.Hash(sha1.Sum(m.InfoBytes)), info.Hash)
+	require.Equal(t, []meta.Hash{info.Hash, info.HashV2.Truncate()}, info.InfoHashes())
+
+	require.Len(t, info.Files, 3)
+	require.True(t, info.Files[1].Pad)
+	require.Equal(t, piecesRoot(a.data), info.Files[0].PiecesRoot)
+	require.Equal(t, piecesRoot(b.data), info.Files[2].PiecesRoot)
+	require.EqualValues(t, 3, info.NumPieces)
+	require.Len(t, info.Pieces, 3)
+	require.Equal(t, piecesRoot(b.data), info.PiecesV2[2])
+}
+
+func TestMerkleProof(t *testing.T) {
+	leaves := make([]meta.HashV2, 5)
+	for i := range leaves {
+		leaves[i] = sha256.Sum256([]byte{byte(i)})
+	}
+
+	pad := meta.PiecePadHash(testPieceLength)
+	tree := meta.NewMerkleTree(leaves, pad)
+	require.Len(t, tree[0], 8)
+	require.Equal(t, meta.PieceLayerRoot(leaves, testPieceLength), tree.Root())
+	require.Equal(t, 1, meta.PieceLayerBase(testPieceLength))
+
+	proof := tree.Proof(4, 2, 10)
+	require.Len(t, proof, 2)
+	require.True(t, meta.VerifyProof(tree.Root(), tree[0][4:6], 4, proof))
+	require.False(t, meta.VerifyProof(tree.Root(), tree[0][4:6], 0, proof))
+	require.False(t, meta.VerifyProof(tree.Root(), leaves[0:2], 4, proof))
+
+	require.True(t, meta.VerifyProof(tree.Root(), tree[0], 0, nil))
+	require.Empty(t, tree.Proof(0, 8, 10))
+}
+
+func TestHTTPSeeds(t *testing.T) {
+	b, err := bencode.Marshal(map[string]any{
+		"httpseeds": []string{"http://example.com/seed.php"},
+		"url-list":  []string{"http://example.com/files/"},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"http://example.com/seed.php"}, meta.HTTPSeeds(b))
+	require.Nil(t, meta.HTTPSeeds([]byte("not bencode")))
+}
@@ -0,0 +1,113 @@
+package meta
+
+import (
+	"crypto/sha256"
+	"math/bits"
+)
+
+// BlockSize is size of leaf blocks in merkle tree of v2 torrent.
+const BlockSize = 16 * 1024
+
+// MerkleTree is a complete binary tree of SHA-256 hashes,
+// first layer is leaves padded to power of two and last layer is the root.
+type MerkleTree [][]HashV2
+
+func hashPair(left, right HashV2) HashV2 {
+	var b [64]byte
+	copy(b[:], left[:])
+	copy(b[32:], right[:])
+
+	return sha256.Sum256(b[:])
+}
+
+// NewMerkleTree build tree from leaves, missing leaves are filled with pad.
+func NewMerkleTree(leaves []HashV2, pad HashV2) MerkleTree {
+	size := 1
+	if len(leaves) > 1 {
+		size = 1 << bits.Len(uint(len(leaves)-1))
+	}
+
+	layer := make([]HashV2, size)
+	copy(layer, leaves)
+	for i := len(leaves); i < size; i++ {
+		layer[i] = pad
+	}
+
+	tree := MerkleTree{layer}
+	for len(layer) > 1 {
+		next := make([]HashV2, len(layer)/2)
+		for i := range next {
+			next[i] = hashPair(layer[i*2], layer[i*2+1])
+		}
+
+		tree = append(tree, next)
+		layer = next
+	}
+
+	return tree
+}
+
+func (t MerkleTree) Root() HashV2 {
+	return t[len(t)-1][0]
+}
+
+// Proof return uncle hashes of subtree of leaves [index, index+length), from bottom to top.
+// length must be power of two and index must be multiple of length, at most layers hashes are returned.
+func (t MerkleTree) Proof(index, length int, layers int) []HashV2 {
+	var proof []HashV2
+
+	layer := bits.Len(uint(length)) - 1
+	pos := index / length
+
+	for ; layer < len(t)-1 && len(proof) < layers; layer++ {
+		proof = append(proof, t[layer][pos^1])
+		pos /= 2
+	}
+
+	return proof
+}
+
+// VerifyProof check if hashes at index with uncle hashes proof lead to root.
+// len(hashes) must be power of two and index must be multiple of it.
+func VerifyProof(root HashV2, hashes []HashV2, index int, proof []HashV2) bool {
+	if len(hashes) == 0 || len(hashes)&(len(hashes)-1) != 0 || index%len(hashes) != 0 {
+		return false
+	}
+
+	sub := NewMerkleTree(hashes, HashV2{}).Root()
+
+	pos := index / len(hashes)
+	for _, uncle := range proof {
+		if pos%2 == 0 {
+			sub = hashPair(sub, uncle)
+		} else {
+			sub = hashPair(uncle, sub)
+		}
+		pos /= 2
+	}
+
+	return pos == 0 && sub == root
+}
+
+// PiecePadHash is hash of a piece filled with zero blocks,
+// it's used to pad piece layer to power of two.
+func PiecePadHash(pieceLength int64) HashV2 {
+	var h HashV2
+
+	for n := pieceLength / BlockSize; n > 1; n /= 2 {
+		h = hashPair(h, h)
+	}
+
+	return h
+}
+
+// PieceLayerRoot return pieces root of file from its piece layer.
+func PieceLayerRoot(layer []HashV2, pieceLength int64) HashV2 {
+	return NewMerkleTree(layer, PiecePadHash(pieceLength)).Root()
+}
+
+// PieceLayerBase return which layer of file merkle tree is piece layer, as base layer of hash request.
+// leaves of 16KiB blocks are layer 0.
+func PieceLayerBase(pieceLength int64) int {
+	return bits.Len(uint(pieceLength/BlockSize)) - 1
+}
@@ -0,0 +1,58 @@
+package bandwidth
+
+import (
+	"context"
+	"net"
+)
+
+// large read/write are split so a single connection can't take whole budget at once.
+const chunkSize = 16 * 1024
+
+// Conn limit read and write speed of a net.Conn with shared limiters.
+type Conn struct {
+	net.Conn
+	ctx   context.Context
+	read  []*Limiter
+	write []*Limiter
+}
+
+// NewConn wrap conn, all limiters in read/write are applied. Waiting is aborted when ctx is canceled.
+func NewConn(ctx context.Context, conn net.Conn, read, write []*Limiter) *Conn {
+	return &Conn{Conn: conn, ctx: ctx, read: read, write: write}
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	if len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		if werr := Wait(c.ctx, n, c.read...); werr != nil && err == nil {
+			err = werr
+		}
+	}
+
+	return n, err
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	var written int
+
+	for len(p) != 0 {
+		chunk := p[:min(len(p), chunkSize)]
+		if err := Wait(c.ctx, len(chunk), c.write...); err != nil {
+			return written, err
+		}
+
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[n:]
+	}
+
+	return written, nil
+}
@@ -0,0 +1,99 @@
+package bandwidth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket in bytes per second, shared by many connections.
+//
+// Callers take tokens before they are available and wait for the debt to be paid,
+// so concurrent connections are served in the order they request and share the rate fairly.
+// Burst size is 1 second of rate.
+type Limiter struct {
+	last   time.Time
+	tokens float64
+	rate   int64
+	m      sync.Mutex
+}
+
+// New create a Limiter with rate bytes per second, 0 means unlimited.
+func New(rate int64) *Limiter {
+	return &Limiter{rate: max(rate, 0), last: time.Now()}
+}
+
+// SetRate change rate of limiter, 0 means unlimited.
+func (l *Limiter) SetRate(rate int64) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.advance(time.Now())
+	l.rate = max(rate, 0)
+	if l.rate == 0 {
+		l.tokens = 0
+	}
+}
+
+func (l *Limiter) Rate() int64 {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return l.rate
+}
+
+// reserve take n tokens and return how long caller need to wait before using them.
+func (l *Limiter) reserve(now time.Time, n int) time.Duration {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.rate == 0 {
+		return 0
+	}
+
+	l.advance(now)
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+}
+
+func (l *Limiter) advance(now time.Time) {
+	elapsed := now.Sub(l.last)
+	l.last = now
+
+	if elapsed <= 0 || l.rate == 0 {
+		return
+	}
+
+	l.tokens = min(l.tokens+elapsed.Seconds()*float64(l.rate), float64(l.rate))
+}
+
+// Wait take n tokens from all limiters and block until all of them are available.
+// nil limiters are ignored.
+func Wait(ctx context.Context, n int, limiters ...*Limiter) error {
+	now := time.Now()
+
+	var delay time.Duration
+	for _, l := range limiters {
+		if l != nil {
+			delay = max(delay, l.reserve(now, n))
+		}
+	}
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
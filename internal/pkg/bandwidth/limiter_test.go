@@ -0,0 +1,81 @@
+package bandwidth_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/pkg/bandwidth"
+)
+
+func TestWaitUnlimited(t *testing.T) {
+	l := bandwidth.New(0)
+
+	start := time.Now()
+	require.NoError(t, bandwidth.Wait(context.Background(), 1<<30, l, nil))
+	require.Less(t, time.Since(start), time.Millisecond*50)
+}
+
+func TestWaitRate(t *testing.T) {
+	l := bandwidth.New(1000)
+
+	// initial bucket is empty
+	start := time.Now()
+	require.NoError(t, bandwidth.Wait(context.Background(), 200, l))
+	require.NoError(t, bandwidth.Wait(context.Background(), 200, l))
+	require.InDelta(t, 400, time.Since(start).Milliseconds(), 100)
+}
+
+func TestWaitSlowestLimiter(t *testing.T) {
+	fast := bandwidth.New(100000)
+	slow := bandwidth.New(1000)
+
+	start := time.Now()
+	require.NoError(t, bandwidth.Wait(context.Background(), 300, fast, slow))
+	require.InDelta(t, 300, time.Since(start).Milliseconds(), 100)
+}
+
+func TestWaitCanceled(t *testing.T) {
+	l := bandwidth.New(10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	require.ErrorIs(t, bandwidth.Wait(ctx, 1000, l), context.DeadlineExceeded)
+}
+
+func TestSetRate(t *testing.T) {
+	l := bandwidth.New(10)
+	require.EqualValues(t, 10, l.Rate())
+
+	l.SetRate(0)
+	require.EqualValues(t, 0, l.Rate())
+
+	start := time.Now()
+	require.NoError(t, bandwidth.Wait(context.Background(), 1000, l))
+	require.Less(t, time.Since(start), time.Millisecond*50)
+}
+
+func TestConn(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	l := bandwidth.New(50 * 1024)
+	conn := bandwidth.NewConn(context.Background(), a, nil, []*bandwidth.Limiter{l})
+
+	go func() {
+		_, _ = conn.Write(make([]byte, 40*1024))
+		_ = conn.Close()
+	}()
+
+	start := time.Now()
+	data, err := io.ReadAll(b)
+	require.NoError(t, err)
+	require.Len(t, data, 40*1024)
+	require.InDelta(t, 800, time.Since(start).Milliseconds(), 150)
+}
@@ -1,7 +1,7 @@
 package bm
 
 import (
-	"encoding/binary"
+	"math"
 	"sync"
 
 	"github.com/RoaringBitmap/roaring/v2"
@@ -15,8 +15,9 @@ func New(size uint32) *Bitmap {
 	}
 }
 
+// FromBitmap wrap bm, bits not less than size are removed.
 func FromBitmap(bm *roaring.Bitmap, size uint32) *Bitmap {
-	bm.RemoveRange(uint64(size), uint64(size+64*8))
+	bm.RemoveRange(uint64(size), math.MaxUint32+1)
 
 	return &Bitmap{
 		size: size,
@@ -24,6 +25,32 @@ func FromBitmap(bm *roaring.Bitmap, size uint32) *Bitmap {
 	}
 }
 
+// FromBitfield parse bitfield of bittorrent protocol, spare bits not less than size are ignored.
+func FromBitfield(data []byte, size uint32) *Bitmap {
+	b := New(size)
+
+	for i, v := range data {
+		for j := uint32(0); v != 0; j++ {
+			if v&0x80 != 0 && uint32(i)*8+j < size {
+				b.bm.Add(uint32(i)*8 + j)
+			}
+			v <<= 1
+		}
+	}
+
+	return b
+}
+
+// FromCompressed load bitmap from CompressedBytes output
+func FromCompressed(data []byte, size uint32) (*Bitmap, error) {
+	bm := roaring.New()
+	if err := bm.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	return FromBitmap(bm, size), nil
+}
+
 // Bitmap is thread-safe bitmap wrapper
 type Bitmap struct {
 	bm   *roaring.Bitmap
@@ -50,7 +77,17 @@ func (b *Bitmap) Count() uint32 {
 	return v
 }
 
+// Size is bit count of bitmap, not the count of set bits.
+func (b *Bitmap) Size() uint32 {
+	return b.size
+}
+
+// Set bit i, i out of bitmap size is ignored.
 func (b *Bitmap) Set(i uint32) {
+	if i >= b.size {
+		return
+	}
+
 	b.m.Lock()
 	b.bm.Add(i)
 	b.m.Unlock()
@@ -106,18 +143,15 @@ func (b *Bitmap) Range(fn func(uint32)) {
 	}
 }
 
-// Bitfield return bytes as bittorrent protocol
+// Bitfield return bytes as bittorrent protocol, the high bit of first byte is piece 0.
 func (b *Bitmap) Bitfield() []byte {
-	b.m.RLock()
-	v := b.bm.ToDense()
-	b.m.RUnlock()
+	var buf = make([]byte, (b.size+7)/8)
 
-	var buf = make([]byte, 0, (b.size+7)/8)
-	for _, u := range v {
-		buf = binary.BigEndian.AppendUint64(buf, u)
-	}
+	b.Range(func(i uint32) {
+		buf[i/8] |= 0x80 >> (i % 8)
+	})
 
-	return buf[:(b.size+7)/8]
+	return buf
 }
 
 func (b *Bitmap) XorRaw(bitmap *roaring.Bitmap) {
@@ -1,8 +1,10 @@
 package bm_test
 
 import (
+	"math"
 	"testing"
 
+	"github.com/RoaringBitmap/roaring/v2"
 	"github.com/stretchr/testify/require"
 
 	"tyr/internal/pkg/bm"
@@ -14,3 +16,45 @@ func TestBitmap(t *testing.T) {
 	require.True(t, b.Get(9))
 	require.False(t, b.Get(10))
 }
+
+func TestFromCompressed(t *testing.T) {
+	b := bm.New(100)
+	b.Set(1)
+	b.Set(99)
+
+	c, err := bm.FromCompressed(b.CompressedBytes(), 100)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, c.Count())
+	require.True(t, c.Get(1))
+	require.True(t, c.Get(99))
+	require.False(t, c.Get(2))
+}
+
+func TestOutOfRange(t *testing.T) {
+	b := bm.New(10)
+	b.Set(10)
+	b.Set(math.MaxUint32)
+	require.Zero(t, b.Count())
+
+	r := roaring.New()
+	r.AddMany([]uint32{9, 10, 1000, math.MaxUint32})
+
+	f := bm.FromBitmap(r, 10)
+	require.EqualValues(t, 1, f.Count())
+	require.True(t, f.Get(9))
+}
+
+func TestBitfield(t *testing.T) {
+	b := bm.New(10)
+	b.Set(0)
+	b.Set(9)
+
+	require.Equal(t, []byte{0x80, 0x40}, b.Bitfield())
+
+	// spare bits of last byte are set
+	f := bm.FromBitfield([]byte{0x80, 0x7f}, 10)
+	require.EqualValues(t, 2, f.Count())
+	require.True(t, f.Get(0))
+	require.True(t, f.Get(9))
+	require.Equal(t, []byte{0x80, 0x40}, f.Bitfield())
+}
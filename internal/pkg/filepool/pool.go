@@ -47,6 +47,15 @@ type File struct {
 	flag int         // Flash for opening file.
 }
 
+// Evict close all cached file handles of path.
+func Evict(path string) {
+	for _, key := range pool.Keys() {
+		if f, ok := pool.Peek(key); ok && f.path == path {
+			pool.Remove(key)
+		}
+	}
+}
+
 func (f *File) Close() error {
 	return f.File.Close()
 }
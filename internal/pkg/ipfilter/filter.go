@@ -0,0 +1,104 @@
+// Package ipfilter implement ip range blocklist,
+// rules can be loaded from eMule ipfilter.dat or PeerGuardian p2p plaintext files.
+package ipfilter
+
+import (
+	"cmp"
+	"net/netip"
+	"slices"
+	"sort"
+)
+
+// Range is ip range [Start, End] of a rule, both addresses must be same family.
+type Range struct {
+	Start netip.Addr
+	End   netip.Addr
+}
+
+// Filter check if an address is in any range.
+// Ranges are sorted and merged, so a lookup is a binary search.
+type Filter struct {
+	v4 []Range
+	v6 []Range
+}
+
+// New build filter from ranges, invalid ranges are ignored.
+func New(ranges []Range) *Filter {
+	var f Filter
+
+	for _, r := range ranges {
+		r.Start = r.Start.Unmap()
+		r.End = r.End.Unmap()
+
+		if !r.Start.IsValid() || r.Start.Is4() != r.End.Is4() || r.End.Less(r.Start) {
+			continue
+		}
+
+		if r.Start.Is4() {
+			f.v4 = append(f.v4, r)
+		} else {
+			f.v6 = append(f.v6, r)
+		}
+	}
+
+	f.v4 = merge(f.v4)
+	f.v6 = merge(f.v6)
+
+	return &f
+}
+
+// merge sort ranges and merge overlapping or adjacent ranges.
+func merge(ranges []Range) []Range {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	slices.SortFunc(ranges, func(a, b Range) int { return cmp.Or(a.Start.Compare(b.Start), a.End.Compare(b.End)) })
+
+	var r = ranges[:1]
+	for _, item := range ranges[1:] {
+		last := &r[len(r)-1]
+		if next := last.End.Next(); item.Start.Compare(last.End) <= 0 || (next.IsValid() && item.Start == next) {
+			if last.End.Less(item.End) {
+				last.End = item.End
+			}
+
+			continue
+		}
+
+		r = append(r, item)
+	}
+
+	return slices.Clip(r)
+}
+
+// Contains check if addr is blocked, nil filter block nothing.
+func (f *Filter) Contains(addr netip.Addr) bool {
+	if f == nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	ranges := f.v6
+	if addr.Is4() {
+		ranges = f.v4
+	}
+
+	// first range with start > addr
+	i := sort.Search(len(ranges), func(i int) bool { return addr.Less(ranges[i].Start) })
+	if i == 0 {
+		return false
+	}
+
+	return addr.Compare(ranges[i-1].End) <= 0
+}
+
+// Len return count of ranges after merging.
+func (f *Filter) Len() int {
+	if f == nil {
+		return 0
+	}
+
+	return len(f.v4) + len(f.v6)
+}
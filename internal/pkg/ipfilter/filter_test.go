@@ -0,0 +1,70 @@
+package ipfilter_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/pkg/ipfilter"
+)
+
+const testRules = `# comment
+// another comment
+001.009.096.105 - 001.009.096.110 , 000 , eMule blocked
+002.000.000.000 - 002.255.255.255 , 200 , eMule allowed
+Some:Organization:3.0.0.0-3.0.0.255
+Foo-Bar, Inc:1.2.3.0-1.2.3.255
+v6 range:2001:db8::-2001:db8::ffff
+not a rule
+`
+
+func TestParse(t *testing.T) {
+	ranges, err := ipfilter.Parse(strings.NewReader(testRules))
+	require.NoError(t, err)
+	require.Equal(t, []ipfilter.Range{
+		{Start: netip.MustParseAddr("1.9.96.105"), End: netip.MustParseAddr("1.9.96.110")},
+		{Start: netip.MustParseAddr("3.0.0.0"), End: netip.MustParseAddr("3.0.0.255")},
+		{Start: netip.MustParseAddr("1.2.3.0"), End: netip.MustParseAddr("1.2.3.255")},
+		{Start: netip.MustParseAddr("2001:db8::"), End: netip.MustParseAddr("2001:db8::ffff")},
+	}, ranges)
+}
+
+func TestParseGzip(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(testRules))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	ranges, err := ipfilter.Parse(&buf)
+	require.NoError(t, err)
+	require.Len(t, ranges, 4)
+}
+
+func TestContains(t *testing.T) {
+	f := ipfilter.New([]ipfilter.Range{
+		{Start: netip.MustParseAddr("10.0.0.0"), End: netip.MustParseAddr("10.0.0.10")},
+		{Start: netip.MustParseAddr("10.0.0.5"), End: netip.MustParseAddr("10.0.0.20")},
+		{Start: netip.MustParseAddr("10.0.0.21"), End: netip.MustParseAddr("10.0.0.30")},
+		{Start: netip.MustParseAddr("192.168.0.0"), End: netip.MustParseAddr("192.168.0.255")},
+		{Start: netip.MustParseAddr("2001:db8::"), End: netip.MustParseAddr("2001:db8::ffff")},
+		{Start: netip.MustParseAddr("10.0.0.1"), End: netip.MustParseAddr("2001:db8::")},
+	})
+
+	require.Equal(t, 3, f.Len(), "overlapping and adjacent ranges should be merged")
+
+	for _, s := range []string{"10.0.0.0", "10.0.0.15", "10.0.0.30", "192.168.0.1", "::ffff:192.168.0.1", "2001:db8::1"} {
+		require.True(t, f.Contains(netip.MustParseAddr(s)), s)
+	}
+
+	for _, s := range []string{"9.255.255.255", "10.0.0.31", "192.168.1.0", "2001:db8::1:0", "::1"} {
+		require.False(t, f.Contains(netip.MustParseAddr(s)), s)
+	}
+
+	var empty *ipfilter.Filter
+	require.False(t, empty.Contains(netip.MustParseAddr("10.0.0.1")))
+}
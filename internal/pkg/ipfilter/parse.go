@@ -0,0 +1,144 @@
+package ipfilter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/trim21/errgo"
+)
+
+// eMule ipfilter.dat ranges with access level below this are blocked.
+const emuleAccessLevel = 128
+
+// LoadFile parse a rule file, file may be gzip compressed.
+func LoadFile(path string) ([]Range, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranges, err := Parse(f)
+	if err != nil {
+		return nil, errgo.Wrap(err, fmt.Sprintf("failed to parse %s", path))
+	}
+
+	return ranges, nil
+}
+
+// Parse read rules from r, eMule dat and PeerGuardian p2p lines are detected by line.
+// Gzip compressed content is decompressed automatically. Empty, comment and invalid lines are skipped.
+//
+//	eMule:  001.009.096.105 - 001.009.096.105 , 000 , description
+//	P2P:    description:1.9.96.105-1.9.96.105
+func Parse(r io.Reader) ([]Range, error) {
+	br := bufio.NewReader(r)
+
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errgo.Wrap(err, "failed to read gzip content")
+		}
+		defer gr.Close()
+
+		br = bufio.NewReader(gr)
+	}
+
+	var ranges []Range
+
+	s := bufio.NewScanner(br)
+	s.Buffer(make([]byte, 0, 4096), 1024*1024)
+
+	for s.Scan() {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 || line[0] == '#' || bytes.HasPrefix(line, []byte("//")) {
+			continue
+		}
+
+		r, ok := parseLine(string(line))
+		if ok {
+			ranges = append(ranges, r)
+		}
+	}
+
+	return ranges, s.Err()
+}
+
+func parseLine(line string) (Range, bool) {
+	// eMule format always has a comma after range, p2p has a colon before range.
+	// p2p description may contain comma too, fallback to p2p if it's not a valid eMule range.
+	if before, after, found := strings.Cut(line, ","); found {
+		if r, ok := parseRange(before); ok {
+			level, _, _ := strings.Cut(after, ",")
+			if n, err := strconv.Atoi(strings.TrimSpace(level)); err != nil || n >= emuleAccessLevel {
+				return Range{}, false
+			}
+
+			return r, true
+		}
+	}
+
+	// description may contain colons, and ipv6 range contains colons too,
+	// so try every colon from left until the rest is a valid range.
+	for i := 0; i < len(line); i++ {
+		if line[i] != ':' {
+			continue
+		}
+
+		if r, ok := parseRange(line[i+1:]); ok {
+			return r, true
+		}
+	}
+
+	return Range{}, false
+}
+
+func parseRange(s string) (Range, bool) {
+	start, end, found := strings.Cut(s, "-")
+	if !found {
+		return Range{}, false
+	}
+
+	a, err := parseAddr(strings.TrimSpace(start))
+	if err != nil {
+		return Range{}, false
+	}
+
+	b, err := parseAddr(strings.TrimSpace(end))
+	if err != nil {
+		return Range{}, false
+	}
+
+	return Range{Start: a, End: b}, true
+}
+
+// parseAddr parse address, ipv4 address in eMule file have leading zeros like 001.009.096.105.
+func parseAddr(s string) (netip.Addr, error) {
+	if strings.Contains(s, ":") {
+		return netip.ParseAddr(s)
+	}
+
+	var b [4]byte
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return netip.Addr{}, fmt.Errorf("invalid ipv4 address %q", s)
+	}
+
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 8)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("invalid ipv4 address %q", s)
+		}
+
+		b[i] = byte(n)
+	}
+
+	return netip.AddrFrom4(b), nil
+}
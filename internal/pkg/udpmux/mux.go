@@ -0,0 +1,175 @@
+// Package udpmux share one UDP socket between protocols, like DHT and uTP on p2p port.
+package udpmux
+
+import (
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// packets are dropped when reader is too slow.
+const queueSize = 1024
+
+type packet struct {
+	addr net.Addr
+	data []byte
+}
+
+// Mux dispatch incoming packets to virtual conns by their match function.
+type Mux struct {
+	pc     net.PacketConn
+	closed chan struct{}
+	routes []*Conn
+	once   sync.Once
+}
+
+func New(pc net.PacketConn) *Mux {
+	return &Mux{pc: pc, closed: make(chan struct{})}
+}
+
+// Route create a virtual conn receiving packets matched by match,
+// routes are matched in the order they are created, unmatched packets are dropped.
+// all routes must be created before Start.
+func (m *Mux) Route(match func(b []byte) bool) *Conn {
+	c := &Conn{
+		mux:    m,
+		match:  match,
+		queue:  make(chan packet, queueSize),
+		closed: make(chan struct{}),
+	}
+
+	m.routes = append(m.routes, c)
+
+	return c
+}
+
+// Start reading packets from underlying conn.
+func (m *Mux) Start() {
+	go m.readLoop()
+}
+
+func (m *Mux) Addr() net.Addr {
+	return m.pc.LocalAddr()
+}
+
+// Close underlying conn and all virtual conns.
+func (m *Mux) Close() error {
+	var err error
+
+	m.once.Do(func() {
+		close(m.closed)
+		err = m.pc.Close()
+	})
+
+	return err
+}
+
+func (m *Mux) readLoop() {
+	defer m.Close()
+
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, addr, err := m.pc.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+
+			return
+		}
+
+		// empty datagram is valid UDP packet, but no protocol use it
+		if n == 0 {
+			continue
+		}
+
+		b := buf[:n]
+		for _, c := range m.routes {
+			if !c.match(b) {
+				continue
+			}
+
+			select {
+			case c.queue <- packet{addr: addr, data: slices.Clone(b)}:
+			default:
+			}
+
+			break
+		}
+	}
+}
+
+// Conn is a virtual net.PacketConn, writes go to underlying conn directly.
+type Conn struct {
+	mux          *Mux
+	match        func(b []byte) bool
+	queue        chan packet
+	closed       chan struct{}
+	readDeadline atomic.Time
+	once         sync.Once
+}
+
+var _ net.PacketConn = (*Conn)(nil)
+
+func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	var timeout <-chan time.Time
+	if deadline := c.readDeadline.Load(); !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case p := <-c.queue:
+		return copy(b, p.data), p.addr, nil
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	case <-c.mux.closed:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *Conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	return c.mux.pc.WriteTo(b, addr)
+}
+
+// Close only stop this virtual conn, underlying conn is closed by Mux.Close.
+func (c *Conn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+
+	return nil
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.mux.pc.LocalAddr()
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Store(t)
+
+	return nil
+}
+
+// SetWriteDeadline is ignored, writing to UDP socket doesn't block.
+func (c *Conn) SetWriteDeadline(time.Time) error {
+	return nil
+}
@@ -0,0 +1,99 @@
+package udpmux_test
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/pkg/udpmux"
+)
+
+func TestMux(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	m := udpmux.New(pc)
+	defer m.Close()
+
+	a := m.Route(func(b []byte) bool { return b[0] == 'a' })
+	b := m.Route(func(b []byte) bool { return true })
+	m.Start()
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer client.Close()
+
+	for _, msg := range []string{"b1", "a1", "a2", "b2"} {
+		_, err = client.WriteTo([]byte(msg), m.Addr())
+		require.NoError(t, err)
+	}
+
+	read := func(c net.PacketConn) string {
+		t.Helper()
+
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+
+		buf := make([]byte, 10)
+		n, addr, err := c.ReadFrom(buf)
+		require.NoError(t, err)
+		require.Equal(t, client.LocalAddr().String(), addr.String())
+
+		return string(buf[:n])
+	}
+
+	require.Equal(t, "a1", read(a))
+	require.Equal(t, "a2", read(a))
+	require.Equal(t, "b1", read(b))
+	require.Equal(t, "b2", read(b))
+
+	// reply from virtual conn use shared socket
+	_, err = a.WriteTo([]byte("reply"), client.LocalAddr())
+	require.NoError(t, err)
+
+	buf := make([]byte, 10)
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+	n, addr, err := client.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, "reply", string(buf[:n]))
+	require.Equal(t, m.Addr().String(), addr.String())
+
+	require.NoError(t, a.SetReadDeadline(time.Now().Add(time.Millisecond*10)))
+	_, _, err = a.ReadFrom(buf)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	require.NoError(t, m.Close())
+	require.NoError(t, b.SetReadDeadline(time.Time{}))
+	_, _, err = b.ReadFrom(buf)
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestMuxEmptyPacket(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	m := udpmux.New(pc)
+	defer m.Close()
+
+	// match function doesn't check length, it panics if empty packet is not dropped
+	a := m.Route(func(b []byte) bool { return b[0] == 'a' })
+	m.Start()
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer client.Close()
+
+	for _, msg := range []string{"", "a1"} {
+		_, err = client.WriteTo([]byte(msg), m.Addr())
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, a.SetReadDeadline(time.Now().Add(time.Second)))
+
+	buf := make([]byte, 10)
+	n, _, err := a.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, "a1", string(buf[:n]))
+}
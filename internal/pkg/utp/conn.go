@@ -0,0 +1,579 @@
+package utp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// payload size of data packet, small enough to not be fragmented on most paths.
+	maxPayload = 1200
+
+	// max bytes buffered but not read, advertised as receive window.
+	readBufferSize = 1 << 20
+
+	minCwnd  = 2 * maxPayload
+	initCwnd = 16 * maxPayload
+	maxCwnd  = 8 << 20
+
+	// LEDBAT target of queuing delay, congestion window shrink when delay is above it.
+	targetDelay = 100_000 // microseconds
+	// base delay is reset periodically, so clock drift won't be counted as queuing delay.
+	baseDelayWindow = time.Minute * 2
+
+	initRTO = time.Second
+	minRTO  = time.Millisecond * 500
+	maxRTO  = time.Second * 60
+
+	maxSynTransmissions = 3
+	maxTransmissions    = 8
+
+	keepAliveInterval = time.Second * 29
+	idleTimeout       = time.Minute * 2
+
+	// out of order packets too far from ack are dropped.
+	reorderLimit = 2048
+)
+
+var (
+	ErrTimeout = errors.New("utp: connection timed out")
+	ErrReset   = errors.New("utp: connection reset by peer")
+)
+
+type connState uint8
+
+const (
+	stateSynSent connState = iota
+	stateConnected
+	stateFinSent
+	stateClosed
+)
+
+type outPacket struct {
+	sentAt        time.Time
+	payload       []byte
+	transmissions int
+	seq           uint16
+	typ           packetType
+}
+
+// Conn is an uTP connection, it implements net.Conn.
+type Conn struct {
+	lastRecv      time.Time
+	lastSend      time.Time
+	baseDelayAt   time.Time
+	s             *Socket
+	readDeadline  *deadline
+	writeDeadline *deadline
+	err           error
+	reorder       map[uint16][]byte
+	readable      chan struct{}
+	writable      chan struct{}
+	connected     chan struct{}
+	done          chan struct{}
+	inflight      []*outPacket
+	readBuf       bytes.Buffer
+	raddr         netip.AddrPort
+	rtt           time.Duration
+	rttVar        time.Duration
+	rto           time.Duration
+	cwnd          int
+	inflightBytes int
+	peerWnd       int
+	dupAcks       int
+	replyMicro    uint32
+	baseDelay     uint32
+	m             sync.Mutex
+	recvID        uint16
+	sendID        uint16
+	seq           uint16
+	ack           uint16
+	lastAck       uint16
+	finSeq        uint16
+	recoverSeq    uint16
+	state         connState
+	gotFin        bool
+	inRecovery    bool
+	slowStart     bool
+	eof           bool
+	closed        bool
+}
+
+var _ net.Conn = (*Conn)(nil)
+
+func newConn(s *Socket, raddr netip.AddrPort, recvID, sendID uint16) *Conn {
+	now := time.Now()
+
+	return &Conn{
+		s:             s,
+		raddr:         raddr,
+		recvID:        recvID,
+		sendID:        sendID,
+		lastRecv:      now,
+		lastSend:      now,
+		rto:           initRTO,
+		cwnd:          initCwnd,
+		slowStart:     true,
+		peerWnd:       readBufferSize,
+		reorder:       make(map[uint16][]byte),
+		readable:      make(chan struct{}, 1),
+		writable:      make(chan struct{}, 1),
+		connected:     make(chan struct{}),
+		done:          make(chan struct{}),
+		readDeadline:  newDeadline(),
+		writeDeadline: newDeadline(),
+	}
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	for {
+		c.m.Lock()
+		if c.readBuf.Len() > 0 {
+			n, _ := c.readBuf.Read(b)
+			c.m.Unlock()
+			return n, nil
+		}
+
+		switch {
+		case c.eof:
+			c.m.Unlock()
+			return 0, io.EOF
+		case c.err != nil:
+			err := c.err
+			c.m.Unlock()
+			return 0, err
+		case c.closed:
+			c.m.Unlock()
+			return 0, net.ErrClosed
+		}
+		c.m.Unlock()
+
+		select {
+		case <-c.readable:
+		case <-c.done:
+		case <-c.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// Write split b into packets, block until they fit in congestion window.
+func (c *Conn) Write(b []byte) (int, error) {
+	var written int
+
+	for len(b) > 0 {
+		c.m.Lock()
+		if c.err != nil {
+			err := c.err
+			c.m.Unlock()
+			return written, err
+		}
+
+		if c.closed {
+			c.m.Unlock()
+			return written, net.ErrClosed
+		}
+
+		n := min(len(b), maxPayload)
+
+		// always allow one packet in flight, as probe of zero window
+		if c.inflightBytes == 0 || c.inflightBytes+n <= min(c.cwnd, c.peerWnd) {
+			c.queue(stData, slices.Clone(b[:n]))
+			c.m.Unlock()
+
+			b = b[n:]
+			written += n
+
+			continue
+		}
+		c.m.Unlock()
+
+		select {
+		case <-c.writable:
+		case <-c.done:
+		case <-c.writeDeadline.wait():
+			return written, os.ErrDeadlineExceeded
+		}
+	}
+
+	return written, nil
+}
+
+// Close send FIN after pending data, connection is kept until FIN is acked or timeout.
+func (c *Conn) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.closed {
+		return nil
+	}
+
+	c.closed = true
+	c.closeDone()
+
+	switch c.state {
+	case stateConnected:
+		c.queue(stFin, nil)
+		c.state = stateFinSent
+	case stateSynSent:
+		c.state = stateClosed
+		c.s.remove(c)
+	case stateFinSent, stateClosed:
+	}
+
+	return nil
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.s.Addr()
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return net.UDPAddrFromAddrPort(c.raddr)
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+
+	return nil
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+
+	return nil
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+
+	return nil
+}
+
+// closeDone wake up all blocked Read and Write, must be called with c.m locked.
+func (c *Conn) closeDone() {
+	if !isClosed(c.done) {
+		close(c.done)
+	}
+}
+
+// fail close connection without FIN, must be called with c.m locked.
+func (c *Conn) fail(err error) {
+	if c.state == stateClosed {
+		return
+	}
+
+	c.err = err
+	c.state = stateClosed
+	c.inflight = nil
+	c.inflightBytes = 0
+	c.closeDone()
+	c.s.remove(c)
+}
+
+// queue send a packet consuming a sequence number, it's retransmitted until acked.
+// must be called with c.m locked.
+func (c *Conn) queue(typ packetType, payload []byte) {
+	p := &outPacket{typ: typ, seq: c.seq, payload: payload}
+	c.seq++
+
+	c.inflight = append(c.inflight, p)
+	c.inflightBytes += len(payload)
+
+	c.transmit(p)
+}
+
+func (c *Conn) transmit(p *outPacket) {
+	p.sentAt = time.Now()
+	p.transmissions++
+
+	c.send(p.typ, p.seq, p.payload)
+}
+
+// sendState send an ack, it doesn't consume sequence number.
+func (c *Conn) sendState() {
+	c.send(stState, c.seq, nil)
+}
+
+func (c *Conn) send(typ packetType, seq uint16, payload []byte) {
+	connID := c.sendID
+	if typ == stSyn {
+		connID = c.recvID
+	}
+
+	h := header{
+		typ:    typ,
+		connID: connID,
+		ts:     nowMicro(),
+		tsDiff: c.replyMicro,
+		wnd:    uint32(max(readBufferSize-c.readBuf.Len(), 0)),
+		seq:    seq,
+		ack:    c.ack,
+	}
+
+	c.lastSend = time.Now()
+	c.s.send(c.raddr, h.marshal(payload))
+}
+
+// handle process a packet from peer.
+func (c *Conn) handle(h header, payload []byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.state == stateClosed {
+		return
+	}
+
+	now := time.Now()
+	c.lastRecv = now
+	if h.ts != 0 {
+		c.replyMicro = nowMicro() - h.ts
+	}
+	c.peerWnd = int(h.wnd)
+
+	switch h.typ {
+	case stReset:
+		c.fail(ErrReset)
+		return
+	case stSyn:
+		// our ack is lost, peer send SYN again
+		if c.state != stateSynSent {
+			c.sendState()
+		}
+		return
+	case stData, stFin, stState:
+	}
+
+	if c.state == stateSynSent {
+		if h.typ != stState {
+			return
+		}
+
+		c.state = stateConnected
+		c.ack = h.seq - 1
+		close(c.connected)
+	}
+
+	c.processAck(h, now, len(payload))
+
+	switch h.typ {
+	case stData:
+		c.receive(h.seq, payload, false)
+		c.sendState()
+	case stFin:
+		c.receive(h.seq, nil, true)
+		c.sendState()
+	case stState, stReset, stSyn:
+	}
+
+	if c.state == stateFinSent && len(c.inflight) == 0 {
+		c.state = stateClosed
+		c.s.remove(c)
+	}
+}
+
+func (c *Conn) processAck(h header, now time.Time, payloadSize int) {
+	var acked int
+	var removed int
+
+	for _, p := range c.inflight {
+		if seqLess(h.ack, p.seq) {
+			break
+		}
+
+		removed++
+		acked += len(p.payload)
+	}
+
+	// when a lost packet is recovered, acked packets have been waiting for it,
+	// only ack of a single packet is a valid sample.
+	if removed == 1 && c.inflight[0].transmissions == 1 {
+		c.updateRTT(now.Sub(c.inflight[0].sentAt))
+	}
+
+	if removed != 0 {
+		c.inflight = c.inflight[removed:]
+		c.inflightBytes -= acked
+		c.dupAcks = 0
+		c.lastAck = h.ack
+		c.updateWindow(h.tsDiff, acked, now)
+
+		// reset backoff of timeout
+		if c.rtt != 0 {
+			c.rto = min(max(c.rtt+4*c.rttVar, minRTO), maxRTO)
+		}
+
+		if c.inRecovery {
+			if len(c.inflight) != 0 && seqLess(h.ack, c.recoverSeq) {
+				// partial ack, next packet is lost too
+				c.transmit(c.inflight[0])
+			} else {
+				c.inRecovery = false
+			}
+		}
+
+		notify(c.writable)
+
+		return
+	}
+
+	if h.typ == stState && payloadSize == 0 && h.ack == c.lastAck && len(c.inflight) != 0 {
+		c.dupAcks++
+		// fast retransmit, threshold is lower when window is too small to get 3 duplicated acks
+		if c.dupAcks == min(3, max(len(c.inflight)-2, 1)) && !c.inRecovery {
+			c.slowStart = false
+			c.cwnd = max(c.cwnd/2, minCwnd)
+			c.enterRecovery()
+			c.transmit(c.inflight[0])
+		}
+	}
+}
+
+// enterRecovery start retransmitting lost packets one by one on partial ack,
+// until all packets sent before are acked.
+func (c *Conn) enterRecovery() {
+	c.inRecovery = true
+	c.recoverSeq = c.seq - 1
+}
+
+func (c *Conn) updateRTT(sample time.Duration) {
+	if c.rtt == 0 {
+		c.rtt = sample
+		c.rttVar = sample / 2
+	} else {
+		delta := c.rtt - sample
+		if delta < 0 {
+			delta = -delta
+		}
+
+		c.rttVar += (delta - c.rttVar) / 4
+		c.rtt += (sample - c.rtt) / 8
+	}
+
+	c.rto = min(max(c.rtt+4*c.rttVar, minRTO), maxRTO)
+}
+
+// updateWindow adjust congestion window by LEDBAT,
+// tsDiff is peer measured delay of our packet, including clock difference.
+func (c *Conn) updateWindow(tsDiff uint32, acked int, now time.Time) {
+	if tsDiff == 0 || acked == 0 {
+		return
+	}
+
+	if c.baseDelayAt.IsZero() || now.Sub(c.baseDelayAt) > baseDelayWindow || int32(tsDiff-c.baseDelay) < 0 {
+		c.baseDelay = tsDiff
+		c.baseDelayAt = now
+	}
+
+	queuing := int32(tsDiff - c.baseDelay)
+
+	// grow exponentially before first loss or delay is close to target
+	if c.slowStart && queuing < targetDelay/2 {
+		c.cwnd = min(c.cwnd+acked, maxCwnd)
+		return
+	}
+
+	c.slowStart = false
+	offTarget := float64(targetDelay-queuing) / targetDelay
+
+	c.cwnd += int(offTarget * float64(acked) * maxPayload / float64(c.cwnd))
+	c.cwnd = min(max(c.cwnd, minCwnd), maxCwnd)
+}
+
+// receive put data in read buffer in order, out of order packets are buffered.
+func (c *Conn) receive(seq uint16, payload []byte, fin bool) {
+	if c.eof || !seqLess(c.ack, seq) || seq-c.ack > reorderLimit {
+		return
+	}
+
+	if fin {
+		c.gotFin = true
+		c.finSeq = seq
+	} else if seq != c.ack+1 {
+		c.reorder[seq] = slices.Clone(payload)
+		return
+	}
+
+	for next := c.ack + 1; ; next++ {
+		if c.gotFin && next == c.finSeq {
+			c.ack = next
+			c.eof = true
+			clear(c.reorder)
+			break
+		}
+
+		var data []byte
+		if next == seq {
+			data = payload
+		} else {
+			var ok bool
+			if data, ok = c.reorder[next]; !ok {
+				break
+			}
+
+			delete(c.reorder, next)
+		}
+
+		c.ack = next
+		// data after local close is acked but discarded
+		if !c.closed {
+			c.readBuf.Write(data)
+		}
+	}
+
+	notify(c.readable)
+}
+
+// tick handle retransmission, keep alive and idle timeout.
+func (c *Conn) tick(now time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.state == stateClosed {
+		return
+	}
+
+	if len(c.inflight) != 0 && now.Sub(c.inflight[0].sentAt) > c.rto {
+		p := c.inflight[0]
+
+		limit := maxTransmissions
+		if p.typ == stSyn {
+			limit = maxSynTransmissions
+		}
+
+		if p.transmissions >= limit {
+			c.fail(ErrTimeout)
+			return
+		}
+
+		c.rto = min(c.rto*2, maxRTO)
+		c.cwnd = minCwnd
+		c.slowStart = false
+		c.enterRecovery()
+		c.transmit(p)
+	}
+
+	if c.state != stateSynSent && now.Sub(c.lastRecv) > idleTimeout {
+		c.fail(ErrTimeout)
+		return
+	}
+
+	if c.state == stateConnected && now.Sub(c.lastSend) > keepAliveInterval {
+		c.sendState()
+	}
+}
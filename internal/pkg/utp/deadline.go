@@ -0,0 +1,69 @@
+package utp
+
+import (
+	"sync"
+	"time"
+)
+
+// deadline is a channel closed when deadline is exceeded, same as deadline of net.Pipe.
+type deadline struct {
+	timer  *time.Timer
+	cancel chan struct{}
+	m      sync.Mutex
+}
+
+func newDeadline() *deadline {
+	return &deadline{cancel: make(chan struct{})}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	// wait for timer callback to close channel
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel
+	}
+	d.timer = nil
+
+	closed := isClosed(d.cancel)
+
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+func (d *deadline) wait() <-chan struct{} {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	return d.cancel
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,100 @@
+package utp
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+type packetType uint8
+
+const (
+	stData packetType = iota
+	stFin
+	stState
+	stReset
+	stSyn
+)
+
+const (
+	version    = 1
+	headerSize = 20
+)
+
+var errInvalidPacket = errors.New("invalid utp packet")
+
+// header is uTP packet header of BEP 29, extensions are ignored when reading and never sent.
+type header struct {
+	ts     uint32
+	tsDiff uint32
+	wnd    uint32
+	connID uint16
+	seq    uint16
+	ack    uint16
+	typ    packetType
+}
+
+func (h header) marshal(payload []byte) []byte {
+	b := make([]byte, headerSize+len(payload))
+
+	b[0] = byte(h.typ)<<4 | version
+	b[1] = 0
+	binary.BigEndian.PutUint16(b[2:], h.connID)
+	binary.BigEndian.PutUint32(b[4:], h.ts)
+	binary.BigEndian.PutUint32(b[8:], h.tsDiff)
+	binary.BigEndian.PutUint32(b[12:], h.wnd)
+	binary.BigEndian.PutUint16(b[16:], h.seq)
+	binary.BigEndian.PutUint16(b[18:], h.ack)
+	copy(b[headerSize:], payload)
+
+	return b
+}
+
+// IsPacket check if b looks like an uTP packet, used to share UDP socket with DHT.
+// DHT message is a bencode dict starting with 'd', which is never a valid uTP packet.
+func IsPacket(b []byte) bool {
+	return len(b) >= headerSize && b[0]&0x0f == version && packetType(b[0]>>4) <= stSyn
+}
+
+// parsePacket return header and payload, payload is a sub slice of b.
+func parsePacket(b []byte) (header, []byte, error) {
+	if !IsPacket(b) {
+		return header{}, nil, errInvalidPacket
+	}
+
+	h := header{
+		typ:    packetType(b[0] >> 4),
+		connID: binary.BigEndian.Uint16(b[2:]),
+		ts:     binary.BigEndian.Uint32(b[4:]),
+		tsDiff: binary.BigEndian.Uint32(b[8:]),
+		wnd:    binary.BigEndian.Uint32(b[12:]),
+		seq:    binary.BigEndian.Uint16(b[16:]),
+		ack:    binary.BigEndian.Uint16(b[18:]),
+	}
+
+	// skip extension chain
+	ext := b[1]
+	pos := headerSize
+	for ext != 0 {
+		if len(b) < pos+2 {
+			return header{}, nil, errInvalidPacket
+		}
+
+		ext = b[pos]
+		pos += 2 + int(b[pos+1])
+		if len(b) < pos {
+			return header{}, nil, errInvalidPacket
+		}
+	}
+
+	return h, b[pos:], nil
+}
+
+func nowMicro() uint32 {
+	return uint32(time.Now().UnixMicro())
+}
+
+// seqLess compare sequence numbers with wrapping.
+func seqLess(a, b uint16) bool {
+	return int16(a-b) < 0
+}
@@ -0,0 +1,259 @@
+package utp
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const tickInterval = time.Millisecond * 100
+
+type connKey struct {
+	addr   netip.AddrPort
+	recvID uint16
+}
+
+// Socket multiplex uTP connections over a packet conn, it implements net.Listener.
+type Socket struct {
+	pc     net.PacketConn
+	conns  map[connKey]*Conn
+	accept chan *Conn
+	closed chan struct{}
+	once   sync.Once
+	m      sync.Mutex
+}
+
+var _ net.Listener = (*Socket)(nil)
+
+// NewSocket start reading packets from pc, pc is closed when Socket is closed.
+func NewSocket(pc net.PacketConn) *Socket {
+	s := &Socket{
+		pc:     pc,
+		conns:  make(map[connKey]*Conn),
+		accept: make(chan *Conn, 64),
+		closed: make(chan struct{}),
+	}
+
+	go s.readLoop()
+	go s.tickLoop()
+
+	return s
+}
+
+// Accept wait for next incoming connection.
+func (s *Socket) Accept() (net.Conn, error) {
+	select {
+	case c := <-s.accept:
+		return c, nil
+	case <-s.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (s *Socket) Addr() net.Addr {
+	return s.pc.LocalAddr()
+}
+
+// Close close packet conn and reset all connections.
+func (s *Socket) Close() error {
+	var err error
+
+	s.once.Do(func() {
+		close(s.closed)
+		err = s.pc.Close()
+
+		s.m.Lock()
+		conns := make([]*Conn, 0, len(s.conns))
+		for _, c := range s.conns {
+			conns = append(conns, c)
+		}
+		s.m.Unlock()
+
+		for _, c := range conns {
+			c.m.Lock()
+			c.fail(net.ErrClosed)
+			c.m.Unlock()
+		}
+	})
+
+	return err
+}
+
+// DialContext connect to addr, return after peer acked SYN.
+func (s *Socket) DialContext(ctx context.Context, addr netip.AddrPort) (*Conn, error) {
+	addr = netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port())
+
+	s.m.Lock()
+	if isClosed(s.closed) {
+		s.m.Unlock()
+		return nil, net.ErrClosed
+	}
+
+	var recvID uint16
+	for {
+		recvID = uint16(rand.Uint32())
+		if _, exists := s.conns[connKey{addr: addr, recvID: recvID}]; !exists {
+			break
+		}
+	}
+
+	c := newConn(s, addr, recvID, recvID+1)
+	s.conns[connKey{addr: addr, recvID: recvID}] = c
+	s.m.Unlock()
+
+	c.m.Lock()
+	c.seq = 1
+	c.queue(stSyn, nil)
+	c.m.Unlock()
+
+	select {
+	case <-c.connected:
+		return c, nil
+	case <-c.done:
+		c.m.Lock()
+		err := c.err
+		c.m.Unlock()
+
+		if err == nil {
+			err = net.ErrClosed
+		}
+
+		return nil, err
+	case <-ctx.Done():
+		_ = c.Close()
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Socket) send(addr netip.AddrPort, b []byte) {
+	_, _ = s.pc.WriteTo(b, net.UDPAddrFromAddrPort(addr))
+}
+
+func (s *Socket) remove(c *Conn) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	key := connKey{addr: c.raddr, recvID: c.recvID}
+	if s.conns[key] == c {
+		delete(s.conns, key)
+	}
+}
+
+func (s *Socket) readLoop() {
+	defer s.Close()
+
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, addr, err := s.pc.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+
+			return
+		}
+
+		ua, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		h, payload, err := parsePacket(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		ap := ua.AddrPort()
+		s.dispatch(netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port()), h, payload)
+	}
+}
+
+func (s *Socket) dispatch(addr netip.AddrPort, h header, payload []byte) {
+	switch h.typ {
+	case stSyn:
+		s.handleSyn(addr, h)
+		return
+	case stReset:
+		// peer may reset with either of connection id
+		s.m.Lock()
+		var target *Conn
+		for key, c := range s.conns {
+			if key.addr == addr && (c.recvID == h.connID || c.sendID == h.connID) {
+				target = c
+				break
+			}
+		}
+		s.m.Unlock()
+
+		if target != nil {
+			target.handle(h, payload)
+		}
+
+		return
+	case stData, stFin, stState:
+	}
+
+	s.m.Lock()
+	c := s.conns[connKey{addr: addr, recvID: h.connID}]
+	s.m.Unlock()
+
+	if c != nil {
+		c.handle(h, payload)
+	}
+}
+
+func (s *Socket) handleSyn(addr netip.AddrPort, h header) {
+	key := connKey{addr: addr, recvID: h.connID + 1}
+
+	s.m.Lock()
+	c, exists := s.conns[key]
+	if !exists {
+		c = newConn(s, addr, h.connID+1, h.connID)
+		c.state = stateConnected
+		c.seq = uint16(rand.Uint32())
+		c.ack = h.seq
+		close(c.connected)
+
+		select {
+		case s.accept <- c:
+			s.conns[key] = c
+		default:
+			// accept queue is full, drop SYN
+			s.m.Unlock()
+			return
+		}
+	}
+	s.m.Unlock()
+
+	// ack SYN, or a retransmitted one
+	c.m.Lock()
+	c.sendState()
+	c.m.Unlock()
+}
+
+func (s *Socket) tickLoop() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case now := <-ticker.C:
+			s.m.Lock()
+			conns := make([]*Conn, 0, len(s.conns))
+			for _, c := range s.conns {
+				conns = append(conns, c)
+			}
+			s.m.Unlock()
+
+			for _, c := range conns {
+				c.tick(now)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package utp_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	mrand "math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/pkg/utp"
+)
+
+// lossyConn drop outgoing packets randomly.
+type lossyConn struct {
+	net.PacketConn
+	rate float64
+}
+
+func (l *lossyConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if mrand.Float64() < l.rate {
+		return len(b), nil
+	}
+
+	return l.PacketConn.WriteTo(b, addr)
+}
+
+func newSocket(t *testing.T, wrap func(net.PacketConn) net.PacketConn) *utp.Socket {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	if wrap != nil {
+		pc = wrap(pc)
+	}
+
+	s := utp.NewSocket(pc)
+	t.Cleanup(func() { _ = s.Close() })
+
+	return s
+}
+
+func testTransfer(t *testing.T, a, b *utp.Socket, size int) {
+	t.Helper()
+
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	type result struct {
+		err  error
+		data []byte
+	}
+
+	received := make(chan result, 1)
+	go func() {
+		conn, err := b.Accept()
+		if err != nil {
+			received <- result{err: err}
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second * 20))
+
+		buf, err := io.ReadAll(conn)
+		received <- result{data: buf, err: err}
+	}()
+
+	conn, err := a.DialContext(ctx, netip.MustParseAddrPort(b.Addr().String()))
+	require.NoError(t, err)
+
+	_, err = conn.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	r := <-received
+	require.NoError(t, r.err)
+	require.True(t, bytes.Equal(data, r.data), "received data mismatch")
+}
+
+func TestTransfer(t *testing.T) {
+	t.Parallel()
+
+	testTransfer(t, newSocket(t, nil), newSocket(t, nil), 4<<20+123)
+}
+
+func TestTransferWithLoss(t *testing.T) {
+	t.Parallel()
+
+	lossy := func(pc net.PacketConn) net.PacketConn {
+		return &lossyConn{PacketConn: pc, rate: 0.05}
+	}
+
+	testTransfer(t, newSocket(t, lossy), newSocket(t, lossy), 256<<10+123)
+}
+
+func TestBothDirection(t *testing.T) {
+	t.Parallel()
+
+	a := newSocket(t, nil)
+	b := newSocket(t, nil)
+
+	go func() {
+		conn, err := b.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// echo
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	conn, err := a.DialContext(context.Background(), netip.MustParseAddrPort(b.Addr().String()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	msg := []byte("hello utp")
+	_, err = conn.Write(msg)
+	require.NoError(t, err)
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, msg, buf)
+}
+
+func TestDialTimeout(t *testing.T) {
+	t.Parallel()
+
+	a := newSocket(t, nil)
+
+	// nobody is reading on this port
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	_, err = a.DialContext(ctx, netip.MustParseAddrPort(pc.LocalAddr().String()))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestReadDeadline(t *testing.T) {
+	t.Parallel()
+
+	a := newSocket(t, nil)
+	b := newSocket(t, nil)
+
+	go func() {
+		conn, err := b.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+
+	conn, err := a.DialContext(context.Background(), netip.MustParseAddrPort(b.Addr().String()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Millisecond*50)))
+
+	_, err = conn.Read(make([]byte, 10))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
@@ -0,0 +1,20 @@
+package proto
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// ExtHandshakeID is the extended message id of BEP 10 handshake
+const ExtHandshakeID byte = 0
+
+// SendExtended send a BEP 10 extended message.
+// <len><20><extended message id><payload>
+func SendExtended(conn io.Writer, id byte, payload []byte) error {
+	var b = make([]byte, 0, 6+len(payload))
+	b = binary.BigEndian.AppendUint32(b, uint32(2+len(payload)))
+	b = append(b, byte(Extended), id)
+	b = append(b, payload...)
+	_, err := conn.Write(b)
+	return err
+}
@@ -0,0 +1,18 @@
+package proto_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tyr/internal/proto"
+)
+
+func TestSendExtended(t *testing.T) {
+	var b bytes.Buffer
+
+	assert.NoError(t, proto.SendExtended(&b, 3, []byte("de")))
+
+	assert.Equal(t, "\x00\x00\x00\x04\x14\x03de", b.String())
+}
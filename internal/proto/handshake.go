@@ -24,11 +24,19 @@ var handshakePstrV1 = ro.S("\x13BitTorrent protocol")
 // reserved_byte[7] & 0x04
 var fastExtensionEnabled uint64 = genReversedFlag(7, 0x04)
 
+// https://www.bittorrent.org/beps/bep_0005.html
+// reserved_byte[7] & 0x01
+var dhtEnabled uint64 = genReversedFlag(7, 0x01)
+
 // https://www.bittorrent.org/beps/bep_0010.html
 // reserved_byte[5] & 0x10
 var exchangeExtensionEnabled uint64 = genReversedFlag(5, 0x10)
 
-var handshakeBytes = binary.BigEndian.AppendUint64(nil, exchangeExtensionEnabled|fastExtensionEnabled)
+// https://www.bittorrent.org/beps/bep_0052.html
+// reserved_byte[7] & 0x10
+var v2Enabled uint64 = genReversedFlag(7, 0x10)
+
+var handshakeBytes = binary.BigEndian.AppendUint64(nil, exchangeExtensionEnabled|fastExtensionEnabled|dhtEnabled|v2Enabled)
 
 // SendHandshake = <pStrlen><pStr><reserved><info_hash><peer_id>
 // - pStrlen = length of pStr (1 byte)
@@ -63,6 +71,8 @@ type Handshake struct {
 	PeerID             [20]byte
 	FastExtension      bool
 	ExchangeExtensions bool
+	DHT                bool
+	V2                 bool
 }
 
 func (h Handshake) GoString() string {
@@ -103,6 +113,14 @@ func ReadHandshake(conn io.Reader) (Handshake, error) {
 		h.ExchangeExtensions = true
 	}
 
+	if reversed&dhtEnabled != 0 {
+		h.DHT = true
+	}
+
+	if reversed&v2Enabled != 0 {
+		h.V2 = true
+	}
+
 	n, err = conn.Read(h.InfoHash[:])
 	if err != nil {
 		return Handshake{}, err
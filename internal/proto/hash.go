@@ -0,0 +1,111 @@
+package proto
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"tyr/internal/meta"
+)
+
+// HashesRequest is payload of BEP 52 hash request and hash reject message,
+// Index and Length are position of requested hashes in base layer of merkle tree of file PiecesRoot.
+type HashesRequest struct {
+	PiecesRoot  meta.HashV2
+	BaseLayer   uint32
+	Index       uint32
+	Length      uint32
+	ProofLayers uint32
+}
+
+// SizeHashesRequest is payload size of hash request and hash reject message.
+const SizeHashesRequest = 32 + sizeUint32*4
+
+// HashesResponse is payload of BEP 52 hashes message,
+// Hashes contains Length hashes of base layer followed by uncle hashes.
+type HashesResponse struct {
+	Hashes []meta.HashV2
+	HashesRequest
+}
+
+var ErrInvalidHashesPayload = errors.New("invalid hashes payload")
+
+func SendHashRequest(conn io.Writer, r HashesRequest) error {
+	return sendHashRequestPayload(conn, HashRequest, r)
+}
+
+func SendHashReject(conn io.Writer, r HashesRequest) error {
+	return sendHashRequestPayload(conn, HashReject, r)
+}
+
+func appendHashRequest(b []byte, r HashesRequest) []byte {
+	b = append(b, r.PiecesRoot[:]...)
+	b = binary.BigEndian.AppendUint32(b, r.BaseLayer)
+	b = binary.BigEndian.AppendUint32(b, r.Index)
+	b = binary.BigEndian.AppendUint32(b, r.Length)
+	return binary.BigEndian.AppendUint32(b, r.ProofLayers)
+}
+
+func sendHashRequestPayload(conn io.Writer, id Message, r HashesRequest) error {
+	var b = make([]byte, 0, sizeUint32+sizeByte+SizeHashesRequest)
+
+	b = binary.BigEndian.AppendUint32(b, sizeByte+SizeHashesRequest)
+	b = append(b, byte(id))
+	b = appendHashRequest(b, r)
+
+	_, err := conn.Write(b)
+	return err
+}
+
+func SendHashes(conn io.Writer, r HashesResponse) error {
+	var b = make([]byte, 0, sizeUint32+sizeByte+SizeHashesRequest+len(r.Hashes)*32)
+
+	b = binary.BigEndian.AppendUint32(b, uint32(sizeByte+SizeHashesRequest+len(r.Hashes)*32))
+	b = append(b, byte(Hashes))
+	b = appendHashRequest(b, r.HashesRequest)
+	for _, h := range r.Hashes {
+		b = append(b, h[:]...)
+	}
+
+	_, err := conn.Write(b)
+	return err
+}
+
+func ReadHashRequestPayload(conn io.Reader) (payload HashesRequest, err error) {
+	var b [SizeHashesRequest]byte
+
+	_, err = io.ReadFull(conn, b[:])
+	if err != nil {
+		return
+	}
+
+	copy(payload.PiecesRoot[:], b[:])
+	payload.BaseLayer = binary.BigEndian.Uint32(b[32:])
+	payload.Index = binary.BigEndian.Uint32(b[32+sizeUint32:])
+	payload.Length = binary.BigEndian.Uint32(b[32+sizeUint32*2:])
+	payload.ProofLayers = binary.BigEndian.Uint32(b[32+sizeUint32*3:])
+
+	return
+}
+
+// ReadHashesPayload read hashes message, size is message size without message id.
+func ReadHashesPayload(conn io.Reader, size uint32) (HashesResponse, error) {
+	if size < SizeHashesRequest || (size-SizeHashesRequest)%32 != 0 {
+		return HashesResponse{}, ErrInvalidHashesPayload
+	}
+
+	r, err := ReadHashRequestPayload(conn)
+	if err != nil {
+		return HashesResponse{}, err
+	}
+
+	var payload = HashesResponse{HashesRequest: r, Hashes: make([]meta.HashV2, (size-SizeHashesRequest)/32)}
+	for i := range payload.Hashes {
+		_, err = io.ReadFull(conn, payload.Hashes[i][:])
+		if err != nil {
+			return HashesResponse{}, err
+		}
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,57 @@
+package proto_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/meta"
+	"tyr/internal/proto"
+)
+
+func TestHashesRoundTrip(t *testing.T) {
+	var b bytes.Buffer
+
+	r := proto.HashesResponse{
+		HashesRequest: proto.HashesRequest{
+			PiecesRoot:  meta.HashV2{1, 2, 3},
+			BaseLayer:   1,
+			Index:       4,
+			Length:      2,
+			ProofLayers: 3,
+		},
+		Hashes: []meta.HashV2{{4}, {5}, {6}},
+	}
+
+	require.NoError(t, proto.SendHashes(&b, r))
+
+	var size uint32
+	require.NoError(t, binary.Read(&b, binary.BigEndian, &size))
+	id, err := b.ReadByte()
+	require.NoError(t, err)
+	require.Equal(t, proto.Hashes, proto.Message(id))
+	require.EqualValues(t, b.Len(), size-1)
+
+	payload, err := proto.ReadHashesPayload(&b, size-1)
+	require.NoError(t, err)
+	require.Equal(t, r, payload)
+
+	_, err = proto.ReadHashesPayload(bytes.NewReader(make([]byte, 60)), 60)
+	require.ErrorIs(t, err, proto.ErrInvalidHashesPayload)
+}
+
+func TestHashRequestRoundTrip(t *testing.T) {
+	var b bytes.Buffer
+
+	r := proto.HashesRequest{PiecesRoot: meta.HashV2{9}, Index: 512, Length: 512, ProofLayers: 10}
+	require.NoError(t, proto.SendHashReject(&b, r))
+
+	require.Equal(t, []byte{0, 0, 0, 49, byte(proto.HashReject)}, b.Next(5))
+
+	payload, err := proto.ReadHashRequestPayload(&b)
+	require.NoError(t, err)
+	require.Equal(t, r, payload)
+	require.Equal(t, "HashReject", proto.HashReject.String())
+}
@@ -40,9 +40,9 @@ const (
 	// BEP 52 - BitTorrent Protocol v2
 	//https://www.bittorrent.org/beps/bep_0052.html
 
-	//HashRequest Message = 21
-	//Hashes      Message = 22
-	//HashReject  Message = 23
+	HashRequest Message = 21
+	Hashes      Message = 22
+	HashReject  Message = 23
 
 	BitCometExtension Message = 0xff
 )
@@ -0,0 +1,232 @@
+package udptracker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/trim21/errgo"
+
+	"tyr/internal/pkg/random"
+)
+
+// connection id can be used for one minute after received.
+const connectionIDTTL = time.Minute
+
+// max info hashes in one scrape request
+const maxScrapeHashes = 74
+
+type connectionID struct {
+	expire time.Time
+	id     uint64
+}
+
+// Client is a UDP tracker client, connection ids are cached per tracker host.
+type Client struct {
+	ids map[string]connectionID
+	// timeout of first request, n-th retransmission will wait Timeout * 2^n
+	Timeout time.Duration
+	// retransmission count before giving up
+	MaxRetries int
+	m          sync.Mutex
+}
+
+func New() *Client {
+	return &Client{
+		ids:        make(map[string]connectionID),
+		Timeout:    time.Second * 15,
+		MaxRetries: 3,
+	}
+}
+
+// Announce send announce request to tracker with url like `udp://tracker.example.com:80/announce`.
+func (c *Client) Announce(ctx context.Context, rawURL string, req AnnounceRequest) (AnnounceResponse, error) {
+	conn, host, err := dial(ctx, rawURL)
+	if err != nil {
+		return AnnounceResponse{}, err
+	}
+	defer conn.Close()
+
+	b, err := c.request(ctx, conn, host, actionAnnounce, req.appendBinary(nil))
+	if err != nil {
+		return AnnounceResponse{}, err
+	}
+
+	return parseAnnounceResponse(b, conn.RemoteAddr().(*net.UDPAddr).IP.To4() == nil)
+}
+
+// Scrape request tracker stats of info hashes, result is in the same order of infoHashes.
+func (c *Client) Scrape(ctx context.Context, rawURL string, infoHashes [][20]byte) ([]ScrapeResult, error) {
+	conn, host, err := dial(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var results = make([]ScrapeResult, 0, len(infoHashes))
+
+	for start := 0; start < len(infoHashes); start += maxScrapeHashes {
+		batch := infoHashes[start:min(start+maxScrapeHashes, len(infoHashes))]
+
+		var payload = make([]byte, 0, len(batch)*20)
+		for _, h := range batch {
+			payload = append(payload, h[:]...)
+		}
+
+		b, err := c.request(ctx, conn, host, actionScrape, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := parseScrapeResponse(b, len(batch))
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, r...)
+	}
+
+	return results, nil
+}
+
+func dial(ctx context.Context, rawURL string) (*net.UDPConn, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", errgo.Wrap(err, "failed to parse tracker url")
+	}
+
+	if u.Scheme != "udp" {
+		return nil, "", fmt.Errorf("unsupported tracker scheme %q", u.Scheme)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", u.Host)
+	if err != nil {
+		return nil, "", errgo.Wrap(err, "failed to connect to tracker")
+	}
+
+	return conn.(*net.UDPConn), u.Host, nil
+}
+
+// request send a request with connection id, retransmit if tracker doesn't response in time.
+// return payload after action and transaction id.
+func (c *Client) request(ctx context.Context, conn *net.UDPConn, host string, a action, payload []byte) ([]byte, error) {
+	return c.roundTrip(ctx, conn, host, a, func(tid uint32) ([]byte, error) {
+		id, err := c.connectionID(ctx, conn, host)
+		if err != nil {
+			return nil, err
+		}
+
+		b := binary.BigEndian.AppendUint64(make([]byte, 0, 16+len(payload)), id)
+		b = binary.BigEndian.AppendUint32(b, uint32(a))
+		b = binary.BigEndian.AppendUint32(b, tid)
+
+		return append(b, payload...), nil
+	})
+}
+
+// connectionID return cached connection id of host, or send a connect request.
+func (c *Client) connectionID(ctx context.Context, conn *net.UDPConn, host string) (uint64, error) {
+	c.m.Lock()
+	cached, ok := c.ids[host]
+	c.m.Unlock()
+
+	if ok && time.Now().Before(cached.expire) {
+		return cached.id, nil
+	}
+
+	b, err := c.roundTrip(ctx, conn, host, actionConnect, func(tid uint32) ([]byte, error) {
+		b := binary.BigEndian.AppendUint64(make([]byte, 0, 16), protocolID)
+		b = binary.BigEndian.AppendUint32(b, uint32(actionConnect))
+		return binary.BigEndian.AppendUint32(b, tid), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(b) < 8 {
+		return 0, fmt.Errorf("connect response too short: %d", len(b))
+	}
+
+	id := binary.BigEndian.Uint64(b)
+
+	c.m.Lock()
+	c.ids[host] = connectionID{id: id, expire: time.Now().Add(connectionIDTTL)}
+	c.m.Unlock()
+
+	return id, nil
+}
+
+// roundTrip send request built with a new transaction id on each attempt,
+// and wait for response with same transaction id.
+func (c *Client) roundTrip(
+	ctx context.Context,
+	conn *net.UDPConn,
+	host string,
+	a action,
+	build func(tid uint32) ([]byte, error),
+) ([]byte, error) {
+	var buf = make([]byte, 4096)
+
+	for n := 0; n <= c.MaxRetries; n++ {
+		tid := binary.BigEndian.Uint32(random.Bytes(4))
+
+		req, err := build(tid)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = conn.Write(req); err != nil {
+			return nil, errgo.Wrap(err, "failed to send request to tracker")
+		}
+
+		deadline := time.Now().Add(c.Timeout << n)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+
+		_ = conn.SetReadDeadline(deadline)
+
+		for {
+			size, err := conn.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+
+				return nil, errgo.Wrap(err, "failed to read tracker response")
+			}
+
+			if size < 8 || binary.BigEndian.Uint32(buf[4:]) != tid {
+				continue
+			}
+
+			switch action(binary.BigEndian.Uint32(buf)) {
+			case a:
+				return append([]byte(nil), buf[8:size]...), nil
+			case actionError:
+				// connection id may be expired by tracker
+				c.m.Lock()
+				delete(c.ids, host)
+				c.m.Unlock()
+
+				return nil, Error(buf[8:size])
+			case actionConnect, actionAnnounce, actionScrape:
+			}
+
+			return nil, fmt.Errorf("unexpected tracker response action %d", binary.BigEndian.Uint32(buf))
+		}
+
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, errors.New("tracker response timeout")
+}
@@ -0,0 +1,132 @@
+package udptracker_test
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"tyr/internal/udptracker"
+)
+
+func newClient() *udptracker.Client {
+	c := udptracker.New()
+	c.Timeout = time.Millisecond * 50
+	return c
+}
+
+func TestAnnounce(t *testing.T) {
+	f := newFakeTracker(t, "udp4", "127.0.0.1:0", func(f *fakeTracker) {
+		f.peers = []netip.AddrPort{
+			netip.MustParseAddrPort("1.2.3.4:5678"),
+			netip.MustParseAddrPort("5.6.7.8:80"),
+		}
+	})
+
+	c := newClient()
+
+	var infoHash = [20]byte{1, 2, 3}
+
+	r, err := c.Announce(context.Background(), f.url(), udptracker.AnnounceRequest{
+		InfoHash: infoHash,
+		Event:    udptracker.EventStarted,
+		NumWant:  -1,
+		Port:     6881,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, f.peers, r.Peers)
+	require.EqualValues(t, 1800, r.Interval)
+	require.EqualValues(t, 2, r.Leechers)
+	require.EqualValues(t, 3, r.Seeders)
+
+	announces := f.announces()
+	require.Len(t, announces, 1)
+	require.Equal(t, infoHash, announces[0].infoHash)
+	require.EqualValues(t, udptracker.EventStarted, announces[0].event)
+	require.EqualValues(t, 6881, announces[0].port)
+}
+
+func TestAnnounceIPv6(t *testing.T) {
+	f := newFakeTracker(t, "udp6", "[::1]:0", func(f *fakeTracker) {
+		f.peers = []netip.AddrPort{netip.MustParseAddrPort("[2001:db8::1]:6881")}
+	})
+
+	r, err := newClient().Announce(context.Background(), f.url(), udptracker.AnnounceRequest{NumWant: -1})
+	require.NoError(t, err)
+
+	require.Equal(t, f.peers, r.Peers)
+}
+
+func TestConnectionIDCached(t *testing.T) {
+	f := newFakeTracker(t, "udp4", "127.0.0.1:0", nil)
+
+	c := newClient()
+
+	for range 3 {
+		_, err := c.Announce(context.Background(), f.url(), udptracker.AnnounceRequest{NumWant: -1})
+		require.NoError(t, err)
+	}
+
+	require.EqualValues(t, 1, f.connects.Load())
+	require.Len(t, f.announces(), 3)
+}
+
+func TestRetransmission(t *testing.T) {
+	f := newFakeTracker(t, "udp4", "127.0.0.1:0", nil)
+	f.drop.Store(2)
+
+	_, err := newClient().Announce(context.Background(), f.url(), udptracker.AnnounceRequest{NumWant: -1})
+	require.NoError(t, err)
+
+	require.Len(t, f.announces(), 1)
+}
+
+func TestTimeout(t *testing.T) {
+	f := newFakeTracker(t, "udp4", "127.0.0.1:0", nil)
+	f.drop.Store(100)
+
+	c := newClient()
+	c.MaxRetries = 1
+
+	_, err := c.Announce(context.Background(), f.url(), udptracker.AnnounceRequest{NumWant: -1})
+	require.Error(t, err)
+}
+
+func TestTrackerError(t *testing.T) {
+	f := newFakeTracker(t, "udp4", "127.0.0.1:0", func(f *fakeTracker) {
+		f.failure = "torrent not registered"
+	})
+
+	_, err := newClient().Announce(context.Background(), f.url(), udptracker.AnnounceRequest{NumWant: -1})
+
+	var trackerErr udptracker.Error
+	require.ErrorAs(t, err, &trackerErr)
+	require.Equal(t, "torrent not registered", string(trackerErr))
+}
+
+func TestScrape(t *testing.T) {
+	var hashes = make([][20]byte, 100)
+	for i := range hashes {
+		hashes[i] = [20]byte{byte(i), 1}
+	}
+
+	f := newFakeTracker(t, "udp4", "127.0.0.1:0", func(f *fakeTracker) {
+		for i, h := range hashes {
+			f.scrape[h] = [3]uint32{uint32(i), 2, 3}
+		}
+	})
+
+	r, err := newClient().Scrape(context.Background(), f.url(), hashes)
+	require.NoError(t, err)
+
+	require.Len(t, r, len(hashes))
+	for i, s := range r {
+		require.Equal(t, udptracker.ScrapeResult{Seeders: uint32(i), Completed: 2, Leechers: 3}, s)
+	}
+
+	// connection id is shared between batched requests
+	require.EqualValues(t, 1, f.connects.Load())
+}
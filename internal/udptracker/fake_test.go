@@ -0,0 +1,159 @@
+package udptracker_test
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	actionConnect  = 0
+	actionAnnounce = 1
+	actionScrape   = 2
+	actionError    = 3
+)
+
+// fakeTracker is a minimal UDP tracker for tests.
+type fakeTracker struct {
+	conn     net.PacketConn
+	scrape   map[[20]byte][3]uint32
+	peers    []netip.AddrPort
+	announce []announce
+	// error message to response announce request
+	failure  string
+	connects atomic.Int32
+	// drop first n packets to test retransmission
+	drop     atomic.Int32
+	interval uint32
+	m        sync.Mutex
+	connID   uint64
+}
+
+type announce struct {
+	infoHash [20]byte
+	event    uint32
+	port     uint16
+}
+
+// newFakeTracker start a fake tracker, setup is called before serving.
+func newFakeTracker(t *testing.T, network, address string, setup func(f *fakeTracker)) *fakeTracker {
+	t.Helper()
+
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		t.Skipf("failed to listen on %s %s: %s", network, address, err)
+	}
+
+	f := &fakeTracker{
+		conn:     conn,
+		connID:   0x1234567890,
+		interval: 1800,
+		scrape:   make(map[[20]byte][3]uint32),
+	}
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	if setup != nil {
+		setup(f)
+	}
+
+	go f.serve()
+
+	return f
+}
+
+func (f *fakeTracker) url() string {
+	return "udp://" + f.conn.LocalAddr().String() + "/announce"
+}
+
+func (f *fakeTracker) announces() []announce {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	return append([]announce(nil), f.announce...)
+}
+
+func (f *fakeTracker) serve() {
+	var buf = make([]byte, 2048)
+
+	for {
+		n, addr, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		if f.drop.Load() > 0 {
+			f.drop.Dec()
+			continue
+		}
+
+		if n < 16 {
+			continue
+		}
+
+		req := buf[:n]
+		a := binary.BigEndian.Uint32(req[8:])
+		tid := req[12:16]
+
+		var res []byte
+		res = binary.BigEndian.AppendUint32(res, a)
+		res = append(res, tid...)
+
+		if a == actionConnect {
+			f.connects.Inc()
+			res = binary.BigEndian.AppendUint64(res, f.connID)
+			_, _ = f.conn.WriteTo(res, addr)
+			continue
+		}
+
+		if binary.BigEndian.Uint64(req) != f.connID {
+			_, _ = f.conn.WriteTo(errorResponse(tid, "invalid connection id"), addr)
+			continue
+		}
+
+		switch a {
+		case actionAnnounce:
+			if f.failure != "" {
+				_, _ = f.conn.WriteTo(errorResponse(tid, f.failure), addr)
+				continue
+			}
+
+			f.m.Lock()
+			f.announce = append(f.announce, announce{
+				infoHash: [20]byte(req[16:36]),
+				event:    binary.BigEndian.Uint32(req[80:]),
+				port:     binary.BigEndian.Uint16(req[96:]),
+			})
+			f.m.Unlock()
+
+			res = binary.BigEndian.AppendUint32(res, f.interval)
+			res = binary.BigEndian.AppendUint32(res, 2)
+			res = binary.BigEndian.AppendUint32(res, 3)
+			for _, p := range f.peers {
+				res = append(res, p.Addr().AsSlice()...)
+				res = binary.BigEndian.AppendUint16(res, p.Port())
+			}
+		case actionScrape:
+			for i := 16; i+20 <= n; i += 20 {
+				s := f.scrape[[20]byte(req[i:i+20])]
+				for _, v := range s {
+					res = binary.BigEndian.AppendUint32(res, v)
+				}
+			}
+		}
+
+		_, _ = f.conn.WriteTo(res, addr)
+	}
+}
+
+func errorResponse(tid []byte, msg string) []byte {
+	res := binary.BigEndian.AppendUint32(nil, actionError)
+	res = append(res, tid...)
+	return append(res, msg...)
+}
@@ -0,0 +1,135 @@
+// Package udptracker implement UDP tracker protocol, BEP 15.
+//
+// https://www.bittorrent.org/beps/bep_0015.html
+package udptracker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+)
+
+const protocolID uint64 = 0x41727101980
+
+type action uint32
+
+const (
+	actionConnect  action = 0
+	actionAnnounce action = 1
+	actionScrape   action = 2
+	actionError    action = 3
+)
+
+type Event uint32
+
+const (
+	EventNone      Event = 0
+	EventCompleted Event = 1
+	EventStarted   Event = 2
+	EventStopped   Event = 3
+)
+
+// Error is error message returned by tracker.
+type Error string
+
+func (e Error) Error() string {
+	return fmt.Sprintf("tracker error: %s", string(e))
+}
+
+type AnnounceRequest struct {
+	InfoHash   [20]byte
+	PeerID     [20]byte
+	Downloaded int64
+	Left       int64
+	Uploaded   int64
+	Event      Event
+	Key        uint32
+	// -1 for default
+	NumWant int32
+	Port    uint16
+}
+
+func (r AnnounceRequest) appendBinary(b []byte) []byte {
+	b = append(b, r.InfoHash[:]...)
+	b = append(b, r.PeerID[:]...)
+	b = binary.BigEndian.AppendUint64(b, uint64(r.Downloaded))
+	b = binary.BigEndian.AppendUint64(b, uint64(r.Left))
+	b = binary.BigEndian.AppendUint64(b, uint64(r.Uploaded))
+	b = binary.BigEndian.AppendUint32(b, uint32(r.Event))
+	// ip address, 0 for sender address
+	b = binary.BigEndian.AppendUint32(b, 0)
+	b = binary.BigEndian.AppendUint32(b, r.Key)
+	b = binary.BigEndian.AppendUint32(b, uint32(r.NumWant))
+	b = binary.BigEndian.AppendUint16(b, r.Port)
+
+	return b
+}
+
+type AnnounceResponse struct {
+	Peers    []netip.AddrPort
+	Interval uint32
+	Leechers uint32
+	Seeders  uint32
+}
+
+// parseAnnounceResponse parse announce response payload after action and transaction id.
+// peers are ipv6 address if tracker is connected with ipv6.
+func parseAnnounceResponse(b []byte, ipv6 bool) (AnnounceResponse, error) {
+	if len(b) < 12 {
+		return AnnounceResponse{}, fmt.Errorf("announce response too short: %d", len(b))
+	}
+
+	r := AnnounceResponse{
+		Interval: binary.BigEndian.Uint32(b),
+		Leechers: binary.BigEndian.Uint32(b[4:]),
+		Seeders:  binary.BigEndian.Uint32(b[8:]),
+	}
+
+	b = b[12:]
+
+	size := 6
+	if ipv6 {
+		size = 18
+	}
+
+	if len(b)%size != 0 {
+		return r, fmt.Errorf("invalid peers length %d", len(b))
+	}
+
+	r.Peers = make([]netip.AddrPort, 0, len(b)/size)
+	for i := 0; i < len(b); i += size {
+		var addr netip.Addr
+		if ipv6 {
+			addr = netip.AddrFrom16([16]byte(b[i : i+16]))
+		} else {
+			addr = netip.AddrFrom4([4]byte(b[i : i+4]))
+		}
+
+		r.Peers = append(r.Peers, netip.AddrPortFrom(addr, binary.BigEndian.Uint16(b[i+size-2:])))
+	}
+
+	return r, nil
+}
+
+type ScrapeResult struct {
+	Seeders   uint32
+	Completed uint32
+	Leechers  uint32
+}
+
+func parseScrapeResponse(b []byte, count int) ([]ScrapeResult, error) {
+	if len(b) < count*12 {
+		return nil, fmt.Errorf("scrape response too short: %d", len(b))
+	}
+
+	var results = make([]ScrapeResult, count)
+	for i := range results {
+		results[i] = ScrapeResult{
+			Seeders:   binary.BigEndian.Uint32(b[i*12:]),
+			Completed: binary.BigEndian.Uint32(b[i*12+4:]),
+			Leechers:  binary.BigEndian.Uint32(b[i*12+8:]),
+		}
+	}
+
+	return results, nil
+}
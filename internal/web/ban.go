@@ -0,0 +1,68 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/swaggest/usecase"
+
+	"tyr/internal/core"
+	"tyr/internal/web/jsonrpc"
+)
+
+type BanInfo struct {
+	IP       string `json:"ip" required:"true"`
+	InfoHash string `json:"info_hash" description:"torrent the peer sent corrupted data" required:"true"`
+	BannedAt int64  `json:"banned_at" description:"unix timestamp" required:"true"`
+}
+
+type ListBansResponse struct {
+	Bans []BanInfo `json:"bans" required:"true"`
+}
+
+type ClearBansRequest struct {
+	IPs []string `json:"ips" description:"ip addresses to unban, empty to clear all bans"`
+}
+
+func ListBans(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*struct{}, ListBansResponse](
+		func(ctx context.Context, _ *struct{}, res *ListBansResponse) error {
+			bans := c.ListBans()
+
+			res.Bans = make([]BanInfo, len(bans))
+			for i, ban := range bans {
+				res.Bans[i] = BanInfo{IP: ban.Addr.String(), InfoHash: ban.InfoHash.Hex(), BannedAt: ban.At.Unix()}
+			}
+
+			return nil
+		},
+	)
+
+	u.SetName("client.list_bans")
+	h.Add(u)
+}
+
+// ClearBans unban peers, their strikes of corrupted data are also reset.
+func ClearBans(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*ClearBansRequest, struct{}](
+		func(ctx context.Context, req *ClearBansRequest, _ *struct{}) error {
+			var addrs = make([]netip.Addr, len(req.IPs))
+			for i, s := range req.IPs {
+				addr, err := netip.ParseAddr(s)
+				if err != nil {
+					return CodeError(1, fmt.Errorf("invalid ip %q", s))
+				}
+
+				addrs[i] = addr
+			}
+
+			c.ClearBans(addrs)
+
+			return nil
+		},
+	)
+
+	u.SetName("client.clear_bans")
+	h.Add(u)
+}
@@ -0,0 +1,150 @@
+package web
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"tyr/internal/core"
+	"tyr/internal/meta"
+	"tyr/internal/web/res"
+)
+
+// sseKeepAlive is interval of comment line sent to keep connection alive through proxies.
+const sseKeepAlive = time.Second * 15
+
+type Event struct {
+	Type     string  `json:"type"`
+	InfoHash string  `json:"info_hash"`
+	Time     int64   `json:"time" description:"unix timestamp in milliseconds"`
+	From     string  `json:"from,omitempty"`
+	To       string  `json:"to,omitempty"`
+	Piece    *uint32 `json:"piece,omitempty"`
+	Tracker  string  `json:"tracker,omitempty"`
+	Message  string  `json:"message,omitempty"`
+}
+
+// streamEvents send client events as server-sent events.
+// Events can be filtered by query `info_hash` and `type`, both can be repeated or comma separated.
+// If client is too slow to receive events, a `resync` event is sent and stream is closed.
+func streamEvents(c *core.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseEventFilter(r)
+		if err != nil {
+			res.Text(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			res.Text(w, http.StatusInternalServerError, "streaming is not supported")
+			return
+		}
+
+		sub := c.Subscribe(filter)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ticker := time.NewTicker(sseKeepAlive)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case e, ok := <-sub.C:
+				if !ok {
+					if sub.Overflow() {
+						// events are dropped, client should reload all torrents and reconnect.
+						_, _ = fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+						flusher.Flush()
+					}
+
+					return
+				}
+
+				data, err := json.Marshal(toEvent(e))
+				if err != nil {
+					return
+				}
+
+				if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+					return
+				}
+			}
+
+			flusher.Flush()
+		}
+	}
+}
+
+func parseEventFilter(r *http.Request) (core.EventFilter, error) {
+	var filter core.EventFilter
+	q := r.URL.Query()
+
+	for _, s := range splitQuery(q["info_hash"]) {
+		ih, err := hex.DecodeString(s)
+		if err != nil || len(ih) != 20 {
+			return filter, fmt.Errorf("invalid info_hash %q", s)
+		}
+
+		filter.InfoHashes = append(filter.InfoHashes, meta.Hash(ih))
+	}
+
+	for _, s := range splitQuery(q["type"]) {
+		if !slices.Contains(core.EventTypes, core.EventType(s)) {
+			return filter, fmt.Errorf("invalid event type %q", s)
+		}
+
+		filter.Types = append(filter.Types, core.EventType(s))
+	}
+
+	return filter, nil
+}
+
+// splitQuery split comma separated query values.
+func splitQuery(values []string) []string {
+	var r []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				r = append(r, s)
+			}
+		}
+	}
+
+	return r
+}
+
+func toEvent(e core.ClientEvent) Event {
+	r := Event{
+		Type:     string(e.Type),
+		InfoHash: e.InfoHash.Hex(),
+		Time:     e.Time.UnixMilli(),
+		Tracker:  e.Tracker,
+		Message:  e.Message,
+	}
+
+	if e.Type == core.EventStateChanged {
+		r.From = e.From.String()
+		r.To = e.To.String()
+	}
+
+	if e.Type == core.EventPieceCompleted {
+		r.Piece = &e.Piece
+	}
+
+	return r
+}
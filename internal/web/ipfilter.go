@@ -0,0 +1,34 @@
+package web
+
+import (
+	"context"
+
+	"github.com/swaggest/usecase"
+	"github.com/trim21/errgo"
+
+	"tyr/internal/core"
+	"tyr/internal/web/jsonrpc"
+)
+
+type ReloadIPFilterResponse struct {
+	Ranges int `json:"ranges" description:"ip ranges in filter after merging overlapped ranges" required:"true"`
+}
+
+// ReloadIPFilter load ip filter files from config and session directory again.
+func ReloadIPFilter(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*struct{}, ReloadIPFilterResponse](
+		func(ctx context.Context, _ *struct{}, res *ReloadIPFilterResponse) error {
+			n, err := c.ReloadIPFilter()
+			if err != nil {
+				return CodeError(1, errgo.Wrap(err, "failed to reload ip filter"))
+			}
+
+			res.Ranges = n
+
+			return nil
+		},
+	)
+
+	u.SetName("client.reload_ip_filter")
+	h.Add(u)
+}
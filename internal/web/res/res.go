@@ -9,12 +9,12 @@ import (
 
 func JSON(w http.ResponseWriter, code int, value any) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(code)
 	_ = json.NewEncoder(w).Encode(value)
 }
 
 func Text(w http.ResponseWriter, code int, value string) {
 	w.Header().Set("Content-Type", "plain/text")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(code)
 	_, _ = w.Write(unsafe.Bytes(value))
 }
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"context"
+	"time"
+
+	"github.com/swaggest/usecase"
+
+	"tyr/internal/core"
+	"tyr/internal/meta"
+	"tyr/internal/web/jsonrpc"
+)
+
+type TorrentSeedingLimitsRequest struct {
+	InfoHashes []string `json:"info_hashes" required:"true" validate:"required,min=1"`
+	Action     string   `json:"action" description:"action when any limit is reached: stop, remove or remove-data, default to stop" validate:"omitempty,oneof=stop remove remove-data"`
+	RatioLimit float64  `json:"ratio_limit" description:"0 for unlimited" validate:"gte=0"`
+	TimeLimit  int64    `json:"time_limit" description:"seeding time in seconds, 0 for unlimited" validate:"gte=0"`
+	IdleLimit  int64    `json:"idle_limit" description:"seeding time without uploading in seconds, 0 for unlimited" validate:"gte=0"`
+	UseGlobal  bool     `json:"use_global" description:"use global seeding limits from config, other limits are ignored"`
+}
+
+func SetTorrentSeedingLimits(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*TorrentSeedingLimitsRequest, BatchTorrentResponse](
+		func(ctx context.Context, req *TorrentSeedingLimitsRequest, res *BatchTorrentResponse) error {
+			var limits *core.SeedingLimits
+
+			if !req.UseGlobal {
+				action := core.SeedingActionStop
+				if req.Action != "" {
+					var err error
+					if action, err = core.ParseSeedingAction(req.Action); err != nil {
+						return CodeError(2, err)
+					}
+				}
+
+				limits = &core.SeedingLimits{
+					Action:   action,
+					Ratio:    req.RatioLimit,
+					Time:     time.Duration(req.TimeLimit) * time.Second,
+					IdleTime: time.Duration(req.IdleLimit) * time.Second,
+				}
+			}
+
+			res.Errors = eachInfoHash(req.InfoHashes, func(h meta.Hash) error {
+				return c.SetSeedingLimits(h, limits)
+			})
+
+			return nil
+		},
+	)
+
+	u.SetName("torrent.set_seeding_limits")
+	h.Add(u)
+}
+
+// durationSeconds convert duration to seconds, negative duration means unlimited and is -1.
+func durationSeconds(d time.Duration) int64 {
+	if d < 0 {
+		return -1
+	}
+
+	return int64(d.Seconds())
+}
@@ -0,0 +1,82 @@
+package web
+
+import (
+	"context"
+
+	"github.com/swaggest/usecase"
+
+	"tyr/internal/core"
+	"tyr/internal/meta"
+	"tyr/internal/web/jsonrpc"
+)
+
+type SpeedLimitsRequest struct {
+	DownloadLimit int64 `json:"download_limit" description:"bytes per second, 0 for unlimited" validate:"gte=0"`
+	UploadLimit   int64 `json:"upload_limit" description:"bytes per second, 0 for unlimited" validate:"gte=0"`
+}
+
+type SpeedLimitsResponse struct {
+	DownloadLimit       int64 `json:"download_limit" required:"true"`
+	UploadLimit         int64 `json:"upload_limit" required:"true"`
+	ActiveDownloadLimit int64 `json:"active_download_limit" description:"limit in use, may be overridden by speed schedule" required:"true"`
+	ActiveUploadLimit   int64 `json:"active_upload_limit" description:"limit in use, may be overridden by speed schedule" required:"true"`
+	Scheduled           bool  `json:"scheduled" description:"a speed schedule profile is active" required:"true"`
+}
+
+type TorrentSpeedLimitsRequest struct {
+	InfoHashes    []string `json:"info_hashes" required:"true" validate:"required,min=1"`
+	DownloadLimit int64    `json:"download_limit" description:"bytes per second, 0 for unlimited" validate:"gte=0"`
+	UploadLimit   int64    `json:"upload_limit" description:"bytes per second, 0 for unlimited" validate:"gte=0"`
+}
+
+func GetSpeedLimits(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*struct{}, SpeedLimitsResponse](
+		func(ctx context.Context, _ *struct{}, res *SpeedLimitsResponse) error {
+			*res = speedLimitsResponse(c.SpeedLimits())
+
+			return nil
+		},
+	)
+
+	u.SetName("client.get_speed_limits")
+	h.Add(u)
+}
+
+func SetSpeedLimits(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*SpeedLimitsRequest, SpeedLimitsResponse](
+		func(ctx context.Context, req *SpeedLimitsRequest, res *SpeedLimitsResponse) error {
+			c.SetSpeedLimits(req.DownloadLimit, req.UploadLimit)
+			*res = speedLimitsResponse(c.SpeedLimits())
+
+			return nil
+		},
+	)
+
+	u.SetName("client.set_speed_limits")
+	h.Add(u)
+}
+
+func SetTorrentSpeedLimits(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*TorrentSpeedLimitsRequest, BatchTorrentResponse](
+		func(ctx context.Context, req *TorrentSpeedLimitsRequest, res *BatchTorrentResponse) error {
+			res.Errors = eachInfoHash(req.InfoHashes, func(h meta.Hash) error {
+				return c.SetDownloadSpeedLimits(h, req.DownloadLimit, req.UploadLimit)
+			})
+
+			return nil
+		},
+	)
+
+	u.SetName("torrent.set_speed_limits")
+	h.Add(u)
+}
+
+func speedLimitsResponse(l core.SpeedLimits) SpeedLimitsResponse {
+	return SpeedLimitsResponse{
+		DownloadLimit:       l.DownloadLimit,
+		UploadLimit:         l.UploadLimit,
+		ActiveDownloadLimit: l.ActiveDownloadLimit,
+		ActiveUploadLimit:   l.ActiveUploadLimit,
+		Scheduled:           l.Scheduled,
+	}
+}
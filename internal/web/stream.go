@@ -0,0 +1,62 @@
+package web
+
+import (
+	"encoding/hex"
+	"errors"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"tyr/internal/core"
+	"tyr/internal/meta"
+	"tyr/internal/web/res"
+)
+
+// streamFile serve a file of torrent with range support.
+// Pieces are downloaded in order of reading, response is blocked until they are verified.
+func streamFile(c *core.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ih, err := hex.DecodeString(chi.URLParam(r, "info_hash"))
+		if err != nil || len(ih) != 20 {
+			res.Text(w, http.StatusBadRequest, "invalid info_hash")
+			return
+		}
+
+		index, err := strconv.Atoi(chi.URLParam(r, "file_index"))
+		if err != nil {
+			res.Text(w, http.StatusBadRequest, "invalid file index")
+			return
+		}
+
+		f, err := c.OpenFile(r.Context(), meta.Hash(ih), index)
+		if err != nil {
+			if errors.Is(err, core.ErrTorrentNotFound) {
+				res.Text(w, http.StatusNotFound, err.Error())
+				return
+			}
+
+			if errors.Is(err, core.ErrTorrentNotActive) {
+				res.Text(w, http.StatusConflict, err.Error())
+				return
+			}
+
+			res.Text(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		defer f.Close()
+
+		// set content type so ServeContent won't read file content to sniff it.
+		contentType := mime.TypeByExtension(filepath.Ext(f.Name()))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		w.Header().Set("Content-Type", contentType)
+
+		http.ServeContent(w, r, filepath.Base(f.Name()), time.Time{}, f)
+	}
+}
@@ -0,0 +1,178 @@
+package web
+
+import (
+	"context"
+
+	"github.com/swaggest/usecase"
+	"github.com/trim21/errgo"
+
+	"tyr/internal/core"
+	"tyr/internal/meta"
+	"tyr/internal/web/jsonrpc"
+)
+
+type TorrentTagsRequest struct {
+	InfoHashes []string `json:"info_hashes" required:"true" validate:"required,min=1"`
+	Tags       []string `json:"tags" required:"true" validate:"required,min=1,dive,required"`
+}
+
+type RenameTagRequest struct {
+	From string `json:"from" required:"true" validate:"required"`
+	To   string `json:"to" required:"true" validate:"required"`
+}
+
+type TagCount struct {
+	Name  string `json:"name" required:"true"`
+	Count int    `json:"count" description:"how many torrents have this tag" required:"true"`
+}
+
+type ListTagsResponse struct {
+	Tags []TagCount `json:"tags" required:"true"`
+}
+
+type TorrentCategoryRequest struct {
+	InfoHashes []string `json:"info_hashes" required:"true" validate:"required,min=1"`
+	Category   string   `json:"category" description:"empty to remove torrents from category. torrents are moved to save path of category"`
+}
+
+type Category struct {
+	Name     string `json:"name" required:"true" validate:"required"`
+	SavePath string `json:"save_path" description:"default save path of torrents in this category, empty for not moving torrents"`
+}
+
+type RemoveCategoryRequest struct {
+	Name string `json:"name" required:"true" validate:"required"`
+}
+
+type ListCategoriesResponse struct {
+	Categories []Category `json:"categories" required:"true"`
+}
+
+func AddTorrentTags(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*TorrentTagsRequest, BatchTorrentResponse](
+		func(ctx context.Context, req *TorrentTagsRequest, res *BatchTorrentResponse) error {
+			res.Errors = eachInfoHash(req.InfoHashes, func(h meta.Hash) error {
+				return c.AddTags(h, req.Tags)
+			})
+
+			return nil
+		},
+	)
+
+	u.SetName("torrent.add_tags")
+	h.Add(u)
+}
+
+func RemoveTorrentTags(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*TorrentTagsRequest, BatchTorrentResponse](
+		func(ctx context.Context, req *TorrentTagsRequest, res *BatchTorrentResponse) error {
+			res.Errors = eachInfoHash(req.InfoHashes, func(h meta.Hash) error {
+				return c.RemoveTags(h, req.Tags)
+			})
+
+			return nil
+		},
+	)
+
+	u.SetName("torrent.remove_tags")
+	h.Add(u)
+}
+
+// RenameTag rename tag of all torrents.
+func RenameTag(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*RenameTagRequest, struct{}](
+		func(ctx context.Context, req *RenameTagRequest, _ *struct{}) error {
+			if err := c.RenameTag(req.From, req.To); err != nil {
+				return CodeError(1, errgo.Wrap(err, "failed to rename tag"))
+			}
+
+			return nil
+		},
+	)
+
+	u.SetName("client.rename_tag")
+	h.Add(u)
+}
+
+func ListTags(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*struct{}, ListTagsResponse](
+		func(ctx context.Context, _ *struct{}, res *ListTagsResponse) error {
+			tags := c.ListTags()
+
+			res.Tags = make([]TagCount, len(tags))
+			for i, tag := range tags {
+				res.Tags[i] = TagCount{Name: tag.Name, Count: tag.Count}
+			}
+
+			return nil
+		},
+	)
+
+	u.SetName("client.list_tags")
+	h.Add(u)
+}
+
+func SetTorrentCategory(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*TorrentCategoryRequest, BatchTorrentResponse](
+		func(ctx context.Context, req *TorrentCategoryRequest, res *BatchTorrentResponse) error {
+			res.Errors = eachInfoHash(req.InfoHashes, func(h meta.Hash) error {
+				return c.SetTorrentCategory(h, req.Category)
+			})
+
+			return nil
+		},
+	)
+
+	u.SetName("torrent.set_category")
+	h.Add(u)
+}
+
+// SetCategory create a category or change its save path, torrents already in category are not moved.
+func SetCategory(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*Category, struct{}](
+		func(ctx context.Context, req *Category, _ *struct{}) error {
+			if err := c.SetCategory(req.Name, req.SavePath); err != nil {
+				return CodeError(1, errgo.Wrap(err, "failed to set category"))
+			}
+
+			return nil
+		},
+	)
+
+	u.SetName("client.set_category")
+	h.Add(u)
+}
+
+// RemoveCategory remove a category, torrents in it become uncategorized.
+func RemoveCategory(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*RemoveCategoryRequest, struct{}](
+		func(ctx context.Context, req *RemoveCategoryRequest, _ *struct{}) error {
+			if err := c.RemoveCategory(req.Name); err != nil {
+				return CodeError(1, errgo.Wrap(err, "failed to remove category"))
+			}
+
+			return nil
+		},
+	)
+
+	u.SetName("client.remove_category")
+	h.Add(u)
+}
+
+func ListCategories(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*struct{}, ListCategoriesResponse](
+		func(ctx context.Context, _ *struct{}, res *ListCategoriesResponse) error {
+			categories := c.ListCategories()
+
+			res.Categories = make([]Category, len(categories))
+			for i, category := range categories {
+				res.Categories[i] = Category{Name: category.Name, SavePath: category.SavePath}
+			}
+
+			return nil
+		},
+	)
+
+	u.SetName("client.list_categories")
+	h.Add(u)
+}
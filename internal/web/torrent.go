@@ -19,10 +19,14 @@ import (
 )
 
 type AddTorrentRequest struct {
-	TorrentFile []byte   `json:"torrent_file" required:"true" description:"base64 encoded torrent file content" validate:"required"`
+	TorrentFile []byte   `json:"torrent_file" description:"base64 encoded torrent file content" validate:"required_without=Magnet"`
+	Magnet      string   `json:"magnet" description:"magnet uri, used when torrent_file is empty" validate:"required_without=TorrentFile"`
 	DownloadDir string   `json:"download_dir" description:"download dir"`
 	Tags        []string `json:"tags"`
-	IsBaseDir   bool     `json:"is_base_dir" description:"if true, will not append torrent name to download_dir"`
+	Category    string   `json:"category" description:"torrent is saved to save path of category if download_dir is empty"`
+	// not supported for magnet, metadata is not available yet.
+	FilePriorities []string `json:"file_priorities" description:"priority of each file in torrent order, skip, low, normal or high. empty to download all files" validate:"dive,oneof=skip low normal high"`
+	IsBaseDir      bool     `json:"is_base_dir" description:"if true, will not append torrent name to download_dir"`
 }
 
 type AddTorrentResponse struct {
@@ -32,6 +36,10 @@ type AddTorrentResponse struct {
 func AddTorrent(h *jsonrpc.Handler, c *core.Client) {
 	u := usecase.NewInteractor[*AddTorrentRequest, AddTorrentResponse](
 		func(ctx context.Context, req *AddTorrentRequest, res *AddTorrentResponse) error {
+			if len(req.TorrentFile) == 0 {
+				return addMagnet(c, req, res)
+			}
+
 			m, err := metainfo.Load(bytes.NewBuffer(req.TorrentFile))
 			if err != nil {
 				return CodeError(2, errgo.Wrap(err, "failed to parse torrent file"))
@@ -42,31 +50,39 @@ func AddTorrent(h *jsonrpc.Handler, c *core.Client) {
 				return CodeError(2, errgo.Wrap(err, "failed to parse torrent info"))
 			}
 
+			info.HTTPSeeds = meta.HTTPSeeds(req.TorrentFile)
+
 			if info.PieceLength > 256*units.MiB {
 				return CodeError(4,
 					fmt.Errorf("piece length %s too big, only allow <= 256 MiB",
 						humanize.IBytes(uint64(info.PieceLength))))
 			}
 
-			var downloadDir = req.DownloadDir
-
-			if downloadDir == "" {
-				downloadDir = c.Config.App.DownloadDir
-			} else {
-				if !req.IsBaseDir {
-					downloadDir = filepath.Join(req.DownloadDir, info.Name)
-				}
+			downloadDir, err := addDownloadDir(c, req, info.Name)
+			if err != nil {
+				return err
 			}
 
 			if req.Tags == nil {
 				req.Tags = []string{}
 			}
-			err = c.AddTorrent(m, info, downloadDir, req.Tags)
+
+			var filePriority []core.FilePriority
+			if len(req.FilePriorities) != 0 {
+				filePriority = make([]core.FilePriority, len(req.FilePriorities))
+				for i, s := range req.FilePriorities {
+					if filePriority[i], err = core.ParseFilePriority(s); err != nil {
+						return CodeError(1, err)
+					}
+				}
+			}
+
+			err = c.AddTorrent(m, info, downloadDir, req.Tags, req.Category, filePriority)
 			if err != nil {
 				return CodeError(5, errgo.Wrap(err, "failed to add torrent to download"))
 			}
 
-			res.InfoHash = m.HashInfoBytes().HexString()
+			res.InfoHash = info.Hash.Hex()
 
 			return nil
 		},
@@ -75,13 +91,98 @@ func AddTorrent(h *jsonrpc.Handler, c *core.Client) {
 	h.Add(u)
 }
 
+// addDownloadDir return download dir of new torrent,
+// save path of category is used if download_dir is empty.
+func addDownloadDir(c *core.Client, req *AddTorrentRequest, name string) (string, error) {
+	if req.DownloadDir != "" {
+		if req.IsBaseDir {
+			return req.DownloadDir, nil
+		}
+
+		return filepath.Join(req.DownloadDir, name), nil
+	}
+
+	if req.Category != "" {
+		category, ok := c.GetCategory(req.Category)
+		if !ok {
+			return "", CodeError(1, fmt.Errorf("category %q not exists", req.Category))
+		}
+
+		if category.SavePath != "" {
+			return filepath.Join(category.SavePath, name), nil
+		}
+	}
+
+	return c.Config.App.DownloadDir, nil
+}
+
+func addMagnet(c *core.Client, req *AddTorrentRequest, res *AddTorrentResponse) error {
+	m, err := metainfo.ParseMagnetUri(req.Magnet)
+	if err != nil {
+		return CodeError(2, errgo.Wrap(err, "failed to parse magnet uri"))
+	}
+
+	name := m.DisplayName
+	if name == "" {
+		name = m.InfoHash.HexString()
+	}
+
+	downloadDir, err := addDownloadDir(c, req, name)
+	if err != nil {
+		return err
+	}
+
+	if req.Tags == nil {
+		req.Tags = []string{}
+	}
+
+	err = c.AddMagnet(m, downloadDir, req.Tags, req.Category)
+	if err != nil {
+		return CodeError(5, errgo.Wrap(err, "failed to add torrent to download"))
+	}
+
+	res.InfoHash = m.InfoHash.HexString()
+
+	return nil
+}
+
 type GetTorrentRequest struct {
 	InfoHash string `json:"info_hash" description:"torrent file hash" required:"true"`
 }
 
 type GetTorrentResponse struct {
-	Name string   `json:"name" required:"true"`
-	Tags []string `json:"tags"`
+	Name     string        `json:"name" required:"true"`
+	Category string        `json:"category" description:"empty if torrent is uncategorized" required:"true"`
+	Tags     []string      `json:"tags"`
+	Trackers []TrackerInfo `json:"trackers" required:"true"`
+	WebSeeds []WebSeedInfo `json:"web_seeds" description:"http mirrors from url-list or httpseeds of torrent" required:"true"`
+	Files    []FileInfo    `json:"files" description:"empty if metadata is not available yet" required:"true"`
+}
+
+type FileInfo struct {
+	Path      string `json:"path" required:"true"`
+	Priority  string `json:"priority" description:"skip, low, normal or high" required:"true"`
+	Index     int    `json:"index" required:"true"`
+	Length    int64  `json:"length" required:"true"`
+	Completed int64  `json:"completed" description:"bytes of verified pieces in this file" required:"true"`
+	Pad       bool   `json:"pad" description:"padding file of v2 or hybrid torrent, it's not stored on disk" required:"true"`
+}
+
+type TrackerInfo struct {
+	URL        string `json:"url" required:"true"`
+	Error      string `json:"error,omitempty"`
+	LastScrape int64  `json:"last_scrape" description:"unix timestamp of last scrape, 0 if never scraped" required:"true"`
+	Tier       int    `json:"tier" required:"true"`
+	Peers      int    `json:"peers" description:"peers returned by last announce" required:"true"`
+	Seeders    int    `json:"seeders" required:"true"`
+	Leechers   int    `json:"leechers" required:"true"`
+	Completed  int    `json:"completed" description:"download count reported by tracker scrape" required:"true"`
+}
+
+type WebSeedInfo struct {
+	URL        string `json:"url" required:"true"`
+	Error      string `json:"error,omitempty" description:"error of last request, mirror is not used for a while after error"`
+	Downloaded int64  `json:"downloaded" description:"bytes fetched from this mirror" required:"true"`
 }
 
 func GetTorrent(h *jsonrpc.Handler, c *core.Client) {
@@ -99,6 +200,7 @@ func GetTorrent(h *jsonrpc.Handler, c *core.Client) {
 			}
 
 			res.Name = info.Name
+			res.Category = info.Category
 
 			if info.Tags == nil {
 				res.Tags = []string{}
@@ -106,6 +208,40 @@ func GetTorrent(h *jsonrpc.Handler, c *core.Client) {
 				res.Tags = info.Tags
 			}
 
+			res.Trackers = make([]TrackerInfo, len(info.Trackers))
+			for i, t := range info.Trackers {
+				res.Trackers[i] = TrackerInfo{
+					URL:       t.URL,
+					Error:     t.Error,
+					Tier:      t.Tier,
+					Peers:     t.Peers,
+					Seeders:   t.Seeders,
+					Leechers:  t.Leechers,
+					Completed: t.Completed,
+				}
+
+				if !t.LastScrape.IsZero() {
+					res.Trackers[i].LastScrape = t.LastScrape.Unix()
+				}
+			}
+
+			res.WebSeeds = make([]WebSeedInfo, len(info.WebSeeds))
+			for i, ws := range info.WebSeeds {
+				res.WebSeeds[i] = WebSeedInfo{URL: ws.URL, Error: ws.Error, Downloaded: ws.Downloaded}
+			}
+
+			res.Files = make([]FileInfo, len(info.Files))
+			for i, f := range info.Files {
+				res.Files[i] = FileInfo{
+					Index:     i,
+					Path:      f.Path,
+					Length:    f.Length,
+					Completed: f.Completed,
+					Priority:  f.Priority.String(),
+					Pad:       f.Pad,
+				}
+			}
+
 			return nil
 		},
 	)
@@ -0,0 +1,66 @@
+package web
+
+import (
+	"context"
+	"encoding/hex"
+
+	"github.com/swaggest/usecase"
+	"github.com/trim21/errgo"
+
+	"tyr/internal/core"
+	"tyr/internal/meta"
+	"tyr/internal/web/jsonrpc"
+)
+
+type SetFilePriorityRequest struct {
+	InfoHash string `json:"info_hash" description:"torrent file hash" required:"true"`
+	Priority string `json:"priority" description:"skip, low, normal or high" required:"true" validate:"oneof=skip low normal high"`
+	Files    []int  `json:"files" description:"file indexes" required:"true" validate:"required,min=1"`
+}
+
+type SetSequentialRequest struct {
+	InfoHashes []string `json:"info_hashes" required:"true" validate:"required,min=1"`
+	Sequential bool     `json:"sequential" description:"download pieces in order" required:"true"`
+}
+
+// SetSequential change sequential download mode of torrents.
+// file can be streamed by `GET /stream/{info_hash}/{file_index}` in any mode.
+func SetSequential(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*SetSequentialRequest, BatchTorrentResponse](
+		func(ctx context.Context, req *SetSequentialRequest, res *BatchTorrentResponse) error {
+			res.Errors = eachInfoHash(req.InfoHashes, func(h meta.Hash) error {
+				return c.SetSequential(h, req.Sequential)
+			})
+
+			return nil
+		},
+	)
+
+	u.SetName("torrent.set_sequential")
+	h.Add(u)
+}
+
+func SetFilePriority(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*SetFilePriorityRequest, struct{}](
+		func(ctx context.Context, req *SetFilePriorityRequest, _ *struct{}) error {
+			r, err := hex.DecodeString(req.InfoHash)
+			if err != nil || len(r) != 20 {
+				return CodeError(1, errgo.Wrap(err, "invalid info_hash"))
+			}
+
+			priority, err := core.ParseFilePriority(req.Priority)
+			if err != nil {
+				return CodeError(1, err)
+			}
+
+			if err = c.SetFilePriority(meta.Hash(r), req.Files, priority); err != nil {
+				return CodeError(2, errgo.Wrap(err, "failed to set file priority"))
+			}
+
+			return nil
+		},
+	)
+
+	u.SetName("torrent.set_file_priority")
+	h.Add(u)
+}
@@ -0,0 +1,122 @@
+package web
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/swaggest/usecase"
+	"github.com/trim21/errgo"
+
+	"tyr/internal/core"
+	"tyr/internal/meta"
+	"tyr/internal/web/jsonrpc"
+)
+
+type BatchTorrentRequest struct {
+	InfoHashes []string `json:"info_hashes" required:"true" validate:"required,min=1"`
+}
+
+type RemoveTorrentRequest struct {
+	InfoHashes []string `json:"info_hashes" required:"true" validate:"required,min=1"`
+	DeleteData bool     `json:"delete_data" description:"also delete downloaded files"`
+}
+
+type MoveQueueRequest struct {
+	Action     string   `json:"action" description:"top, up, down or bottom" required:"true" validate:"oneof=top up down bottom"`
+	InfoHashes []string `json:"info_hashes" required:"true" validate:"required,min=1"`
+}
+
+type BatchTorrentResponse struct {
+	Errors map[string]string `json:"errors" description:"info hash to error message of failed torrents" required:"true"`
+}
+
+func StartTorrent(h *jsonrpc.Handler, c *core.Client) {
+	batchTorrentMethod(h, "torrent.start", c.StartDownload)
+}
+
+func StopTorrent(h *jsonrpc.Handler, c *core.Client) {
+	batchTorrentMethod(h, "torrent.stop", c.StopDownload)
+}
+
+// ResumeTorrent resume torrents in error state, data will be checked again.
+func ResumeTorrent(h *jsonrpc.Handler, c *core.Client) {
+	batchTorrentMethod(h, "torrent.resume", c.ResumeDownload)
+}
+
+func RecheckTorrent(h *jsonrpc.Handler, c *core.Client) {
+	batchTorrentMethod(h, "torrent.recheck", c.RecheckDownload)
+}
+
+func RemoveTorrent(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*RemoveTorrentRequest, BatchTorrentResponse](
+		func(ctx context.Context, req *RemoveTorrentRequest, res *BatchTorrentResponse) error {
+			res.Errors = eachInfoHash(req.InfoHashes, func(h meta.Hash) error {
+				return c.RemoveDownload(h, req.DeleteData)
+			})
+
+			return nil
+		},
+	)
+
+	u.SetName("torrent.remove")
+	h.Add(u)
+}
+
+// MoveQueue change queue position of torrents, torrents earlier in queue get downloading/seeding slots first.
+func MoveQueue(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*MoveQueueRequest, struct{}](
+		func(ctx context.Context, req *MoveQueueRequest, _ *struct{}) error {
+			var hashes = make([]meta.Hash, len(req.InfoHashes))
+			for i, s := range req.InfoHashes {
+				r, err := hex.DecodeString(s)
+				if err != nil || len(r) != 20 {
+					return CodeError(1, fmt.Errorf("invalid info_hash %q", s))
+				}
+
+				hashes[i] = meta.Hash(r)
+			}
+
+			if err := c.MoveQueue(hashes, core.QueueAction(req.Action)); err != nil {
+				return CodeError(2, errgo.Wrap(err, "failed to move queue"))
+			}
+
+			return nil
+		},
+	)
+
+	u.SetName("torrent.queue_move")
+	h.Add(u)
+}
+
+func batchTorrentMethod(h *jsonrpc.Handler, name string, fn func(h meta.Hash) error) {
+	u := usecase.NewInteractor[*BatchTorrentRequest, BatchTorrentResponse](
+		func(ctx context.Context, req *BatchTorrentRequest, res *BatchTorrentResponse) error {
+			res.Errors = eachInfoHash(req.InfoHashes, fn)
+
+			return nil
+		},
+	)
+
+	u.SetName(name)
+	h.Add(u)
+}
+
+// eachInfoHash call fn with each info hash, return error messages of failed ones.
+func eachInfoHash(infoHashes []string, fn func(h meta.Hash) error) map[string]string {
+	var errs = make(map[string]string)
+
+	for _, s := range infoHashes {
+		r, err := hex.DecodeString(s)
+		if err != nil || len(r) != 20 {
+			errs[s] = "invalid info_hash"
+			continue
+		}
+
+		if err = fn(meta.Hash(r)); err != nil {
+			errs[s] = err.Error()
+		}
+	}
+
+	return errs
+}
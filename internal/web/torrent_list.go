@@ -0,0 +1,175 @@
+package web
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/swaggest/usecase"
+
+	"tyr/internal/core"
+	"tyr/internal/web/jsonrpc"
+)
+
+type ListTorrentRequest struct {
+	State    []string `json:"state" description:"only return torrents in these states, e.g. Downloading, Uploading"`
+	Tag      string   `json:"tag" description:"only return torrents with this tag"`
+	Category *string  `json:"category" description:"only return torrents in this category, empty string for uncategorized torrents"`
+	Name     string   `json:"name" description:"only return torrents whose name contains this string, case insensitive"`
+	Sort     string   `json:"sort" description:"field to sort by, default to add order"`
+	Fields   []string `json:"fields" description:"fields to return, empty to return all fields"`
+	Offset   int      `json:"offset" validate:"gte=0"`
+	Limit    int      `json:"limit" description:"max torrents to return, 0 for no limit" validate:"gte=0"`
+	Reverse  bool     `json:"reverse" description:"sort in descending order"`
+}
+
+type ListTorrentResponse struct {
+	Total    int              `json:"total" description:"torrent count before pagination" required:"true"`
+	Torrents []map[string]any `json:"torrents" required:"true"`
+}
+
+var torrentFields = map[string]func(s *core.DownloadStatus) any{
+	"info_hash":             func(s *core.DownloadStatus) any { return s.InfoHash.Hex() },
+	"info_hash_v2":          func(s *core.DownloadStatus) any { return lo.Ternary(s.InfoHashV2.Zero(), "", s.InfoHashV2.Hex()) },
+	"name":                  func(s *core.DownloadStatus) any { return s.Name },
+	"state":                 func(s *core.DownloadStatus) any { return s.State.String() },
+	"progress":              func(s *core.DownloadStatus) any { return s.Progress },
+	"total_length":          func(s *core.DownloadStatus) any { return s.TotalLength },
+	"wanted_length":         func(s *core.DownloadStatus) any { return s.WantedLength },
+	"completed":             func(s *core.DownloadStatus) any { return s.Completed },
+	"left":                  func(s *core.DownloadStatus) any { return s.Left },
+	"downloaded":            func(s *core.DownloadStatus) any { return s.Downloaded },
+	"uploaded":              func(s *core.DownloadStatus) any { return s.Uploaded },
+	"download_rate":         func(s *core.DownloadStatus) any { return s.DownloadRate },
+	"upload_rate":           func(s *core.DownloadStatus) any { return s.UploadRate },
+	"download_limit":        func(s *core.DownloadStatus) any { return s.DownloadLimit },
+	"upload_limit":          func(s *core.DownloadStatus) any { return s.UploadLimit },
+	"eta":                   func(s *core.DownloadStatus) any { return s.ETA },
+	"peers":                 func(s *core.DownloadStatus) any { return s.Peers },
+	"seeds":                 func(s *core.DownloadStatus) any { return s.Seeds },
+	"tracker_seeders":       func(s *core.DownloadStatus) any { return s.TrackerSeeders },
+	"tracker_leechers":      func(s *core.DownloadStatus) any { return s.TrackerLeechers },
+	"blocked_peers":         func(s *core.DownloadStatus) any { return s.Blocked },
+	"queue_position":        func(s *core.DownloadStatus) any { return s.QueuePosition },
+	"sequential":            func(s *core.DownloadStatus) any { return s.Sequential },
+	"ratio":                 func(s *core.DownloadStatus) any { return s.Ratio },
+	"seeding_time":          func(s *core.DownloadStatus) any { return int64(s.SeedingTime.Seconds()) },
+	"seed_limit_action":     func(s *core.DownloadStatus) any { return string(s.SeedingLimits.Action) },
+	"seed_ratio_limit":      func(s *core.DownloadStatus) any { return s.SeedingLimits.Ratio },
+	"seed_time_limit":       func(s *core.DownloadStatus) any { return int64(s.SeedingLimits.Time.Seconds()) },
+	"seed_idle_limit":       func(s *core.DownloadStatus) any { return int64(s.SeedingLimits.IdleTime.Seconds()) },
+	"seed_ratio_left":       func(s *core.DownloadStatus) any { return s.SeedingGoalLeft.Ratio },
+	"seed_time_left":        func(s *core.DownloadStatus) any { return durationSeconds(s.SeedingGoalLeft.Time) },
+	"seed_idle_left":        func(s *core.DownloadStatus) any { return durationSeconds(s.SeedingGoalLeft.IdleTime) },
+	"global_seeding_limits": func(s *core.DownloadStatus) any { return s.GlobalSeedingLimits },
+	"category":              func(s *core.DownloadStatus) any { return s.Category },
+	"tags":                  func(s *core.DownloadStatus) any { return lo.Ternary(s.Tags == nil, []string{}, s.Tags) },
+	"download_dir":          func(s *core.DownloadStatus) any { return s.DownloadDir },
+	"error":                 func(s *core.DownloadStatus) any { return s.Error },
+	"add_at":                func(s *core.DownloadStatus) any { return s.AddAt.Unix() },
+	"completed_at": func(s *core.DownloadStatus) any {
+		return lo.Ternary(s.CompletedAt.IsZero(), 0, s.CompletedAt.Unix())
+	},
+}
+
+func ListTorrent(h *jsonrpc.Handler, c *core.Client) {
+	u := usecase.NewInteractor[*ListTorrentRequest, ListTorrentResponse](
+		func(ctx context.Context, req *ListTorrentRequest, res *ListTorrentResponse) error {
+			fields := req.Fields
+			if len(fields) == 0 {
+				fields = lo.Keys(torrentFields)
+			}
+
+			for _, field := range fields {
+				if _, ok := torrentFields[field]; !ok {
+					return CodeError(1, fmt.Errorf("unknown field %q", field))
+				}
+			}
+
+			if req.Sort != "" {
+				if _, ok := torrentFields[req.Sort]; !ok || req.Sort == "tags" {
+					return CodeError(1, fmt.Errorf("can't sort by field %q", req.Sort))
+				}
+			}
+
+			torrents := lo.Filter(c.ListDownloads(), func(s core.DownloadStatus, _ int) bool {
+				return matchTorrent(req, &s)
+			})
+
+			if req.Sort != "" {
+				get := torrentFields[req.Sort]
+				slices.SortStableFunc(torrents, func(a, b core.DownloadStatus) int {
+					return compareField(get(&a), get(&b))
+				})
+			}
+
+			if req.Reverse {
+				slices.Reverse(torrents)
+			}
+
+			res.Total = len(torrents)
+
+			torrents = torrents[min(req.Offset, len(torrents)):]
+			if req.Limit != 0 && len(torrents) > req.Limit {
+				torrents = torrents[:req.Limit]
+			}
+
+			res.Torrents = make([]map[string]any, len(torrents))
+			for i, s := range torrents {
+				item := make(map[string]any, len(fields))
+				for _, field := range fields {
+					item[field] = torrentFields[field](&s)
+				}
+
+				res.Torrents[i] = item
+			}
+
+			return nil
+		},
+	)
+
+	u.SetName("torrent.list")
+	h.Add(u)
+}
+
+func matchTorrent(req *ListTorrentRequest, s *core.DownloadStatus) bool {
+	if len(req.State) != 0 && !lo.ContainsBy(req.State, func(state string) bool {
+		return strings.EqualFold(state, s.State.String())
+	}) {
+		return false
+	}
+
+	if req.Category != nil && s.Category != *req.Category {
+		return false
+	}
+
+	if req.Tag != "" && !slices.Contains(s.Tags, req.Tag) {
+		return false
+	}
+
+	if req.Name != "" && !strings.Contains(strings.ToLower(s.Name), strings.ToLower(req.Name)) {
+		return false
+	}
+
+	return true
+}
+
+func compareField(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		return cmp.Compare(a, b.(string))
+	case int:
+		return cmp.Compare(a, b.(int))
+	case int64:
+		return cmp.Compare(a, b.(int64))
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	case bool:
+		return cmp.Compare(lo.Ternary(a, 1, 0), lo.Ternary(b.(bool), 1, 0))
+	}
+
+	return 0
+}
@@ -77,6 +77,30 @@ func New(c *core.Client, token string, enableDebug bool) http.Handler {
 	AddTorrent(h, c)
 	GetTorrent(h, c)
 	MoveTorrent(h, c)
+	ListTorrent(h, c)
+	StartTorrent(h, c)
+	StopTorrent(h, c)
+	RecheckTorrent(h, c)
+	ResumeTorrent(h, c)
+	RemoveTorrent(h, c)
+	MoveQueue(h, c)
+	SetFilePriority(h, c)
+	SetSequential(h, c)
+	SetTorrentSpeedLimits(h, c)
+	SetTorrentSeedingLimits(h, c)
+	AddTorrentTags(h, c)
+	RemoveTorrentTags(h, c)
+	SetTorrentCategory(h, c)
+	ListTags(h, c)
+	RenameTag(h, c)
+	ListCategories(h, c)
+	SetCategory(h, c)
+	RemoveCategory(h, c)
+	GetSpeedLimits(h, c)
+	SetSpeedLimits(h, c)
+	ReloadIPFilter(h, c)
+	ListBans(h, c)
+	ClearBans(h, c)
 
 	var auth = func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -100,6 +124,21 @@ func New(c *core.Client, token string, enableDebug bool) http.Handler {
 
 	r.With(middleware.NoCache, auth).Handle("POST /json_rpc", h)
 
+	// media players and browser EventSource can't set header, token can also be passed in query.
+	var queryAuth = func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(HeaderAuthorization) != token && r.URL.Query().Get("token") != token {
+				res.Text(w, http.StatusUnauthorized, "invalid token")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	r.With(queryAuth).Get("/stream/{info_hash}/{file_index}", streamFile(c))
+	r.With(middleware.NoCache, queryAuth).Get("/events", streamEvents(c))
+
 	r.Get("/docs/openapi.json", h.OpenAPI.ServeHTTP)
 
 	r.Handle("GET /docs/*", v5.NewHandlerWithConfig(swgui.Config{